@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+)
+
+// Status of a domain in the bulk state file
+const (
+	bulkStatusDone  = "done"
+	bulkStatusError = "error"
+)
+
+/*
+Struct created to hold the outcome of a domain in a bulk scan (that is in the bulkState struct)
+*/
+type bulkEntry struct {
+	Domain    string                     `json:"domain"`
+	Status    string                     `json:"status"` // done or error
+	Grade     string                     `json:"grade,omitempty"`
+	Score     int                        `json:"score"`
+	Verdict   string                     `json:"verdict,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+	ScannedAt time.Time                  `json:"scannedAt"`
+	Report    *scripts.FilteredTLSReport `json:"report,omitempty"`
+}
+
+/*
+Struct created to hold the progress of a bulk scan. The state file is a JSON Lines journal: the outcome of every
+domain is appended as one line, so a checkpoint costs the size of that outcome and an interrupted run resumes
+where it stopped. The journal is compacted to the latest outcome of each domain when it is loaded
+*/
+type bulkState struct {
+	mu      sync.Mutex
+	path    string
+	journal *os.File
+	Entries map[string]*bulkEntry
+}
+
+/*
+bulkCommand runs "nebula bulk": it scans the domains of a file with bounded concurrency and writes the combined result
+Args:
+
+	args []string: The arguments after "bulk"
+
+Returns:
+
+	int: The exit code of the command
+*/
+func bulkCommand(args []string) int {
+	fs := flag.NewFlagSet("bulk", flag.ContinueOnError)
+	file := fs.String("file", "", "File with one domain per line (blank lines and # comments are ignored)")
+	statePath := fs.String("state", "nebula-bulk-state.jsonl", "State file (JSON Lines) used to resume an interrupted run")
+	out := fs.String("out", "", "Combined result file, .csv or .json (stdout as CSV if empty)")
+	concurrency := fs.Int("concurrency", 2, "Maximum number of assessments running at the same time")
+	startInterval := fs.Duration("start-interval", 2*time.Second, "Minimum wait between starting two assessments")
+	retries := fs.Int("retries", 3, "Retries of a domain when SSL Labs is rate limiting or overloaded")
+	retryErrors := fs.Bool("retry-errors", false, "Scan again the domains that ended with an error in a previous run")
+	apiURL := fs.String("api", "", "Base URL of a running Nebula API (e.g. http://localhost:8080), SSL Labs is called directly if empty")
+	timeout := fs.Duration("timeout", 15*time.Minute, "Maximum time to wait for each scan to complete")
+	interval := fs.Duration("poll-interval", 10*time.Second, "Wait between two status polls")
+	aggregation := fs.String("aggregation", scripts.DefaultAggregation, "Grade aggregation strategy: worst, best or majority")
+	lang := fs.String("lang", scripts.DefaultLanguage, "Language of the summaries: es or en")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: nebula bulk -file domains.txt [flags]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitPass
+		}
+		return exitUsage
+	}
+	if *file == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *concurrency < 1 || *retries < 0 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be at least 1 and -retries cannot be negative")
+		return exitUsage
+	}
+	if ext := strings.ToLower(filepath.Ext(*out)); *out != "" && ext != ".csv" && ext != ".json" {
+		fmt.Fprintf(os.Stderr, "Invalid output file %q, the extension must be .csv or .json\n", *out)
+		return exitUsage
+	}
+	if !scripts.IsValidAggregation(*aggregation) {
+		fmt.Fprintf(os.Stderr, "Invalid aggregation %q, allowed values: worst, best, majority\n", *aggregation)
+		return exitUsage
+	}
+	if !scripts.IsSupportedLanguage(*lang) {
+		fmt.Fprintf(os.Stderr, "Unsupported language %q, allowed values: es, en\n", *lang)
+		return exitUsage
+	}
+
+	domains, err := readDomains(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	state, err := loadBulkState(*statePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	defer state.Close()
+
+	var pending []string
+	for _, domain := range domains {
+		entry, scanned := state.Entries[domain]
+		if !scanned || (*retryErrors && entry.Status == bulkStatusError) {
+			pending = append(pending, domain)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d domains, %d already scanned, %d pending\n", len(domains), len(domains)-len(pending), len(pending))
+
+	s := &scanner{
+		APIURL:       *apiURL,
+		Options:      scripts.FilterOptions{Aggregation: *aggregation, Language: *lang},
+		PollInterval: *interval,
+		Client:       &http.Client{Timeout: time.Minute},
+	}
+	// Ctrl+C stops starting new scans, the interrupted ones are not recorded so the next run scans them again
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *apiURL == "" && len(pending) > 0 {
+		// More workers than the assessments SSL Labs allows would only wait for a free slot
+		if info, err := scripts.GetSSLLabsInfo(ctx); err == nil && info.MaxAssessments > 0 && *concurrency > info.MaxAssessments {
+			fmt.Fprintf(os.Stderr, "SSL Labs allows %d assessments at the same time, -concurrency lowered from %d\n", info.MaxAssessments, *concurrency)
+			*concurrency = info.MaxAssessments
+		}
+	}
+
+	runBulkScans(ctx, s, state, pending, *concurrency, *startInterval, *timeout, *retries)
+
+	if err := writeBulkResult(*out, state, domains); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the result: %v\n", err)
+		return exitScanError
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted, run the same command again to resume from %s\n", *statePath)
+		return exitScanError
+	}
+	for _, domain := range domains {
+		if entry := state.Entries[domain]; entry == nil || entry.Status != bulkStatusDone {
+			return exitScanError
+		}
+	}
+	return exitPass
+}
+
+/*
+runBulkScans scans the pending domains with a pool of workers, spacing the start of the assessments
+Args:
+
+	ctx context.Context: Context that stops the run when done
+	s *scanner: The scanner used for every domain
+	state *bulkState: The state where every outcome is checkpointed
+	pending []string: The domains to scan
+	concurrency int: The number of workers
+	startInterval time.Duration: Minimum wait between starting two assessments
+	timeout time.Duration: Maximum time of each scan
+	retries int: Retries of a domain when SSL Labs is overloaded
+*/
+func runBulkScans(ctx context.Context, s *scanner, state *bulkState, pending []string, concurrency int, startInterval time.Duration, timeout time.Duration, retries int) {
+	domains := make(chan string)
+	starts := time.NewTicker(max(startInterval, time.Millisecond))
+	defer starts.Stop()
+
+	var wg sync.WaitGroup
+	for range min(concurrency, max(len(pending), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range domains {
+				entry, err := scanWithRetries(ctx, s, domain, timeout, retries, starts.C)
+				if ctx.Err() != nil {
+					return // Interrupted: the domain stays pending
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", domain, err)
+				} else {
+					fmt.Fprintf(os.Stderr, "%s: grade %s, score %d\n", domain, entry.Grade, entry.Score)
+				}
+				if err := state.record(entry); err != nil {
+					fmt.Fprintf(os.Stderr, "Error saving the state: %v\n", err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, domain := range pending {
+		select {
+		case domains <- domain:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(domains)
+	wg.Wait()
+}
+
+/*
+scanWithRetries scans a domain, retrying with an increasing backoff while SSL Labs is rate limiting or overloaded
+Args:
+
+	ctx context.Context: Context of the whole run
+	s *scanner: The scanner
+	domain string: The domain to scan
+	timeout time.Duration: Maximum time of each attempt
+	retries int: Maximum number of retries
+	starts <-chan time.Time: Ticks that space the start of the assessments
+
+Returns:
+
+	*bulkEntry: The outcome of the domain
+	error: The error of the last attempt, nil if the scan completed
+*/
+func scanWithRetries(ctx context.Context, s *scanner, domain string, timeout time.Duration, retries int, starts <-chan time.Time) (*bulkEntry, error) {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * 30 * time.Second
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-starts:
+		}
+
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		var report *scripts.FilteredTLSReport
+		report, err = s.Scan(scanCtx, domain)
+		cancel()
+		if err == nil {
+			return &bulkEntry{Domain: domain, Status: bulkStatusDone, Grade: report.Grade, Score: report.Score,
+				Verdict: report.Verdict, ScannedAt: time.Now(), Report: report}, nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("timeout: the scan did not complete in %s", timeout)
+		}
+		if !errors.Is(err, scripts.ErrSSLLabsOverloaded) {
+			break
+		}
+	}
+	return &bulkEntry{Domain: domain, Status: bulkStatusError, Error: err.Error(), ScannedAt: time.Now()}, err
+}
+
+/*
+readDomains reads the domains of a file, one per line, skipping blank lines, # comments and duplicates
+Args:
+
+	path string: The file path
+
+Returns:
+
+	[]string: The domains in the order of the file
+	error: Any error encountered during the process
+*/
+func readDomains(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var domains []string
+	seen := map[string]bool{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		line, _, _ := strings.Cut(lines.Text(), "#")
+		domain := strings.ToLower(strings.TrimSpace(line))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("%s has no domains", path)
+	}
+	return domains, nil
+}
+
+/*
+loadBulkState reads the state file of a previous run, compacts it and opens it to append the new outcomes.
+A line cut by an interruption at the end of the file is dropped
+Args:
+
+	path string: The state file path, created if it does not exist
+
+Returns:
+
+	*bulkState: Pointer of the state, Close must be called when the run ends
+	error: Any error encountered during the process
+*/
+func loadBulkState(path string) (*bulkState, error) {
+	state := &bulkState{path: path, Entries: map[string]*bulkEntry{}}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := state.readJournal(data); err != nil {
+		return nil, fmt.Errorf("Error decoding state file %s: %v", path, err)
+	}
+
+	if err := state.compact(); err != nil {
+		return nil, fmt.Errorf("Error compacting state file %s: %v", path, err)
+	}
+	if state.journal, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+/*
+readJournal loads the outcomes of a JSON Lines state file, the last line of a domain wins
+Args:
+
+	data []byte: The content of the file
+
+Returns:
+
+	error: The error of an invalid line other than the last one
+*/
+func (st *bulkState) readJournal(data []byte) error {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry bulkEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Domain == "" {
+			if i == len(lines)-1 {
+				break // Written partially when the run was interrupted, the domain is scanned again
+			}
+			return fmt.Errorf("line %d: invalid outcome", i+1)
+		}
+		st.Entries[entry.Domain] = &entry
+	}
+	return nil
+}
+
+/*
+compact rewrites the state file with one line per domain, the file is replaced atomically so an interruption
+while writing does not corrupt it
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func (st *bulkState) compact() error {
+	domains := make([]string, 0, len(st.Entries))
+	for domain := range st.Entries {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	tmp := st.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer) // Encode ends every outcome with a new line
+	for _, domain := range domains {
+		if err := encoder.Encode(st.Entries[domain]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+/*
+record stores the outcome of a domain and appends it to the state file
+Args:
+
+	entry *bulkEntry: The outcome of the domain
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func (st *bulkState) record(entry *bulkEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Entries[entry.Domain] = entry
+	_, err = st.journal.Write(append(line, '\n')) // A single write, so the lines of two workers never mix
+	return err
+}
+
+/*
+Close closes the state file
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func (st *bulkState) Close() error {
+	return st.journal.Close()
+}
+
+/*
+writeBulkResult writes the combined result of the domains (including the ones of previous runs) in CSV or JSON
+Args:
+
+	path string: The output file, .csv or .json (stdout as CSV if empty)
+	state *bulkState: The state with the outcomes
+	domains []string: The domains of the input file, in order
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func writeBulkResult(path string, state *bulkState, domains []string) error {
+	out := os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	var entries []*bulkEntry
+	for _, domain := range domains {
+		if entry, ok := state.Entries[domain]; ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if entries == nil {
+			entries = []*bulkEntry{}
+		}
+		return encoder.Encode(entries)
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"domain", "status", "grade", "score", "verdict", "endpoints", "minCertExpiresInDays", "error", "scannedAt"})
+	for _, entry := range entries {
+		endpoints, expiresIn := "", ""
+		if entry.Report != nil {
+			endpoints = strconv.Itoa(len(entry.Report.Endpoints))
+			expiresIn = minCertExpiry(entry.Report)
+		}
+		w.Write([]string{entry.Domain, entry.Status, entry.Grade, strconv.Itoa(entry.Score), entry.Verdict, endpoints,
+			expiresIn, entry.Error, entry.ScannedAt.Format(time.RFC3339)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+/*
+minCertExpiry returns the days until the first certificate of the report expires
+Args:
+
+	report *scripts.FilteredTLSReport: The report
+
+Returns:
+
+	string: The number of days, empty if no endpoint has a certificate
+*/
+func minCertExpiry(report *scripts.FilteredTLSReport) string {
+	days := math.Inf(1)
+	for _, endpoint := range report.Endpoints {
+		if endpoint.Certificate != nil {
+			days = math.Min(days, endpoint.Certificate.ExpiresInDays)
+		}
+	}
+	if math.IsInf(days, 1) {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", days)
+}
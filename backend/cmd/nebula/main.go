@@ -0,0 +1,67 @@
+/*
+nebula is the command-line client of the TLS scanner, meant to be run from CI pipelines.
+
+Usage:
+
+	nebula scan [flags] <domain>
+	nebula bulk -file domains.txt [flags]
+
+The scan runs against SSL Labs directly through the scripts package or, with -api, through a running Nebula API.
+The exit code tells the pipeline the outcome of the scan (see the exit* constants).
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Exit codes of the command, stable so pipelines can branch on them
+const (
+	exitPass          = 0 // The scan finished and the report meets the thresholds
+	exitPolicyFailure = 1 // The scan finished but the report does not meet the thresholds
+	exitScanError     = 2 // The scan could not be started or SSL Labs returned an error
+	exitTimeout       = 3 // The scan did not finish before -timeout
+	exitUsage         = 4 // Invalid command, flags or arguments
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	switch os.Args[1] {
+	case "scan":
+		os.Exit(scanCommand(os.Args[2:]))
+	case "bulk":
+		os.Exit(bulkCommand(os.Args[2:]))
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(exitUsage)
+	}
+}
+
+/*
+usage prints the available commands and the exit codes
+*/
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: nebula <command> [flags]
+
+Commands:
+  scan <domain>   Scan a domain and check the result against the thresholds
+  bulk            Scan the domains of a file, resuming an interrupted run
+
+Exit codes:
+  0  pass
+  1  policy failure (grade, certificate expiry or policy rules)
+  2  scan error (bulk: some domain failed or the run was interrupted)
+  3  timeout
+  4  usage error
+
+Run "nebula <command> -h" for the flags of a command.
+`)
+}
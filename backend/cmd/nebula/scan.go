@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+)
+
+/*
+scanCommand runs "nebula scan": it scans a domain, prints the summary and checks the thresholds
+Args:
+
+	args []string: The arguments after "scan"
+
+Returns:
+
+	int: The exit code of the command
+*/
+func scanCommand(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	minGrade := fs.String("min-grade", "", "Lowest domain grade accepted (e.g. A, A-, B)")
+	failOnExpiry := fs.String("fail-on-expiry", "", "Fail when a certificate expires within this window (e.g. 14d, 72h)")
+	policyFile := fs.String("policy", "", "Verdict policy file (YAML or JSON) the report must pass")
+	apiURL := fs.String("api", "", "Base URL of a running Nebula API (e.g. http://localhost:8080), SSL Labs is called directly if empty")
+	timeout := fs.Duration("timeout", 15*time.Minute, "Maximum time to wait for the scan to complete")
+	interval := fs.Duration("poll-interval", 10*time.Second, "Wait between two status polls")
+	aggregation := fs.String("aggregation", scripts.DefaultAggregation, "Grade aggregation strategy: worst, best or majority")
+	lang := fs.String("lang", scripts.DefaultLanguage, "Language of the summary: es or en")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: nebula scan [flags] <domain>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	// Flags are accepted after the domain too (nebula scan example.com --min-grade A)
+	if err := fs.Parse(reorderFlags(fs, args)); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitPass
+		}
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	domain := fs.Arg(0)
+
+	policy, err := buildScanPolicy(*policyFile, *minGrade, *failOnExpiry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !scripts.IsValidAggregation(*aggregation) {
+		fmt.Fprintf(os.Stderr, "Invalid aggregation %q, allowed values: worst, best, majority\n", *aggregation)
+		return exitUsage
+	}
+	if !scripts.IsSupportedLanguage(*lang) {
+		fmt.Fprintf(os.Stderr, "Unsupported language %q, allowed values: es, en\n", *lang)
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid format %q, allowed values: text, json\n", *format)
+		return exitUsage
+	}
+
+	s := &scanner{
+		APIURL:       *apiURL,
+		Options:      scripts.FilterOptions{Aggregation: *aggregation, Language: *lang},
+		PollInterval: *interval,
+		Client:       &http.Client{Timeout: time.Minute},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report, err := s.Scan(ctx, domain)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "Timeout: the scan of %s did not complete in %s\n", domain, *timeout)
+			return exitTimeout
+		}
+		fmt.Fprintf(os.Stderr, "Scan error: %v\n", err)
+		return exitScanError
+	}
+
+	var evaluation *scripts.PolicyEvaluation
+	if policy != nil {
+		evaluation = policy.Evaluate(report)
+	}
+	printScanResult(report, evaluation, *format)
+
+	if evaluation != nil && !evaluation.Passed {
+		return exitPolicyFailure
+	}
+	return exitPass
+}
+
+/*
+buildScanPolicy merges the policy file and the threshold flags into the policy the report is checked against,
+the flags take precedence over the rules of the file
+Args:
+
+	path string: The policy file, empty for none
+	minGrade string: The -min-grade flag
+	failOnExpiry string: The -fail-on-expiry flag
+
+Returns:
+
+	*scripts.Policy: Pointer of the policy, nil when no threshold is given
+	error: Any error encountered during the process
+*/
+func buildScanPolicy(path string, minGrade string, failOnExpiry string) (*scripts.Policy, error) {
+	policy := &scripts.Policy{Name: "cli"}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		format := "yaml"
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			format = "json"
+		}
+		if policy, err = scripts.ParsePolicy(data, format); err != nil {
+			return nil, err
+		}
+	}
+
+	if minGrade != "" {
+		policy.Rules.MinGrade = minGrade
+	}
+	if failOnExpiry != "" {
+		days, err := parseDays(failOnExpiry)
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules.MinExpiryDays = days
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if path == "" && minGrade == "" && failOnExpiry == "" {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+/*
+parseDays parses an expiry window written in days ("14d", "14") or as a Go duration ("336h")
+Args:
+
+	value string: The window
+
+Returns:
+
+	float64: The window in days
+	error: An error if the value is not a positive window
+*/
+func parseDays(value string) (float64, error) {
+	var days float64
+	if number, ok := strings.CutSuffix(value, "d"); ok || !strings.ContainsAny(value, "hms") {
+		parsed, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expiry window %q, use days (e.g. 14d) or a duration (e.g. 72h)", value)
+		}
+		days = parsed
+	} else {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expiry window %q, use days (e.g. 14d) or a duration (e.g. 72h)", value)
+		}
+		days = duration.Hours() / 24
+	}
+	if days <= 0 {
+		return 0, fmt.Errorf("invalid expiry window %q, it must be positive", value)
+	}
+	return days, nil
+}
+
+/*
+printScanResult prints the report and the threshold results to stdout
+Args:
+
+	report *scripts.FilteredTLSReport: The filtered report
+	evaluation *scripts.PolicyEvaluation: The threshold results, nil when no threshold is given
+	format string: text or json
+*/
+func printScanResult(report *scripts.FilteredTLSReport, evaluation *scripts.PolicyEvaluation, format string) {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(struct {
+			Report     *scripts.FilteredTLSReport `json:"report"`
+			Evaluation *scripts.PolicyEvaluation  `json:"evaluation,omitempty"`
+		}{report, evaluation})
+		return
+	}
+
+	fmt.Printf("%s: grade %s, score %d, verdict %s\n", report.Host, report.Grade, report.Score, report.VerdictText)
+	fmt.Println(report.Summary)
+	if evaluation == nil {
+		return
+	}
+	fmt.Println()
+	for _, result := range evaluation.Results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("[%s] %s: expected %s, actual %s\n", status, result.Rule, result.Expected, result.Actual)
+	}
+}
+
+/*
+reorderFlags moves the positional arguments after the flags, so the flag package parses the flags written after the domain
+Args:
+
+	fs *flag.FlagSet: The flag set, used to know which flags take a value
+	args []string: The raw arguments
+
+Returns:
+
+	[]string: The flags followed by the positional arguments
+*/
+func reorderFlags(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		// Flags other than booleans take the next argument as their value
+		if f := fs.Lookup(name); f != nil && i+1 < len(args) {
+			if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !boolFlag.IsBoolFlag() {
+				flags = append(flags, args[i+1])
+				i++
+			}
+		}
+	}
+	return append(flags, positional...)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+)
+
+/*
+Struct created to run scans either against SSL Labs directly or through a running Nebula API
+*/
+type scanner struct {
+	APIURL       string                // Base URL of the Nebula API, empty to use the scripts package directly
+	Options      scripts.FilterOptions // Aggregation and language of the report
+	PollInterval time.Duration
+	Client       *http.Client
+
+	startMu sync.Mutex // Serializes the capacity check and the start of the direct assessments
+}
+
+/*
+Scan runs a complete assessment of a domain and returns the filtered report
+Args:
+
+	ctx context.Context: Context that bounds the whole scan (its deadline is the scan timeout)
+	domain string: The domain to assess
+
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the filtered report
+	error: Any error encountered during the process, ctx.Err() if the context ended first
+*/
+func (s *scanner) Scan(ctx context.Context, domain string) (*scripts.FilteredTLSReport, error) {
+	if s.APIURL != "" {
+		return s.scanThroughAPI(ctx, domain)
+	}
+	return s.scanDirect(ctx, domain)
+}
+
+/*
+scanDirect assesses the domain with the scripts package, like the API does in StartScan
+Args:
+
+	ctx context.Context: Context that bounds the scan
+	domain string: The domain to assess
+
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the filtered report (with the CAA check applied)
+	error: Any error encountered during the process
+*/
+func (s *scanner) scanDirect(ctx context.Context, domain string) (*scripts.FilteredTLSReport, error) {
+	options := s.Options
+	options.RequestedAt = time.Now()
+	if err := s.startAssessment(ctx, domain); err != nil {
+		return nil, err
+	}
+	raw, err := scripts.PollUntilReadyContext(ctx, domain, s.PollInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := scripts.FilterSSLReportWithOptions(raw, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := scripts.ApplyCAACheck(ctx, report, scripts.NewDNSResolver()); err != nil && ctx.Err() == nil {
+		// The CAA policy is informative, a failed lookup does not fail the scan
+		fmt.Fprintf(os.Stderr, "Warning: CAA check for %s failed: %v\n", domain, err)
+	}
+	return report, nil
+}
+
+/*
+startAssessment starts a new SSL Labs assessment once the client has room for it: /info is consulted before each
+start and, while currentAssessments reaches maxAssessments, it is consulted again after the poll interval. After
+starting, it waits newAssessmentCoolOff before letting another assessment start. If /info fails the assessment is
+started anyway, SSL Labs rejects it with a rate limit error when there is no room
+Args:
+
+	ctx context.Context: Context that bounds the wait
+	domain string: The domain to assess
+
+Returns:
+
+	error: Any error encountered during the process, ctx.Err() if the context ended while waiting
+*/
+func (s *scanner) startAssessment(ctx context.Context, domain string) error {
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+
+	var coolOff time.Duration
+	for {
+		info, err := scripts.GetSSLLabsInfo(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "Warning: the capacity of SSL Labs is unknown (%v), starting %s anyway\n", err, domain)
+			break
+		}
+		coolOff = time.Duration(info.NewAssessmentCoolOff) * time.Millisecond
+		if info.MaxAssessments <= 0 || info.CurrentAssessments < info.MaxAssessments {
+			break
+		}
+		if err := sleepContext(ctx, s.PollInterval); err != nil {
+			return err
+		}
+	}
+
+	if _, err := scripts.CheckTLS(ctx, domain, true); err != nil {
+		return err
+	}
+	return sleepContext(ctx, coolOff)
+}
+
+/*
+sleepContext waits for the given duration or until the context ends
+Args:
+
+	ctx context.Context: The context
+	d time.Duration: The wait
+
+Returns:
+
+	error: ctx.Err() if the context ended first
+*/
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+/*
+scanThroughAPI starts the scan with POST /start-scan and polls GET /scan-status/:scanRequestID until it ends
+Args:
+
+	ctx context.Context: Context that bounds the scan
+	domain string: The domain to assess
+
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the filtered report returned by the API
+	error: Any error encountered during the process
+*/
+func (s *scanner) scanThroughAPI(ctx context.Context, domain string) (*scripts.FilteredTLSReport, error) {
+	base := strings.TrimRight(s.APIURL, "/")
+	query := "?lang=" + url.QueryEscape(s.Options.Language)
+
+	body, _ := json.Marshal(map[string]string{"domain": domain, "aggregation": s.Options.Aggregation})
+	var started struct {
+		ScanRequestID string `json:"scanRequestID"`
+		Error         string `json:"error"`
+	}
+	if err := s.doJSON(ctx, http.MethodPost, base+"/start-scan"+query, body, &started); err != nil {
+		return nil, err
+	}
+	if started.ScanRequestID == "" {
+		return nil, fmt.Errorf("the API did not return a scan request ID: %s", started.Error)
+	}
+
+	for {
+		var status struct {
+			Status         string                     `json:"status"`
+			FilteredResult *scripts.FilteredTLSReport `json:"filteredResult"`
+			Error          string                     `json:"error"`
+		}
+		if err := s.doJSON(ctx, http.MethodGet, base+"/scan-status/"+url.PathEscape(started.ScanRequestID)+query, nil, &status); err != nil {
+			return nil, err
+		}
+		switch status.Status {
+		case "complete":
+			if status.FilteredResult == nil {
+				return nil, fmt.Errorf("the scan of %s completed without a filtered report", domain)
+			}
+			return status.FilteredResult, nil
+		case "error":
+			return nil, fmt.Errorf("Error during TLS assessment for domain %s: %s", domain, status.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+/*
+doJSON sends a request to the API and decodes its JSON response
+Args:
+
+	ctx context.Context: Context of the request
+	method string: The HTTP method
+	endpoint string: The full URL
+	body []byte: The JSON body, nil for none
+	out any: Where the response is decoded
+
+Returns:
+
+	error: Any error encountered during the process, including non 2xx responses
+*/
+func (s *scanner) doJSON(ctx context.Context, method string, endpoint string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned %d: %s", method, endpoint, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,260 @@
+/*
+tlsfilter runs the SSL Labs report filter offline, over raw SSL Labs JSON reports saved to disk or piped through stdin,
+so archived reports can be processed (and bugs reproduced) without calling the API.
+
+Usage:
+
+	tlsfilter [-format json|table|markdown] [-aggregation worst|best|majority] [-lang es|en] [file ...]
+
+With no files (or with "-") the report is read from stdin. A file may hold a single report or a JSON array of
+reports (as written by the ssllabs-scan tool).
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/tidwall/gjson"
+)
+
+// Exit codes of the command
+const (
+	exitOK         = 0
+	exitInputError = 1 // At least one input could not be read or filtered
+	exitUsage      = 2
+)
+
+func main() {
+	format := flag.String("format", "json", "Output format: json, table or markdown")
+	aggregation := flag.String("aggregation", scripts.DefaultAggregation, "Grade aggregation strategy: worst, best or majority")
+	lang := flag.String("lang", scripts.DefaultLanguage, "Language of the summary and findings: es or en")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file ...]\n\nReads raw SSL Labs JSON reports from the files (or stdin) and prints the filtered reports.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *format != "json" && *format != "table" && *format != "markdown" {
+		fmt.Fprintf(os.Stderr, "Invalid format %q, allowed values: json, table, markdown\n", *format)
+		os.Exit(exitUsage)
+	}
+	if !scripts.IsValidAggregation(*aggregation) {
+		fmt.Fprintf(os.Stderr, "Invalid aggregation %q, allowed values: worst, best, majority\n", *aggregation)
+		os.Exit(exitUsage)
+	}
+	if !scripts.IsSupportedLanguage(*lang) {
+		fmt.Fprintf(os.Stderr, "Unsupported language %q, allowed values: es, en\n", *lang)
+		os.Exit(exitUsage)
+	}
+	options := scripts.FilterOptions{Aggregation: *aggregation, Language: *lang}
+
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	exitCode := exitOK
+	var reports []*scripts.FilteredTLSReport
+	for _, input := range inputs {
+		filtered, err := filterInput(input, options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", inputName(input), err)
+			exitCode = exitInputError
+		}
+		reports = append(reports, filtered...)
+	}
+
+	if err := writeReports(os.Stdout, reports, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the output: %v\n", err)
+		os.Exit(exitInputError)
+	}
+	os.Exit(exitCode)
+}
+
+/*
+filterInput reads a raw SSL Labs report (or an array of them) and filters it
+Args:
+
+	input string: The file path, "-" for stdin
+	options scripts.FilterOptions: The options of the filter
+
+Returns:
+
+	[]*scripts.FilteredTLSReport: The filtered reports (the ones filtered before an error are kept)
+	error: Any error encountered during the process
+*/
+func filterInput(input string, options scripts.FilterOptions) ([]*scripts.FilteredTLSReport, error) {
+	var raw []byte
+	var err error
+	if input == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := gjson.ParseBytes(raw)
+	if !parsed.IsArray() {
+		report, err := scripts.FilterSSLReportWithOptions(raw, options)
+		if err != nil {
+			return nil, err
+		}
+		return []*scripts.FilteredTLSReport{report}, nil
+	}
+
+	var reports []*scripts.FilteredTLSReport
+	for i, element := range parsed.Array() {
+		report, err := scripts.FilterSSLReportWithOptions([]byte(element.Raw), options)
+		if err != nil {
+			return reports, fmt.Errorf("report %d: %w", i, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+/*
+writeReports writes the filtered reports in the requested format
+Args:
+
+	w io.Writer: Where the output is written
+	reports []*scripts.FilteredTLSReport: The filtered reports
+	format string: json, table or markdown
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func writeReports(w io.Writer, reports []*scripts.FilteredTLSReport, format string) error {
+	switch format {
+	case "table":
+		return writeTable(w, reports)
+	case "markdown":
+		return writeMarkdown(w, reports)
+	default:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if len(reports) == 1 {
+			return encoder.Encode(reports[0])
+		}
+		if reports == nil {
+			reports = []*scripts.FilteredTLSReport{}
+		}
+		return encoder.Encode(reports)
+	}
+}
+
+/*
+writeTable writes one row per endpoint with its host level grade, score and verdict
+Args:
+
+	w io.Writer: Where the table is written
+	reports []*scripts.FilteredTLSReport: The filtered reports
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func writeTable(w io.Writer, reports []*scripts.FilteredTLSReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tGRADE\tSCORE\tVERDICT\tENDPOINT\tENDPOINT GRADE\tPROTOCOLS\tCERT EXPIRES (DAYS)")
+	for _, report := range reports {
+		if len(report.Endpoints) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t-\t-\t-\t-\n", report.Host, report.Grade, report.Score, report.VerdictText)
+			continue
+		}
+		for _, endpoint := range report.Endpoints {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", report.Host, report.Grade, report.Score, report.VerdictText,
+				endpoint.IPAddress, endpoint.Grade, strings.Join(endpoint.Protocols, ", "), expiresIn(endpoint))
+		}
+	}
+	return tw.Flush()
+}
+
+/*
+writeMarkdown writes a section per report with its endpoints table, findings and summary
+Args:
+
+	w io.Writer: Where the document is written
+	reports []*scripts.FilteredTLSReport: The filtered reports
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func writeMarkdown(w io.Writer, reports []*scripts.FilteredTLSReport) error {
+	var sb strings.Builder
+	for i, report := range reports {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "## %s\n\n", report.Host)
+		fmt.Fprintf(&sb, "**Grade:** %s · **Score:** %d · **Verdict:** %s\n\n", report.Grade, report.Score, report.VerdictText)
+
+		if len(report.Endpoints) > 0 {
+			sb.WriteString("| Endpoint | Grade | Score | Protocols | Cert expires (days) |\n")
+			sb.WriteString("|----------|-------|-------|-----------|---------------------|\n")
+			for _, endpoint := range report.Endpoints {
+				fmt.Fprintf(&sb, "| %s | %s | %d | %s | %s |\n", endpoint.IPAddress, endpoint.Grade, endpoint.Score,
+					strings.Join(endpoint.Protocols, ", "), expiresIn(endpoint))
+			}
+			sb.WriteString("\n")
+		}
+
+		if len(report.Findings) > 0 {
+			sb.WriteString("### Findings\n\n")
+			for _, finding := range report.Findings {
+				fmt.Fprintf(&sb, "- `%s` (%s): %s\n", finding.Code, finding.Severity, finding.Message)
+			}
+			sb.WriteString("\n")
+		}
+
+		fmt.Fprintf(&sb, "### Summary\n\n```\n%s\n```\n", strings.TrimSpace(report.Summary))
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/*
+expiresIn formats the days until the certificate of an endpoint expires
+Args:
+
+	endpoint scripts.FilteredEndpoint: The endpoint
+
+Returns:
+
+	string: The number of days, "-" if the endpoint has no certificate
+*/
+func expiresIn(endpoint scripts.FilteredEndpoint) string {
+	if endpoint.Certificate == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", endpoint.Certificate.ExpiresInDays)
+}
+
+/*
+inputName returns a printable name of an input for the error messages
+Args:
+
+	input string: The file path, "-" for stdin
+
+Returns:
+
+	string: The name of the input
+*/
+func inputName(input string) string {
+	if input == "-" {
+		return "stdin"
+	}
+	return input
+}
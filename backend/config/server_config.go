@@ -0,0 +1,528 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Storage backends of the API
+const (
+	StorageMongo  = "mongo"
+	StorageSQLite = "sqlite"
+	StorageMemory = "memory"
+)
+
+// Stores of the raw SSL Labs reports, empty for the default of the storage backend
+const (
+	RawReportsGridFS     = "gridfs"
+	RawReportsFilesystem = "filesystem"
+	RawReportsMemory     = "memory"
+	RawReportsNone       = "none"
+)
+
+/*
+Duration is a time.Duration written in the configuration file as a Go duration string (e.g. "10s", "2m") or a number
+of days followed by "d" (e.g. "90d")
+*/
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	if days, found := strings.CutSuffix(string(text), "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return fmt.Errorf("%q must be a duration (e.g. 10s or 90d)", text)
+		}
+		*d = Duration(time.Duration(count) * 24 * time.Hour)
+		return nil
+	}
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("%q must be a duration (e.g. 10s or 90d)", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+/*
+Struct created to hold the settings of the API server, read from the configuration file, the environment variables and
+the command-line flags (see Load)
+*/
+type Settings struct {
+	Server    ServerSettings    `yaml:"server" toml:"server"`
+	Scans     ScanSettings      `yaml:"scans" toml:"scans"`
+	SSLLabs   SSLLabsSettings   `yaml:"ssllabs" toml:"ssllabs"`
+	Storage   StorageSettings   `yaml:"storage" toml:"storage"`
+	Mongo     MongoSettings     `yaml:"mongo" toml:"mongo"`
+	Retention RetentionSettings `yaml:"retention" toml:"retention"`
+}
+
+/*
+Struct created to hold the settings of the HTTP listener
+*/
+type ServerSettings struct {
+	Address string `yaml:"address" toml:"address"` // Interface to listen on, 0.0.0.0 or empty for all of them (containers)
+	Port    int    `yaml:"port" toml:"port"`
+	GinMode string `yaml:"ginMode" toml:"ginMode"` // debug, release or test
+}
+
+/*
+Struct created to hold the settings of the scans started with /start-scan
+*/
+type ScanSettings struct {
+	Workers      int      `yaml:"workers" toml:"workers"`           // Assessments run at the same time, the rest wait their turn
+	PollInterval Duration `yaml:"pollInterval" toml:"pollInterval"` // Wait between two polls of an assessment
+	Timeout      Duration `yaml:"timeout" toml:"timeout"`           // Maximum duration of an assessment, 0 for no limit
+}
+
+/*
+Struct created to hold the settings of the SSL Labs API client
+*/
+type SSLLabsSettings struct {
+	APIURL         string   `yaml:"apiURL" toml:"apiURL"`                 // Base URL of the API (v2), e.g. a proxy or a mock
+	RequestTimeout Duration `yaml:"requestTimeout" toml:"requestTimeout"` // Timeout of each HTTP request to the API
+}
+
+/*
+Struct created to hold the settings of the storage backend and the raw SSL Labs reports
+*/
+type StorageSettings struct {
+	Backend               string `yaml:"backend" toml:"backend"`                             // mongo, sqlite or memory
+	SQLitePath            string `yaml:"sqlitePath" toml:"sqlitePath"`                       // Database file of the sqlite backend
+	RawReportsStore       string `yaml:"rawReportsStore" toml:"rawReportsStore"`             // gridfs, filesystem, memory or none, empty for the default of the backend
+	RawReportsDir         string `yaml:"rawReportsDir" toml:"rawReportsDir"`                 // Directory of the filesystem store
+	RawReportsCompression string `yaml:"rawReportsCompression" toml:"rawReportsCompression"` // zstd or gzip
+}
+
+/*
+Struct created to hold the retention policy of the stored data (see retention.Policy), a zero duration keeps the data forever
+*/
+type RetentionSettings struct {
+	ReportsMaxAge    Duration `yaml:"reportsMaxAge" toml:"reportsMaxAge"`       // Age after which the history of reports is downsampled
+	Snapshots        string   `yaml:"snapshots" toml:"snapshots"`               // none, daily, weekly or monthly
+	SnapshotsMaxAge  Duration `yaml:"snapshotsMaxAge" toml:"snapshotsMaxAge"`   // Age after which the snapshots are removed too
+	ScansMaxAge      Duration `yaml:"scansMaxAge" toml:"scansMaxAge"`           // Age after which the scan requests are removed
+	RawReportsMaxAge Duration `yaml:"rawReportsMaxAge" toml:"rawReportsMaxAge"` // Age after which the raw SSL Labs reports are removed
+	ArchiveDir       string   `yaml:"archiveDir" toml:"archiveDir"`             // Directory of the archives of the removed reports
+	Interval         Duration `yaml:"interval" toml:"interval"`                 // Time between two runs of the background job
+}
+
+/*
+DefaultSettings returns the settings used for the values that are not configured
+
+returns
+
+	*Settings: pointer with the default settings
+*/
+func DefaultSettings() *Settings {
+	return &Settings{
+		Server:  ServerSettings{Address: "localhost", Port: 8080, GinMode: "debug"},
+		Scans:   ScanSettings{Workers: 4, PollInterval: Duration(10 * time.Second), Timeout: Duration(30 * time.Minute)},
+		SSLLabs: SSLLabsSettings{APIURL: "https://api.ssllabs.com/api/v2", RequestTimeout: Duration(30 * time.Second)},
+		Storage: StorageSettings{
+			Backend:               StorageMongo,
+			SQLitePath:            "nebula.db",
+			RawReportsDir:         "raw-reports",
+			RawReportsCompression: "zstd",
+		},
+		Mongo: *DefaultMongoSettings(),
+		Retention: RetentionSettings{
+			Snapshots:   "monthly",
+			ScansMaxAge: Duration(7 * 24 * time.Hour),
+			ArchiveDir:  "archive",
+			Interval:    Duration(24 * time.Hour),
+		},
+	}
+}
+
+/*
+Struct created to hold a setting that can be given with an environment variable and a command-line flag, the settings
+without flag (e.g. the MongoDB password) are only read from the environment, so they are not visible in the process list
+*/
+type settingOption struct {
+	flag  string
+	env   string
+	usage string
+	set   func(settings *Settings, value string) error
+}
+
+func stringOption(field func(*Settings) *string) func(*Settings, string) error {
+	return func(settings *Settings, value string) error {
+		*field(settings) = value
+		return nil
+	}
+}
+
+func intOption(field func(*Settings) *int) func(*Settings, string) error {
+	return func(settings *Settings, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q must be an integer", value)
+		}
+		*field(settings) = parsed
+		return nil
+	}
+}
+
+func boolOption(field func(*Settings) *bool) func(*Settings, string) error {
+	return func(settings *Settings, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q must be true or false", value)
+		}
+		*field(settings) = parsed
+		return nil
+	}
+}
+
+func uintOption(field func(*Settings) *uint64) func(*Settings, string) error {
+	return func(settings *Settings, value string) error {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q must be a positive integer", value)
+		}
+		*field(settings) = parsed
+		return nil
+	}
+}
+
+func durationOption(field func(*Settings) *Duration) func(*Settings, string) error {
+	return func(settings *Settings, value string) error {
+		return field(settings).UnmarshalText([]byte(value))
+	}
+}
+
+// Settings that can also be given with an environment variable and a command-line flag
+var settingOptions = []settingOption{
+	{"address", "LISTEN_ADDRESS", "interface to listen on (0.0.0.0 for all)", stringOption(func(s *Settings) *string { return &s.Server.Address })},
+	{"port", "PORT", "port to listen on", intOption(func(s *Settings) *int { return &s.Server.Port })},
+	{"gin-mode", "GIN_MODE", "Gin mode: debug, release or test", stringOption(func(s *Settings) *string { return &s.Server.GinMode })},
+	{"scan-workers", "SCAN_WORKERS", "assessments run at the same time", intOption(func(s *Settings) *int { return &s.Scans.Workers })},
+	{"poll-interval", "SCAN_POLL_INTERVAL", "wait between two polls of an assessment", durationOption(func(s *Settings) *Duration { return &s.Scans.PollInterval })},
+	{"scan-timeout", "SCAN_TIMEOUT", "maximum duration of an assessment, 0 for no limit", durationOption(func(s *Settings) *Duration { return &s.Scans.Timeout })},
+	{"ssllabs-url", "SSLLABS_API_URL", "base URL of the SSL Labs API", stringOption(func(s *Settings) *string { return &s.SSLLabs.APIURL })},
+	{"ssllabs-timeout", "SSLLABS_REQUEST_TIMEOUT", "timeout of each request to SSL Labs", durationOption(func(s *Settings) *Duration { return &s.SSLLabs.RequestTimeout })},
+	{"storage", "STORAGE_BACKEND", "storage backend: mongo, sqlite or memory", stringOption(func(s *Settings) *string { return &s.Storage.Backend })},
+	{"sqlite-path", "SQLITE_PATH", "database file of the sqlite backend", stringOption(func(s *Settings) *string { return &s.Storage.SQLitePath })},
+	{"raw-reports-store", "RAW_REPORTS_STORE", "raw reports store: gridfs, filesystem, memory or none", stringOption(func(s *Settings) *string { return &s.Storage.RawReportsStore })},
+	{"raw-reports-dir", "RAW_REPORTS_DIR", "directory of the filesystem raw reports store", stringOption(func(s *Settings) *string { return &s.Storage.RawReportsDir })},
+	{"raw-reports-compression", "RAW_REPORTS_COMPRESSION", "compression of the raw reports: zstd or gzip", stringOption(func(s *Settings) *string { return &s.Storage.RawReportsCompression })},
+	{"", "MONGO_URI", "", stringOption(func(s *Settings) *string { return &s.Mongo.URI })},
+	{"mongo-scheme", "MONGO_SCHEME", "MongoDB scheme: mongodb+srv or mongodb", stringOption(func(s *Settings) *string { return &s.Mongo.Scheme })},
+	{"mongo-host", "MONGO_HOST", "MongoDB host, host:port or comma-separated hosts", stringOption(func(s *Settings) *string { return &s.Mongo.Host })},
+	{"mongo-user", "MONGO_USER", "MongoDB user", stringOption(func(s *Settings) *string { return &s.Mongo.User })},
+	{"", "MONGO_PASSWORD", "", stringOption(func(s *Settings) *string { return &s.Mongo.Password })},
+	{"mongo-db", "MONGO_DB", "MongoDB database", stringOption(func(s *Settings) *string { return &s.Mongo.Database })},
+	{"mongo-auth-source", "MONGO_AUTH_SOURCE", "database of the MongoDB user credentials", stringOption(func(s *Settings) *string { return &s.Mongo.AuthSource })},
+	{"mongo-replica-set", "MONGO_REPLICA_SET", "MongoDB replica set", stringOption(func(s *Settings) *string { return &s.Mongo.ReplicaSet })},
+	{"mongo-direct-connection", "MONGO_DIRECT_CONNECTION", "connect to a single MongoDB host (true or false)", boolOption(func(s *Settings) *bool { return &s.Mongo.DirectConnection })},
+	{"mongo-server-api-version", "MONGO_SERVER_API_VERSION", "MongoDB Stable API version, none to not declare it", stringOption(func(s *Settings) *string { return &s.Mongo.ServerAPIVersion })},
+	{"mongo-tls", "MONGO_TLS", "connect to MongoDB with TLS (true or false)", boolOption(func(s *Settings) *bool { return &s.Mongo.TLS })},
+	{"mongo-tls-ca-file", "MONGO_TLS_CA_FILE", "PEM file with the CA certificates of MongoDB", stringOption(func(s *Settings) *string { return &s.Mongo.TLSCAFile })},
+	{"mongo-tls-cert-key-file", "MONGO_TLS_CERT_KEY_FILE", "PEM file with the MongoDB client certificate and key", stringOption(func(s *Settings) *string { return &s.Mongo.TLSCertificateKeyFile })},
+	{"mongo-tls-insecure", "MONGO_TLS_INSECURE", "skip the verification of the MongoDB certificate (true or false)", boolOption(func(s *Settings) *bool { return &s.Mongo.TLSInsecure })},
+	{"mongo-max-pool-size", "MONGO_MAX_POOL_SIZE", "maximum MongoDB connections", uintOption(func(s *Settings) *uint64 { return &s.Mongo.MaxPoolSize })},
+	{"mongo-min-pool-size", "MONGO_MIN_POOL_SIZE", "minimum MongoDB connections", uintOption(func(s *Settings) *uint64 { return &s.Mongo.MinPoolSize })},
+	{"mongo-max-conn-idle-time", "MONGO_MAX_CONN_IDLE_TIME", "maximum idle time of a MongoDB connection", durationOption(func(s *Settings) *Duration { return &s.Mongo.MaxConnIdleTime })},
+	{"mongo-connect-timeout", "MONGO_CONNECT_TIMEOUT", "timeout of a MongoDB connection", durationOption(func(s *Settings) *Duration { return &s.Mongo.ConnectTimeout })},
+	{"mongo-server-selection-timeout", "MONGO_SERVER_SELECTION_TIMEOUT", "timeout of the MongoDB server selection", durationOption(func(s *Settings) *Duration { return &s.Mongo.ServerSelectionTimeout })},
+	{"mongo-socket-timeout", "MONGO_SOCKET_TIMEOUT", "timeout of a MongoDB read or write", durationOption(func(s *Settings) *Duration { return &s.Mongo.SocketTimeout })},
+	{"mongo-connect-retries", "MONGO_CONNECT_RETRIES", "attempts to connect to MongoDB at startup", intOption(func(s *Settings) *int { return &s.Mongo.ConnectRetries })},
+	{"mongo-retry-backoff", "MONGO_RETRY_BACKOFF", "wait after the first failed MongoDB connection, doubled after each one", durationOption(func(s *Settings) *Duration { return &s.Mongo.RetryBackoff })},
+	{"mongo-max-retry-backoff", "MONGO_MAX_RETRY_BACKOFF", "maximum wait between two MongoDB connections", durationOption(func(s *Settings) *Duration { return &s.Mongo.MaxRetryBackoff })},
+	{"retention-reports-max-age", "RETENTION_REPORTS_MAX_AGE", "age after which the reports are downsampled, 0 to keep them", durationOption(func(s *Settings) *Duration { return &s.Retention.ReportsMaxAge })},
+	{"retention-snapshots", "RETENTION_SNAPSHOTS", "snapshots kept of the old reports: none, daily, weekly or monthly", func(s *Settings, value string) error {
+		s.Retention.Snapshots = strings.ToLower(value)
+		return nil
+	}},
+	{"retention-snapshots-max-age", "RETENTION_SNAPSHOTS_MAX_AGE", "age after which the snapshots are removed, 0 to keep them", durationOption(func(s *Settings) *Duration { return &s.Retention.SnapshotsMaxAge })},
+	{"retention-scans-max-age", "RETENTION_SCANS_MAX_AGE", "age after which the scan requests are removed, 0 to keep them", durationOption(func(s *Settings) *Duration { return &s.Retention.ScansMaxAge })},
+	{"retention-raw-reports-max-age", "RETENTION_RAW_REPORTS_MAX_AGE", "age after which the raw SSL Labs reports are removed, 0 to keep them", durationOption(func(s *Settings) *Duration { return &s.Retention.RawReportsMaxAge })},
+	{"retention-archive-dir", "RETENTION_ARCHIVE_DIR", "directory of the archives of the removed reports", stringOption(func(s *Settings) *string { return &s.Retention.ArchiveDir })},
+	{"retention-interval", "RETENTION_INTERVAL", "time between two runs of the retention job", durationOption(func(s *Settings) *Duration { return &s.Retention.Interval })},
+}
+
+/*
+Load reads and validates the settings of the API server. Each source overrides the previous one:
+
+ 1. the defaults (DefaultSettings)
+ 2. the configuration file given with -config or NEBULA_CONFIG, YAML (.yaml, .yml) or TOML (.toml)
+ 3. the environment variables (e.g. PORT, STORAGE_BACKEND, MONGO_URI), including the ones of the .env file
+ 4. the command-line flags (e.g. -port)
+
+params
+
+	name string: The program name, shown in the usage of the flags
+	args []string: The command-line arguments, without the program name
+	output io.Writer: Where the usage is written with -h
+
+returns
+
+	*Settings: pointer with the settings
+	err: flag.ErrHelp with -h, or an error describing every invalid setting
+*/
+func Load(name string, args []string, output io.Writer) (*Settings, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	configPath := flags.String("config", os.Getenv("NEBULA_CONFIG"), "configuration file, YAML or TOML (env NEBULA_CONFIG)")
+	given := map[string]string{}
+	for _, option := range settingOptions {
+		if option.flag == "" {
+			continue
+		}
+		flags.Func(option.flag, fmt.Sprintf("%s (env %s)", option.usage, option.env), func(value string) error {
+			given[option.flag] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	settings := DefaultSettings()
+	if *configPath != "" {
+		if err := settings.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []string
+	apply := func(option settingOption, source string, value string) {
+		if err := option.set(settings, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+		}
+	}
+	for _, option := range settingOptions {
+		if value, set := os.LookupEnv(option.env); set && value != "" {
+			apply(option, option.env, value)
+		}
+	}
+	for _, option := range settingOptions {
+		if value, set := given[option.flag]; set {
+			apply(option, "-"+option.flag, value)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid settings: %s", strings.Join(errs, "; "))
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+/*
+loadFile overrides the settings with the ones of a configuration file, the format is taken from its extension.
+Unknown keys are rejected, so a misspelled setting is not silently ignored
+
+params
+
+	path string: The path of the file
+
+returns
+
+	err: Any error encountered reading or decoding the file
+*/
+func (s *Settings) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the configuration file: %v", err)
+	}
+	switch extension := strings.ToLower(filepath.Ext(path)); extension {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(data, s, yaml.DisallowUnknownField())
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(s)
+	default:
+		return fmt.Errorf("unsupported configuration file %s, allowed extensions: .yaml, .yml, .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	return nil
+}
+
+/*
+Validate checks the values of the settings
+
+returns
+
+	err: An error listing every invalid setting, nil if they are valid
+*/
+func (s *Settings) Validate() error {
+	var errs []string
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if s.Server.Port < 1 || s.Server.Port > 65535 {
+		add("server.port %d must be between 1 and 65535", s.Server.Port)
+	}
+	if s.Server.Address != "" && net.ParseIP(s.Server.Address) == nil && !isHostname(s.Server.Address) {
+		add("server.address %q is not an IP address or a hostname", s.Server.Address)
+	}
+	switch s.Server.GinMode {
+	case "debug", "release", "test":
+	default:
+		add("server.ginMode %q must be debug, release or test", s.Server.GinMode)
+	}
+
+	if s.Scans.Workers < 1 {
+		add("scans.workers %d must be greater than 0", s.Scans.Workers)
+	}
+	if s.Scans.PollInterval < Duration(time.Second) {
+		add("scans.pollInterval %s must be at least 1s", time.Duration(s.Scans.PollInterval))
+	}
+	if s.Scans.Timeout < 0 {
+		add("scans.timeout %s cannot be negative", time.Duration(s.Scans.Timeout))
+	}
+
+	if apiURL, err := url.Parse(s.SSLLabs.APIURL); err != nil || (apiURL.Scheme != "http" && apiURL.Scheme != "https") || apiURL.Host == "" {
+		add("ssllabs.apiURL %q must be an http or https URL", s.SSLLabs.APIURL)
+	}
+	if s.SSLLabs.RequestTimeout <= 0 {
+		add("ssllabs.requestTimeout %s must be greater than 0", time.Duration(s.SSLLabs.RequestTimeout))
+	}
+
+	switch s.Storage.Backend {
+	case StorageMongo, StorageSQLite, StorageMemory:
+	default:
+		add("storage.backend %q must be mongo, sqlite or memory", s.Storage.Backend)
+	}
+	if s.Storage.Backend == StorageSQLite && s.Storage.SQLitePath == "" {
+		add("storage.sqlitePath is required with the sqlite backend")
+	}
+	switch s.Storage.RawReportsStore {
+	case "", RawReportsFilesystem, RawReportsMemory, RawReportsNone:
+	case RawReportsGridFS:
+		if s.Storage.Backend != StorageMongo {
+			add("storage.rawReportsStore gridfs requires the mongo backend")
+		}
+	default:
+		add("storage.rawReportsStore %q must be gridfs, filesystem, memory or none", s.Storage.RawReportsStore)
+	}
+	if s.Storage.RawReportsStore == RawReportsFilesystem && s.Storage.RawReportsDir == "" {
+		add("storage.rawReportsDir is required with the filesystem store")
+	}
+	if s.Storage.RawReportsCompression != "zstd" && s.Storage.RawReportsCompression != "gzip" {
+		add("storage.rawReportsCompression %q must be zstd or gzip", s.Storage.RawReportsCompression)
+	}
+
+	if s.Storage.Backend == StorageMongo {
+		if s.Mongo.URI == "" && (s.Mongo.Host == "" || s.Mongo.Database == "") {
+			add("mongo.uri, or mongo.host and mongo.database, is required with the mongo backend")
+		}
+		if s.Mongo.URI == "" && s.Mongo.Scheme != "mongodb" && s.Mongo.Scheme != "mongodb+srv" {
+			add("mongo.scheme %q must be mongodb or mongodb+srv", s.Mongo.Scheme)
+		}
+		if s.Mongo.URI != "" && !strings.HasPrefix(s.Mongo.URI, "mongodb://") && !strings.HasPrefix(s.Mongo.URI, "mongodb+srv://") {
+			add("mongo.uri must start with mongodb:// or mongodb+srv://")
+		}
+		switch s.Mongo.ServerAPIVersion {
+		case "", "none", "1":
+		default:
+			add("mongo.serverAPIVersion %q must be 1 or none", s.Mongo.ServerAPIVersion)
+		}
+		if s.Mongo.MaxPoolSize > 0 && s.Mongo.MinPoolSize > s.Mongo.MaxPoolSize {
+			add("mongo.minPoolSize %d must not be greater than mongo.maxPoolSize %d", s.Mongo.MinPoolSize, s.Mongo.MaxPoolSize)
+		}
+		if s.Mongo.ConnectRetries < 1 {
+			add("mongo.connectRetries %d must be greater than 0", s.Mongo.ConnectRetries)
+		}
+		mongoDurations := []struct {
+			name  string
+			value Duration
+		}{
+			{"mongo.maxConnIdleTime", s.Mongo.MaxConnIdleTime},
+			{"mongo.connectTimeout", s.Mongo.ConnectTimeout},
+			{"mongo.serverSelectionTimeout", s.Mongo.ServerSelectionTimeout},
+			{"mongo.socketTimeout", s.Mongo.SocketTimeout},
+			{"mongo.retryBackoff", s.Mongo.RetryBackoff},
+			{"mongo.maxRetryBackoff", s.Mongo.MaxRetryBackoff},
+		}
+		for _, duration := range mongoDurations {
+			if duration.value < 0 {
+				add("%s %s cannot be negative", duration.name, time.Duration(duration.value))
+			}
+		}
+	}
+
+	retentionDurations := []struct {
+		name  string
+		value Duration
+	}{
+		{"retention.reportsMaxAge", s.Retention.ReportsMaxAge},
+		{"retention.snapshotsMaxAge", s.Retention.SnapshotsMaxAge},
+		{"retention.scansMaxAge", s.Retention.ScansMaxAge},
+		{"retention.rawReportsMaxAge", s.Retention.RawReportsMaxAge},
+	}
+	for _, duration := range retentionDurations {
+		if duration.value < 0 {
+			add("%s %s cannot be negative", duration.name, time.Duration(duration.value))
+		}
+	}
+	switch s.Retention.Snapshots {
+	case "none", "daily", "weekly", "monthly":
+	default:
+		add("retention.snapshots %q must be none, daily, weekly or monthly", s.Retention.Snapshots)
+	}
+	if s.Retention.Snapshots != "none" && s.Retention.SnapshotsMaxAge > 0 && s.Retention.SnapshotsMaxAge < s.Retention.ReportsMaxAge {
+		add("retention.snapshotsMaxAge must not be shorter than retention.reportsMaxAge")
+	}
+	if s.Retention.Interval <= 0 {
+		add("retention.interval %s must be greater than 0", time.Duration(s.Retention.Interval))
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid settings: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+/*
+ListenAddress returns the host:port the server listens on
+
+returns
+
+	string: the address, e.g. localhost:8080 or :8080 for every interface
+*/
+func (s *ServerSettings) ListenAddress() string {
+	return net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+}
+
+// isHostname checks if an address is a plausible hostname (letters, digits, hyphens and dots)
+func isHostname(address string) bool {
+	for _, label := range strings.Split(address, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Limits applied to every aggregation over domains_info
+const (
+	aggregationMaxTime    = 10 * time.Second // Sent as maxTimeMS, MongoDB aborts the aggregation after it
+	aggregationMaxResults = 1000             // A final $limit is appended to every pipeline
+	aggregationMaxStages  = 20
+	aggregationMaxDepth   = 2 // Nesting of sub-pipelines ($facet)
+)
+
+// Stages a client pipeline can use, all of them read-only and limited to the domains_info collection
+var allowedAggregationStages = map[string]bool{
+	"$match": true, "$project": true, "$addFields": true, "$set": true, "$unset": true,
+	"$group": true, "$sort": true, "$limit": true, "$skip": true, "$count": true,
+	"$unwind": true, "$bucket": true, "$bucketAuto": true, "$facet": true, "$sortByCount": true,
+	"$replaceRoot": true, "$replaceWith": true, "$sample": true,
+}
+
+// Stages rejected with a specific reason, the rest of the stages not allowed are reported as unsupported
+var rejectedAggregationStages = map[string]string{
+	"$out":            "writes to a collection",
+	"$merge":          "writes to a collection",
+	"$lookup":         "reads other collections",
+	"$graphLookup":    "reads other collections",
+	"$unionWith":      "reads other collections",
+	"$collStats":      "exposes server information",
+	"$indexStats":     "exposes server information",
+	"$currentOp":      "exposes server information",
+	"$listSessions":   "exposes server information",
+	"$planCacheStats": "exposes server information",
+}
+
+// Operators rejected anywhere in the pipeline because they run JavaScript on the server
+var rejectedAggregationOperators = map[string]bool{
+	"$where":       true,
+	"$function":    true,
+	"$accumulator": true,
+}
+
+/*
+validatePipeline checks a client pipeline against the stage allowlist and the operator denylist
+Args:
+
+	pipeline []bson.D: The stages of the pipeline
+	depth int: The nesting level, 0 for the top-level pipeline
+
+Returns:
+
+	error: The first forbidden stage or operator found, nil if the pipeline is allowed
+*/
+func validatePipeline(pipeline []bson.D, depth int) error {
+	if depth > aggregationMaxDepth {
+		return fmt.Errorf("sub-pipelines cannot be nested more than %d levels", aggregationMaxDepth)
+	}
+	if len(pipeline) > aggregationMaxStages {
+		return fmt.Errorf("the pipeline has %d stages, the maximum is %d", len(pipeline), aggregationMaxStages)
+	}
+
+	for i, stage := range pipeline {
+		if len(stage) != 1 {
+			return fmt.Errorf("stage %d must have exactly one field, the stage name", i)
+		}
+		name := stage[0].Key
+		if reason, rejected := rejectedAggregationStages[name]; rejected {
+			return fmt.Errorf("stage %d: %s is not allowed, it %s", i, name, reason)
+		}
+		if !allowedAggregationStages[name] {
+			return fmt.Errorf("stage %d: %s is not a supported stage", i, name)
+		}
+
+		if name == "$facet" {
+			facets, ok := stage[0].Value.(bson.D)
+			if !ok {
+				return fmt.Errorf("stage %d: $facet must be a document of sub-pipelines", i)
+			}
+			for _, facet := range facets {
+				subPipeline, err := toPipeline(facet.Value)
+				if err != nil {
+					return fmt.Errorf("stage %d: $facet %s: %v", i, facet.Key, err)
+				}
+				if err := validatePipeline(subPipeline, depth+1); err != nil {
+					return fmt.Errorf("stage %d: $facet %s: %v", i, facet.Key, err)
+				}
+			}
+			continue
+		}
+		if operator := findRejectedOperator(stage[0].Value); operator != "" {
+			return fmt.Errorf("stage %d: the %s operator is not allowed", i, operator)
+		}
+	}
+	return nil
+}
+
+/*
+findRejectedOperator walks a stage value looking for the operators of rejectedAggregationOperators
+Args:
+
+	value any: The value of a stage (or a part of it)
+
+Returns:
+
+	string: The first rejected operator found, empty if there is none
+*/
+func findRejectedOperator(value any) string {
+	switch typed := value.(type) {
+	case bson.D:
+		for _, element := range typed {
+			if rejectedAggregationOperators[element.Key] {
+				return element.Key
+			}
+			if operator := findRejectedOperator(element.Value); operator != "" {
+				return operator
+			}
+		}
+	case bson.M:
+		for key, element := range typed {
+			if rejectedAggregationOperators[key] {
+				return key
+			}
+			if operator := findRejectedOperator(element); operator != "" {
+				return operator
+			}
+		}
+	case bson.A:
+		for _, element := range typed {
+			if operator := findRejectedOperator(element); operator != "" {
+				return operator
+			}
+		}
+	}
+	return ""
+}
+
+/*
+toPipeline converts a decoded array of stages into a pipeline
+Args:
+
+	value any: The decoded value, it must be an array of documents
+
+Returns:
+
+	[]bson.D: The pipeline
+	error: An error if the value is not an array of documents
+*/
+func toPipeline(value any) ([]bson.D, error) {
+	array, ok := value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("must be an array of stages")
+	}
+	pipeline := make([]bson.D, 0, len(array))
+	for i, element := range array {
+		stage, ok := element.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("stage %d must be a document", i)
+		}
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline, nil
+}
+
+/*
+limitPipeline appends the result limit to a validated pipeline
+Args:
+
+	pipeline []bson.D: The pipeline
+
+Returns:
+
+	[]bson.D: The pipeline ending with a $limit of aggregationMaxResults
+*/
+func limitPipeline(pipeline []bson.D) []bson.D {
+	return append(pipeline, bson.D{{Key: "$limit", Value: aggregationMaxResults}})
+}
+
+/*
+Struct created to hold a parameter of a saved aggregation
+*/
+type aggregationParam struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default,omitempty"`
+}
+
+/*
+Struct created to hold a named aggregation over domains_info, its pipeline is built from the query parameters
+*/
+type savedAggregation struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Params      []aggregationParam `json:"params"`
+	build       func(params map[string]string) ([]bson.D, error)
+}
+
+// Saved aggregations callable by name with GET /aggregations/:name
+var savedAggregations = map[string]savedAggregation{
+	"grade-distribution": {
+		Name:        "grade-distribution",
+		Description: "Number of reports per domain grade",
+		Params: []aggregationParam{
+			{Name: "from", Description: "Only reports from this date (RFC 3339 or YYYY-MM-DD)"},
+			{Name: "to", Description: "Only reports until this date (RFC 3339 or YYYY-MM-DD)"},
+		},
+		build: func(params map[string]string) ([]bson.D, error) {
+			dateRange, err := timestampRange(params)
+			if err != nil {
+				return nil, err
+			}
+			match := bson.D{}
+			if len(dateRange) > 0 {
+				match = bson.D{{Key: "timestamp", Value: dateRange}}
+			}
+			return []bson.D{
+				{{Key: "$match", Value: match}},
+				{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$grade"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+				{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "grade", Value: "$_id"}, {Key: "count", Value: 1}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "grade", Value: 1}}}},
+			}, nil
+		},
+	},
+	"expiring-certs": {
+		Name:        "expiring-certs",
+		Description: "Endpoints whose certificate expires within the given days, the closest first",
+		Params: []aggregationParam{
+			{Name: "days", Description: "Expiry window in days", Default: "30"},
+		},
+		build: func(params map[string]string) ([]bson.D, error) {
+			days, err := strconv.ParseFloat(params["days"], 64)
+			if err != nil || days < 0 {
+				return nil, fmt.Errorf("Invalid days %q, it must be a positive number", params["days"])
+			}
+			return []bson.D{
+				{{Key: "$unwind", Value: "$endpoints"}},
+				{{Key: "$match", Value: bson.D{{Key: "endpoints.certificate.expiresInDays", Value: bson.D{{Key: "$lte", Value: days}}}}}},
+				{{Key: "$project", Value: bson.D{
+					{Key: "_id", Value: 0},
+					{Key: "reportId", Value: "$_id"},
+					{Key: "host", Value: 1},
+					{Key: "ipAddress", Value: "$endpoints.ipAddress"},
+					{Key: "issuer", Value: "$endpoints.certificate.issuer"},
+					{Key: "expiresInDays", Value: "$endpoints.certificate.expiresInDays"},
+				}}},
+				{{Key: "$sort", Value: bson.D{{Key: "expiresInDays", Value: 1}}}},
+			}, nil
+		},
+	},
+	"issuers": {
+		Name:        "issuers",
+		Description: "Certificate issuers with the number of endpoints and the hosts that use them",
+		build: func(params map[string]string) ([]bson.D, error) {
+			return []bson.D{
+				{{Key: "$unwind", Value: "$endpoints"}},
+				{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$endpoints.certificate.issuer"},
+					{Key: "endpoints", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "hosts", Value: bson.D{{Key: "$addToSet", Value: "$host"}}},
+				}}},
+				{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "issuer", Value: "$_id"}, {Key: "endpoints", Value: 1}, {Key: "hosts", Value: 1}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "endpoints", Value: -1}}}},
+			}, nil
+		},
+	},
+	"average-score": {
+		Name:        "average-score",
+		Description: "Average domain score per day",
+		Params: []aggregationParam{
+			{Name: "from", Description: "Only reports from this date (RFC 3339 or YYYY-MM-DD)"},
+			{Name: "to", Description: "Only reports until this date (RFC 3339 or YYYY-MM-DD)"},
+		},
+		build: func(params map[string]string) ([]bson.D, error) {
+			dateRange, err := timestampRange(params)
+			if err != nil {
+				return nil, err
+			}
+			// Only the reports stored with a date timestamp can be grouped by day
+			timestamp := append(bson.D{{Key: "$type", Value: "date"}}, dateRange...)
+			return []bson.D{
+				{{Key: "$match", Value: bson.D{{Key: "timestamp", Value: timestamp}}}},
+				{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: "%Y-%m-%d"}, {Key: "date", Value: "$timestamp"}}}}},
+					{Key: "averageScore", Value: bson.D{{Key: "$avg", Value: "$score"}}},
+					{Key: "reports", Value: bson.D{{Key: "$sum", Value: 1}}},
+				}}},
+				{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "day", Value: "$_id"}, {Key: "averageScore", Value: 1}, {Key: "reports", Value: 1}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "day", Value: 1}}}},
+			}, nil
+		},
+	},
+}
+
+/*
+timestampRange builds the $gte/$lte condition of the from/to parameters of a saved aggregation
+Args:
+
+	params map[string]string: The parameters of the aggregation
+
+Returns:
+
+	bson.D: The condition, empty when neither parameter is given
+	error: An error if a date is invalid
+*/
+func timestampRange(params map[string]string) (bson.D, error) {
+	dateRange := bson.D{}
+	for _, param := range []struct {
+		name, operator string
+		upper          bool
+	}{{"from", "$gte", false}, {"to", "$lte", true}} {
+		if params[param.name] == "" {
+			continue
+		}
+		date, err := parseDateParam(params[param.name], param.upper)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %v", param.name, params[param.name], err)
+		}
+		dateRange = append(dateRange, bson.E{Key: param.operator, Value: date})
+	}
+	return dateRange, nil
+}
+
+/*
+savedAggregationList returns the saved aggregations sorted by name
+Returns:
+
+	[]savedAggregation: The saved aggregations
+*/
+func savedAggregationList() []savedAggregation {
+	list := make([]savedAggregation, 0, len(savedAggregations))
+	for _, aggregation := range savedAggregations {
+		list = append(list, aggregation)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+/*
+savedAggregationNames returns the names of the saved aggregations for the error messages
+Returns:
+
+	string: The names separated by commas
+*/
+func savedAggregationNames() string {
+	names := make([]string, 0, len(savedAggregations))
+	for _, aggregation := range savedAggregationList() {
+		names = append(names, aggregation.Name)
+	}
+	return strings.Join(names, ", ")
+}
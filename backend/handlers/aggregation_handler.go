@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+GetSavedAggregations handles the GET request to list the saved aggregations and their parameters
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the saved aggregations
+*/
+func (h *Handler) GetSavedAggregations(c *gin.Context) {
+	c.JSON(http.StatusOK, savedAggregationList())
+}
+
+/*
+RunSavedAggregation handles the GET request to run a saved aggregation by name, its parameters are read
+from the query string (e.g. GET /aggregations/expiring-certs?days=14)
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the aggregation result or an error message
+*/
+func (h *Handler) RunSavedAggregation(c *gin.Context) {
+	name := c.Param("name")
+	aggregation, exists := savedAggregations[name]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Saved aggregation %q not found, available: %s", name, savedAggregationNames())})
+		return
+	}
+
+	params := map[string]string{}
+	for _, param := range aggregation.Params {
+		params[param.Name] = c.DefaultQuery(param.Name, param.Default)
+	}
+	pipeline, err := aggregation.build(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.runAggregation(c, pipeline)
+}
+
+/*
+runAggregation runs a validated pipeline over domains_info with the time and result limits, and sends the response,
+the storage backends other than MongoDB answer 501 Not Implemented
+Args:
+
+	c *gin.Context: The Gin context of the request
+	pipeline []bson.D: The pipeline
+*/
+func (h *Handler) runAggregation(c *gin.Context, pipeline []bson.D) {
+	result, err := h.Domains.Aggregate(context.TODO(), limitPipeline(pipeline), aggregationMaxTime)
+	if errors.Is(err, repository.ErrTimeout) {
+		c.JSON(http.StatusRequestTimeout, gin.H{"error": fmt.Sprintf("The aggregation took longer than %s", aggregationMaxTime)})
+		return
+	}
+	if err != nil {
+		respondRepositoryError(c, err, "Error executing aggregation")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+GetDomainCompliance handles the GET request to evaluate the latest stored report of a host against a
+compliance profile (?profile=mozilla-modern|mozilla-intermediate|nist-800-52r2|pci-dss),
+when no profile is given every built-in profile is evaluated
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the per-requirement pass/fail results or an error message
+*/
+func (h *Handler) GetDomainCompliance(c *gin.Context) {
+	host := c.Param("host")
+	profiles := scripts.ComplianceProfileNames()
+	if profile := c.Query("profile"); profile != "" {
+		if !scripts.IsComplianceProfile(profile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown compliance profile %q, allowed values: %v", profile, profiles)})
+			return
+		}
+		profiles = []string{profile}
+	}
+
+	domainInfo, err := h.Domains.Latest(context.TODO(), host)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No report found for host " + host})
+		return
+	}
+	if err != nil {
+		respondRepositoryError(c, err, "Error obtaining data")
+		return
+	}
+
+	report, err := domainInfo.Report()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stored document is not a valid report: " + fmt.Sprint(err)})
+		return
+	}
+
+	var results []*scripts.ComplianceResult
+	for _, profile := range profiles {
+		result, err := scripts.EvaluateCompliance(report, profile)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 1 {
+		c.JSON(http.StatusOK, results[0])
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
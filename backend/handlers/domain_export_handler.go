@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+ExportDomainsInformation handles the GET request to download the domain reports as a file. The reports are read and
+written one at a time, so the whole collection is never loaded in memory. It takes the same filters and sort of
+GET /domains-info (the page is ignored) and these query parameters:
+
+  - format: csv (default), jsonl or xlsx
+  - rows: host (default) for a row per report, or endpoint for a row per endpoint of each report
+  - columns: comma-separated columns of exportColumns, the defaults depend on the rows
+
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Streams the file, or sends a JSON error message if the request is invalid
+*/
+func (h *Handler) ExportDomainsInformation(c *gin.Context) {
+	lang, err := requestLanguage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, err := parseDomainListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	formatName := c.DefaultQuery("format", "csv")
+	format, ok := exportFormats[formatName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid format %q, allowed values: csv, jsonl, xlsx", formatName)})
+		return
+	}
+
+	rows := c.DefaultQuery("rows", "host")
+	if rows != "host" && rows != "endpoint" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid rows %q, allowed values: host, endpoint", rows)})
+		return
+	}
+	perEndpoint := rows == "endpoint"
+
+	columns, err := selectExportColumns(listParam(c, "columns"), perEndpoint)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	// The headers are sent with the first bytes of the file, until then an error is still answered with JSON
+	writer := format.newWriter(c.Writer)
+	started := false
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		c.Header("Content-Type", format.contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="domains-info-%s.%s"`, time.Now().UTC().Format("20060102T150405Z"), format.extension))
+		c.Status(http.StatusOK)
+		return writer.WriteHeader(names)
+	}
+	writeRow := func(row exportRow) error {
+		values := make([]any, len(columns))
+		for i, column := range columns {
+			values[i] = column.value(row)
+		}
+		return writer.WriteRow(values)
+	}
+
+	err = h.Domains.ForEach(c.Request.Context(), *query, func(record *repository.DomainRecord) error {
+		report, err := record.Report()
+		if err != nil {
+			return fmt.Errorf("reading register %s: %v", record.ID, err)
+		}
+		report = scripts.LocalizeReport(report, lang)
+		if err := start(); err != nil {
+			return err
+		}
+
+		if !perEndpoint || len(report.Endpoints) == 0 { // A host without endpoints still gets a row
+			return writeRow(exportRow{record: record, report: report})
+		}
+		for i := range report.Endpoints {
+			if err := writeRow(exportRow{record: record, report: report, endpoint: &report.Endpoints[i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		if err = start(); err == nil {
+			err = writer.Close()
+		}
+	}
+	if err == nil {
+		return
+	}
+
+	if !c.Writer.Written() { // Nothing was sent yet (the writers buffer the first rows)
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		respondRepositoryError(c, err, "Error exporting data")
+		return
+	}
+	// The status was already sent, the connection is closed without ending the chunked body, so the client sees the
+	// file as incomplete instead of a complete download
+	log.Printf("Export of domains-info interrupted: %v", err)
+	c.Abort()
+	abortConnection(c)
+}
+
+/*
+abortConnection closes the connection of a response already started, without the end of its body. The gin recovery
+middleware swallows the http.ErrAbortHandler panic, and the gin writer refuses to hijack a written response, so the
+connection of the net/http writer under it is hijacked instead
+Args:
+
+	c *gin.Context: The Gin context of the request
+*/
+func abortConnection(c *gin.Context) {
+	var writer http.ResponseWriter = c.Writer
+	if unwrapper, ok := writer.(interface{ Unwrap() http.ResponseWriter }); ok {
+		writer = unwrapper.Unwrap()
+	}
+	conn, _, err := http.NewResponseController(writer).Hijack()
+	if err != nil {
+		log.Printf("The connection of the interrupted export could not be closed: %v", err)
+		return
+	}
+	conn.Close()
+}
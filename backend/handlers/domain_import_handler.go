@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// Limits of POST /domains-info/import
+const (
+	importMaxBodySize = 512 << 20 // Bytes of the whole body, the reports after the limit are not imported
+	importMaxResults  = 1000      // Results listed in the response, the counts include every report
+)
+
+/*
+Struct created to hold the outcome of a report of POST /domains-info/import
+*/
+type importResult struct {
+	Source    string     `json:"source,omitempty"` // Name of the uploaded file, empty for a JSON Lines body
+	Record    int        `json:"record"`           // Position of the report in its source, from 1
+	Status    string     `json:"status"`           // created, skipped (already imported) or failed
+	ID        string     `json:"id,omitempty"`
+	Host      string     `json:"host,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+/*
+Struct created to hold the response of POST /domains-info/import: the counts of every report and the results of the
+first importMaxResults ones
+*/
+type importSummary struct {
+	Total            int            `json:"total"`
+	Created          int            `json:"created"`
+	Skipped          int            `json:"skipped"`
+	Failed           int            `json:"failed"`
+	Results          []importResult `json:"results"`
+	ResultsTruncated bool           `json:"resultsTruncated,omitempty"` // More reports than importMaxResults were imported
+	BodyTooLarge     bool           `json:"-"`                          // The body exceeded importMaxBodySize
+}
+
+/*
+add counts the outcome of a report and lists it while there is room
+Args:
+
+	result importResult: The outcome of the report
+*/
+func (s *importSummary) add(result importResult) {
+	s.Total++
+	switch result.Status {
+	case "created":
+		s.Created++
+	case "skipped":
+		s.Skipped++
+	default:
+		s.Failed++
+	}
+	if len(s.Results) < importMaxResults {
+		s.Results = append(s.Results, result)
+	} else {
+		s.ResultsTruncated = true
+	}
+}
+
+/*
+ImportDomainsInformation handles the POST request to import historic raw SSL Labs reports. The body is either a
+multipart upload, where each file holds a report, a JSON array of reports or JSON Lines, or a JSON Lines stream of
+reports. Each report is filtered with the ?aggregation= strategy and the ?lang= language, keeping its testTime as
+the timestamp, and stored unless a register of the same host and timestamp exists, so an import can be repeated.
+The body is limited to importMaxBodySize bytes, the reports read before the limit are kept and the response is a 413
+
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the counts and the result of each report, or an error message
+*/
+func (h *Handler) ImportDomainsInformation(c *gin.Context) {
+	lang, err := requestLanguage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	options := scripts.FilterOptions{Aggregation: c.DefaultQuery("aggregation", scripts.DefaultAggregation), Language: lang, RequireTestTime: true}
+	if !scripts.IsValidAggregation(options.Aggregation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid aggregation, allowed values: worst, best, majority"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBodySize)
+	summary := &importSummary{Results: []importResult{}}
+	if c.ContentType() == "multipart/form-data" {
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading multipart body: " + fmt.Sprint(err)})
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				summary.BodyTooLarge = true
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading multipart body: " + fmt.Sprint(err)})
+				return
+			}
+			if part.FileName() != "" { // The form fields are ignored
+				h.importSource(ctx, part, part.FileName(), options, summary)
+			}
+			part.Close()
+			if summary.BodyTooLarge {
+				break
+			}
+		}
+	} else {
+		h.importSource(ctx, c.Request.Body, "", options, summary)
+	}
+
+	if summary.BodyTooLarge {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   fmt.Sprintf("The body exceeds the limit of %d MiB, the reports after it were not imported", importMaxBodySize>>20),
+			"summary": summary,
+		})
+		return
+	}
+	if summary.Total == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No reports found, send a multipart upload or a JSON Lines body of raw SSL Labs reports"})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+/*
+importSource imports the reports of a source, read one at a time: a JSON array of reports, or a sequence of reports
+(JSON Lines or a single report). Invalid JSON stops the source, since the next report can not be located, and so
+does reaching the size limit of the body
+Args:
+
+	ctx context.Context: The context of the request
+	r io.Reader: The source
+	source string: The name of the source in the results
+	options scripts.FilterOptions: The options of the filter
+	summary *importSummary: pointer to the summary the results are added to
+*/
+func (h *Handler) importSource(ctx context.Context, r io.Reader, source string, options scripts.FilterOptions, summary *importSummary) {
+	var maxBytesErr *http.MaxBytesError
+	reader := bufio.NewReader(r)
+	first, err := firstNonSpace(reader)
+	if errors.As(err, &maxBytesErr) {
+		summary.BodyTooLarge = true
+		return
+	}
+	if err != nil {
+		if err != io.EOF {
+			summary.add(importResult{Source: source, Record: 1, Status: "failed", Error: "Error reading the source: " + fmt.Sprint(err)})
+		}
+		return
+	}
+
+	decoder := json.NewDecoder(reader)
+	isArray := first == '['
+	if isArray {
+		decoder.Token() // The opening bracket, already checked
+	}
+	for record := 1; ctx.Err() == nil; record++ {
+		if isArray && !decoder.More() {
+			break
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if errors.As(err, &maxBytesErr) {
+			summary.BodyTooLarge = true
+			return
+		} else if err != nil {
+			summary.add(importResult{Source: source, Record: record, Status: "failed", Error: "Invalid JSON, the rest of the source was skipped: " + fmt.Sprint(err)})
+			return
+		}
+		result := h.importReport(ctx, raw, options)
+		result.Source, result.Record = source, record
+		summary.add(result)
+	}
+}
+
+/*
+importReport filters, validates and stores a raw SSL Labs report
+Args:
+
+	ctx context.Context: The context of the request
+	raw []byte: The raw report
+	options scripts.FilterOptions: The options of the filter
+
+Returns:
+
+	importResult: The outcome, without its source and position
+*/
+func (h *Handler) importReport(ctx context.Context, raw []byte, options scripts.FilterOptions) importResult {
+	failed := func(err error) importResult {
+		return importResult{Status: "failed", Host: gjson.GetBytes(raw, "host").String(), Error: err.Error()}
+	}
+	if status := gjson.GetBytes(raw, "status").String(); status != "" && status != "READY" {
+		return failed(fmt.Errorf("the assessment is not complete (status %s)", status))
+	}
+
+	report, err := scripts.FilterSSLReportWithOptions(raw, options)
+	if err != nil {
+		return failed(err)
+	}
+	if err := scripts.ValidateReport(report); err != nil {
+		return failed(err)
+	}
+	result := importResult{Host: report.Host, Timestamp: &report.Timestamp}
+
+	// The check and the insert are not atomic in the store: the lock prevents duplicates between the imports of this
+	// instance, but a register written meanwhile by another instance or by POST /create-domain-info can still be duplicated
+	h.importMu.Lock()
+	defer h.importMu.Unlock()
+	existing, total, err := h.Domains.List(ctx, repository.DomainQuery{Host: report.Host, From: &report.Timestamp, To: &report.Timestamp, Page: 1, Limit: 1})
+	if err != nil {
+		return failed(fmt.Errorf("Error checking duplicates: %v", err))
+	}
+	if total > 0 {
+		result.Status, result.ID = "skipped", existing[0].ID
+		return result
+	}
+
+	if result.ID, err = h.Domains.Insert(ctx, report); err != nil {
+		return failed(fmt.Errorf("Error inserting document: %v", err))
+	}
+	result.Status = "created"
+	return result
+}
+
+/*
+firstNonSpace skips the leading whitespace of a reader and returns the next byte without consuming it
+Args:
+
+	reader *bufio.Reader: The reader
+
+Returns:
+
+	byte: The first byte that is not whitespace
+	error: io.EOF if there is none, or the read error
+*/
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
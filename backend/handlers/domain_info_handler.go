@@ -2,16 +2,20 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 /*
-GetDomainsInformation handles the GET request to retrieve domain information, fetching data from MongoDB
+GetDomainsInformation handles the GET request to retrieve domain information, fetching data from the domain repository.
+The results are paginated and can be filtered and sorted with the query parameters described in parseDomainListQuery
 
 Args:
 
@@ -19,29 +23,44 @@ Args:
 
 Returns:
 
-	None: Sends a JSON response with the list of domain information or an error message
+	None: Sends a JSON response with the page of domain information, the total count and the page metadata, or an error message
 */
 func (h *Handler) GetDomainsInformation(c *gin.Context) { // el parametro es el contexto de Gin dado por un puntero para capturar la peticion del cliente
+	lang, err := requestLanguage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	coll := h.DB.Client.Database(h.DB.DbName).Collection("domains_info")
-
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
+	query, err := parseDomainListQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error obtaining MongoDB data: " + fmt.Sprint(err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var domainsInfo []bson.M                                        // Resultados de la consulta de arriva
-	if err = cursor.All(context.TODO(), &domainsInfo); err != nil { //Referencia a la varuable domainsInfo donde se almacenaran los datos obtenidos
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding MongoDB data: " + fmt.Sprint(err)})
+	records, total, err := h.Domains.List(context.TODO(), *query)
+	if err != nil {
+		respondRepositoryError(c, err, "Error obtaining data")
 		return
 	}
 
-	c.JSON(http.StatusOK, domainsInfo)
+	domainsInfo := make([]map[string]any, len(records)) // An empty page is sent as [] instead of null
+	for i := range records {
+		domainsInfo[i] = localizeRecord(&records[i], lang)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       domainsInfo,
+		"page":       query.Page,
+		"limit":      query.Limit,
+		"total":      total,
+		"totalPages": (total + query.Limit - 1) / query.Limit,
+	})
 }
 
 /*
-	postDomainInformation handles the POST request to add a new domain information register
+	postDomainInformation handles the POST request to add a new domain information register,
+	the body must be a FilteredTLSReport: unknown fields and invalid values are rejected with field-level errors
 Args:
 
 	c *gin.Context: The Gin context for handling the request and response
@@ -52,27 +71,80 @@ Returns:
 */
 
 func (h *Handler) PostDomainInformation(c *gin.Context) {
-	var pipeline interface{}                            //Donde se almacenara la informacion recibida
-	if err := c.ShouldBindJSON(&pipeline); err != nil { //Sirve para descerializar una solicitud POST
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error decoding JSON: " + fmt.Sprint(err)})
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading body: " + fmt.Sprint(err)})
 		return
 	}
-
-	coll := h.DB.Client.Database(h.DB.DbName).Collection("domains_info")
-	result, err := coll.InsertOne(context.TODO(), pipeline)
+	report, err := decodeReportBody(body) //Valida el body contra la estructura FilteredTLSReport
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error inserting document: " + fmt.Sprint(err)})
+		respondReportError(c, err)
 		return
 	}
 
-	insertedID := result.InsertedID
+	insertedID, err := h.Domains.Insert(context.TODO(), report)
+	if err != nil {
+		respondRepositoryError(c, err, "Error inserting document")
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Document inserted successfully", "inserted_id": insertedID})
 
 }
 
 /*
-GetDomainsInformationByID handles the GET request to retrieve domain information by its ID, fetching data from MongoDB
+decodeReportBody decodes and validates the report of a write request, and derives again the values that depend on
+its endpoints (grade, verdicts, scores, findings and summary). The _id and version of a document returned by GET are
+ignored, so it can be sent back after editing it
+Args:
+
+	body []byte: The request body
+
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the report
+	error: The error of scripts.DecodeReport
+*/
+func decodeReportBody(body []byte) (*scripts.FilteredTLSReport, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err == nil {
+		_, hasID := fields["_id"]
+		_, hasVersion := fields["version"]
+		if hasID || hasVersion {
+			delete(fields, "_id")
+			delete(fields, "version")
+			if body, err = json.Marshal(fields); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report, err := scripts.DecodeReport(body)
+	if err != nil {
+		return nil, err
+	}
+	scripts.RecomputeReport(report)
+	return report, nil
+}
+
+/*
+respondReportError sends the 400 response of a domain report that could not be decoded or validated
+Args:
+
+	c *gin.Context: The Gin context of the request
+	err error: The error returned by scripts.DecodeReport or scripts.ValidateReport
+*/
+func respondReportError(c *gin.Context, err error) {
+	var validationErr scripts.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain report", "fields": validationErr})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+/*
+GetDomainsInformationByID handles the GET request to retrieve domain information by its ID
 Args:
 
 	c *gin.Context: The Gin context for handling the request and response
@@ -82,23 +154,23 @@ Returns:
 	None: Sends a JSON response with the domain information or an error message
 */
 func (h *Handler) GetDomainsInformationByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := primitive.ObjectIDFromHex(idStr) //convierte el string a ObjectID (porque asi lo maneja mongo)
-
+	lang, err := requestLanguage(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format: " + fmt.Sprint(err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var domainInfo bson.M //mapa para almacenar el resultado
-
-	coll := h.DB.Client.Database(h.DB.DbName).Collection("domains_info")
-	err = coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&domainInfo)
+	domainInfo, err := h.Domains.Get(context.TODO(), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error obtaining MongoDB data: " + fmt.Sprint(err)})
+		respondRepositoryError(c, err, "Error obtaining data")
 		return
 	}
-	c.JSON(http.StatusOK, domainInfo)
+	c.Header("ETag", versionETag(domainInfo.Version)) // Sent back in If-Match to update the register
+	c.JSON(http.StatusOK, localizeRecord(domainInfo, lang))
 }
 
 /*
@@ -107,7 +179,7 @@ A body example:
 [
 
 	  { "$match": {
-	   "Calification": "A"
+	   "grade": "A"
 	   }
 	   },
 	   {
@@ -119,7 +191,10 @@ A body example:
 
 ]
 
-This instruction returns a list of the domains with calification "A" sorted in descending order.
+This instruction returns a list of the domains with grade "A" sorted in descending order.
+The body is read as MongoDB Extended JSON (e.g. {"$date": "2026-01-01T00:00:00Z"} for dates). Only the read-only
+stages of allowedAggregationStages are accepted ($out, $merge and $lookup are rejected), the aggregation is aborted
+after aggregationMaxTime and returns at most aggregationMaxResults documents.
 
 Args:
 
@@ -131,29 +206,32 @@ Returns:
 */
 func (h *Handler) AggregateDomainInformation(c *gin.Context) {
 
-	var pipeline interface{}                            //Para que pueda contener cualquier tipo de valor
-	if err := c.ShouldBindJSON(&pipeline); err != nil { //Sirve para descerializar una solicitud POST
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error decoding JSON: " + fmt.Sprint(err)})
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading body: " + fmt.Sprint(err)})
 		return
 	}
-	coll := h.DB.Client.Database(h.DB.DbName).Collection("domains_info")
-	cursor, err := coll.Aggregate(context.TODO(), pipeline)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error executing aggregation: " + fmt.Sprint(err)})
+	var wrapper struct { // Extended JSON only decodes documents, so the array is wrapped in one
+		Pipeline bson.A `bson:"pipeline"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(`{"pipeline":`+string(body)+`}`), false, &wrapper); err != nil { //Sirve para descerializar una solicitud POST
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error decoding JSON: the body must be an array of stages: " + fmt.Sprint(err)})
 		return
 	}
-
-	var result []bson.M
-	if err = cursor.All(context.TODO(), &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding aggregation result: " + fmt.Sprint(err)})
+	pipeline, err := toPipeline(wrapper.Pipeline)
+	if err == nil {
+		err = validatePipeline(pipeline, 0)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pipeline: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	h.runAggregation(c, pipeline)
 }
 
 /*
-DeleteDomainById handles the DELETE request to remove a domain information register by its ID from MongoDB
+DeleteDomainById handles the DELETE request to remove a domain information register by its ID
 Args:
 	c *gin.Context: The Gin context for handling the request and response
 Returns:
@@ -161,21 +239,13 @@ Returns:
 */
 
 func (h *Handler) DeleteDomainById(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := primitive.ObjectIDFromHex(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format: " + fmt.Sprint(err)})
+	err := h.Domains.Delete(context.TODO(), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Domain not found"})
 		return
 	}
-	coll := h.DB.Client.Database(h.DB.DbName).Collection("domains_info")
-	result, err := coll.DeleteOne(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting domain: " + fmt.Sprint(err)})
-		return
-	}
-
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Domain not found"})
+		respondRepositoryError(c, err, "Error deleting domain")
 		return
 	}
 
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// Page size of GET /domains-info when ?limit= is not given, and the largest one accepted
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// Highest page number accepted, so the offset of a page (up to 5e9 registers) never overflows
+const maxPage = 10_000_000
+
+/*
+parseDomainListQuery builds the filters, sort and page of GET /domains-info from the query parameters:
+
+  - page, limit: page number (from 1, up to maxPage) and page size (up to maxPageLimit)
+  - host: exact host (case-insensitive)
+  - grade, verdict: one or more comma-separated values
+  - minScore, maxScore: host score range (inclusive)
+  - minExpiresInDays, maxExpiresInDays: days until a certificate of the host expires (any endpoint)
+  - issuer: fragment of the certificate issuer (case-insensitive)
+  - protocol: protocol supported by an endpoint (e.g. "TLS 1.3")
+  - from, to: report timestamp range (RFC 3339 or YYYY-MM-DD)
+  - scanRequestID: the scan request the report was generated from
+  - sort: comma-separated fields of repository.DomainSortFields, prefixed with "-" for descending order
+
+Args:
+
+	c *gin.Context: The Gin context of the request
+
+Returns:
+
+	*repository.DomainQuery: Pointer of the query
+	error: An error if a parameter has an invalid value
+*/
+func parseDomainListQuery(c *gin.Context) (*repository.DomainQuery, error) {
+	query := &repository.DomainQuery{
+		Host:          c.Query("host"),
+		Grades:        listParam(c, "grade"),
+		Verdicts:      listParam(c, "verdict"),
+		Issuer:        c.Query("issuer"),
+		Protocol:      c.Query("protocol"),
+		ScanRequestID: c.Query("scanRequestID"),
+	}
+
+	var err error
+	if query.Page, err = intParam(c, "page", 1, 1, maxPage); err != nil {
+		return nil, err
+	}
+	if query.Limit, err = intParam(c, "limit", defaultPageLimit, 1, maxPageLimit); err != nil {
+		return nil, err
+	}
+
+	query.MinScore, query.MaxScore, err = rangeParams(c, "minScore", "maxScore", func(value string, _ bool) (int, error) {
+		score, err := strconv.Atoi(value)
+		if err != nil || score < 0 || score > 100 {
+			return 0, fmt.Errorf("it must be an integer between 0 and 100")
+		}
+		return score, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query.MinExpiresInDays, query.MaxExpiresInDays, err = rangeParams(c, "minExpiresInDays", "maxExpiresInDays", func(value string, _ bool) (float64, error) {
+		days, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("it must be a number")
+		}
+		return days, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query.From, query.To, err = rangeParams(c, "from", "to", parseDateParam)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range listParam(c, "sort") {
+		name, descending := strings.CutPrefix(field, "-")
+		if !slices.Contains(repository.DomainSortFields, name) {
+			return nil, fmt.Errorf("Invalid sort field %q, allowed values: %s", name, strings.Join(repository.DomainSortFields, ", "))
+		}
+		query.Sort = append(query.Sort, repository.SortField{Field: name, Descending: descending})
+	}
+
+	return query, nil
+}
+
+/*
+intParam reads an integer query parameter
+Args:
+
+	c *gin.Context: The Gin context of the request
+	name string: The parameter name
+	fallback int64: The value when the parameter is not given
+	minValue int64: The lowest accepted value
+	maxValue int64: The highest accepted value, 0 for no limit
+
+Returns:
+
+	int64: The value of the parameter
+	error: An error if the value is not an integer in range
+*/
+func intParam(c *gin.Context, name string, fallback int64, minValue int64, maxValue int64) (int64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number < minValue || (maxValue > 0 && number > maxValue) {
+		if maxValue > 0 {
+			return 0, fmt.Errorf("Invalid %s %q, it must be an integer between %d and %d", name, value, minValue, maxValue)
+		}
+		return 0, fmt.Errorf("Invalid %s %q, it must be an integer greater than or equal to %d", name, value, minValue)
+	}
+	return number, nil
+}
+
+/*
+listParam reads a comma-separated query parameter, the parameter can also be repeated (?grade=A&grade=B)
+Args:
+
+	c *gin.Context: The Gin context of the request
+	name string: The parameter name
+
+Returns:
+
+	[]string: The non-empty values
+*/
+func listParam(c *gin.Context, name string) (values []string) {
+	for _, raw := range c.QueryArray(name) {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+/*
+rangeParams reads the bounds of a range from a pair of query parameters
+Args:
+
+	c *gin.Context: The Gin context of the request
+	minName string: The parameter of the lower bound
+	maxName string: The parameter of the upper bound
+	parse func(string, bool) (T, error): Converts a parameter to the bound type, the bool tells if it is the upper bound
+
+Returns:
+
+	*T: The lower bound, nil when the parameter is not given
+	*T: The upper bound, nil when the parameter is not given
+	error: An error if a parameter has an invalid value
+*/
+func rangeParams[T any](c *gin.Context, minName string, maxName string, parse func(string, bool) (T, error)) (*T, *T, error) {
+	var bounds [2]*T
+	for i, param := range []struct {
+		name  string
+		upper bool
+	}{{minName, false}, {maxName, true}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := parse(value, param.upper)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid %s %q: %v", param.name, value, err)
+		}
+		bounds[i] = &parsed
+	}
+	return bounds[0], bounds[1], nil
+}
+
+/*
+parseDateParam parses a date parameter written in RFC 3339 or as a day (YYYY-MM-DD, UTC)
+Args:
+
+	value string: The parameter value
+	endOfDay bool: If true a day is converted to its last instant, so the upper bound includes the whole day
+
+Returns:
+
+	time.Time: The date
+	error: An error if the value has none of the formats
+*/
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("it must be an RFC 3339 date or YYYY-MM-DD")
+	}
+	if endOfDay {
+		date = date.Add(24*time.Hour - time.Nanosecond)
+	}
+	return date, nil
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
+
+// Attempts of an upsert by host when another request updates the same host at the same time
+const upsertByHostAttempts = 3
+
+/*
+PutDomainInformation handles the PUT request to replace a domain information register, the body must be a
+complete FilteredTLSReport and the If-Match header the version (ETag) of the register being replaced
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the new version or an error message
+*/
+func (h *Handler) PutDomainInformation(c *gin.Context) {
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading body: " + fmt.Sprint(err)})
+		return
+	}
+	report, err := decodeReportBody(body)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+
+	h.replaceDomainDocument(c, c.Param("id"), version, report)
+}
+
+/*
+PatchDomainInformation handles the PATCH request to partially update a domain information register.
+The body is a JSON merge patch (RFC 7396): the given fields replace the stored ones and null removes them,
+the result must still be a valid FilteredTLSReport, and the values derived from the endpoints are computed again. The If-Match header is optional, without it the update
+only fails if the register changes between reading and writing it
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the new version or an error message
+*/
+func (h *Handler) PatchDomainInformation(c *gin.Context) {
+	id := c.Param("id")
+	var patch map[string]any
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error decoding JSON: the body must be an object: " + fmt.Sprint(err)})
+		return
+	}
+
+	stored, err := h.Domains.Get(context.TODO(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Domain not found"})
+		return
+	}
+	if err != nil {
+		respondRepositoryError(c, err, "Error obtaining data")
+		return
+	}
+	version := stored.Version
+	if c.GetHeader("If-Match") != "" {
+		expected, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+		if expected >= 0 && expected != version {
+			c.Header("ETag", versionETag(version))
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "The domain information was modified, current version: " + strconv.FormatInt(version, 10)})
+			return
+		}
+	}
+
+	current, err := stored.Report()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stored document is not a valid report: " + fmt.Sprint(err)})
+		return
+	}
+	delete(patch, "_id") // Not part of the report, a patch built from a GET response may carry them
+	delete(patch, "version")
+	merged, err := mergePatch(current, patch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying the patch: " + fmt.Sprint(err)})
+		return
+	}
+	report, err := decodeReportBody(merged)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+
+	h.replaceDomainDocument(c, id, version, report)
+}
+
+/*
+PutDomainReportByHost handles the PUT request that keeps the latest report of a host current: it replaces the
+most recent register of the host or creates it if the host has none. The host of the body must match :host
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the ID and version of the register or an error message
+*/
+func (h *Handler) PutDomainReportByHost(c *gin.Context) {
+	host := c.Param("host")
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading body: " + fmt.Sprint(err)})
+		return
+	}
+	report, err := decodeReportBody(body)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	if !strings.EqualFold(report.Host, host) {
+		respondReportError(c, scripts.ValidationError{{Field: "host", Message: fmt.Sprintf("must match the host of the URL %q", host)}})
+		return
+	}
+
+	// The latest register is read and then replaced only if its version did not change, otherwise it is read again
+	for range upsertByHostAttempts {
+		stored, err := h.Domains.Latest(context.TODO(), report.Host)
+		if errors.Is(err, repository.ErrNotFound) {
+			var insertedID string
+			insertedID, stored, err = h.insertFirstReport(context.TODO(), report)
+			if err != nil {
+				respondRepositoryError(c, err, "Error inserting document")
+				return
+			}
+			if stored == nil {
+				c.Header("ETag", versionETag(1))
+				c.JSON(http.StatusCreated, gin.H{"message": "Document inserted successfully", "inserted_id": insertedID, "version": 1})
+				return
+			}
+		}
+		if err != nil {
+			respondRepositoryError(c, err, "Error obtaining data")
+			return
+		}
+
+		version, err := h.Domains.Replace(context.TODO(), stored.ID, stored.Version, report)
+		var conflict *repository.VersionConflictError
+		if errors.As(err, &conflict) || errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			respondRepositoryError(c, err, "Error updating document")
+			return
+		}
+		c.Header("ETag", versionETag(version))
+		c.JSON(http.StatusOK, gin.H{"message": "Domain info successfully updated", "id": stored.ID, "version": version})
+		return
+	}
+
+	c.JSON(http.StatusConflict, gin.H{"error": "The latest report of " + host + " is being updated by another request, try again"})
+}
+
+/*
+insertFirstReport inserts the first register of a host for PutDomainReportByHost. The lookup is repeated under
+hostCreateMu so that concurrent first PUTs of the same host create a single register: the first one inserts it and
+the others get it back to replace it. The store does not enforce one register per host, so a register created
+meanwhile by another instance or by POST /create-domain-info is not detected
+Args:
+
+	ctx context.Context: The context of the operation
+	report *scripts.FilteredTLSReport: The validated report
+
+Returns:
+
+	string: The ID of the inserted register, empty when the host already had one
+	*repository.DomainRecord: The latest register of the host when another request created it first, nil otherwise
+	error: An error if the lookup or the insert fails
+*/
+func (h *Handler) insertFirstReport(ctx context.Context, report *scripts.FilteredTLSReport) (string, *repository.DomainRecord, error) {
+	h.hostCreateMu.Lock()
+	defer h.hostCreateMu.Unlock()
+	stored, err := h.Domains.Latest(ctx, report.Host)
+	if err == nil {
+		return "", stored, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return "", nil, err
+	}
+	insertedID, err := h.Domains.Insert(ctx, report)
+	return insertedID, nil, err
+}
+
+/*
+replaceDomainDocument replaces a register only if it still has the expected version, and sends the response
+Args:
+
+	c *gin.Context: The Gin context of the request
+	id string: The ID of the register
+	version int64: The expected version, -1 to replace any version (If-Match: *)
+	report *scripts.FilteredTLSReport: The validated report
+*/
+func (h *Handler) replaceDomainDocument(c *gin.Context, id string, version int64, report *scripts.FilteredTLSReport) {
+	version, err := h.Domains.Replace(context.TODO(), id, version, report)
+	var conflict *repository.VersionConflictError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": "Domain not found"})
+		return
+	case errors.As(err, &conflict):
+		c.Header("ETag", versionETag(conflict.Current))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "The domain information was modified, current version: " + strconv.FormatInt(conflict.Current, 10)})
+		return
+	case err != nil:
+		respondRepositoryError(c, err, "Error updating document")
+		return
+	}
+
+	c.Header("ETag", versionETag(version))
+	c.JSON(http.StatusOK, gin.H{"message": "Domain info successfully updated", "id": id, "version": version})
+}
+
+/*
+ifMatchVersion reads the version of the If-Match header, sending the error response when it is missing or invalid
+Args:
+
+	c *gin.Context: The Gin context of the request
+
+Returns:
+
+	int64: The version, -1 for If-Match: *
+	bool: False if the error response was sent
+*/
+func ifMatchVersion(c *gin.Context) (int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "The If-Match header with the version (ETag) of the domain information is required"})
+		return 0, false
+	}
+	if header == "*" {
+		return -1, true
+	}
+
+	value := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid If-Match header %q, it must be the ETag of the domain information", header)})
+		return 0, false
+	}
+	return version, true
+}
+
+/*
+versionETag formats a version as an ETag header value
+Args:
+
+	version int64: The version
+
+Returns:
+
+	string: The quoted version
+*/
+func versionETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+/*
+mergePatch applies a JSON merge patch (RFC 7396) to a report
+Args:
+
+	report *scripts.FilteredTLSReport: The current report
+	patch map[string]any: The patch, null values remove the field
+
+Returns:
+
+	[]byte: The patched report in JSON
+	error: Any error encountered during the process
+*/
+func mergePatch(report *scripts.FilteredTLSReport, patch map[string]any) ([]byte, error) {
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]any
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeObjects(target, patch))
+}
+
+/*
+mergeObjects merges a patch object into a target object, recursively for the nested objects
+Args:
+
+	target map[string]any: The object being patched (modified in place)
+	patch map[string]any: The patch
+
+Returns:
+
+	map[string]any: The patched object
+*/
+func mergeObjects(target map[string]any, patch map[string]any) map[string]any {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		patchObject, isObject := value.(map[string]any)
+		if !isObject {
+			target[key] = value
+			continue
+		}
+		targetObject, targetIsObject := target[key].(map[string]any)
+		if !targetIsObject {
+			targetObject = map[string]any{}
+		}
+		target[key] = mergeObjects(targetObject, patchObject)
+	}
+	return target
+}
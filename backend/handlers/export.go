@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+)
+
+/*
+Struct created to hold a row of an export: a report, and one of its endpoints when there is a row per endpoint
+*/
+type exportRow struct {
+	record   *repository.DomainRecord
+	report   *scripts.FilteredTLSReport
+	endpoint *scripts.FilteredEndpoint
+}
+
+/*
+Struct created to hold a column of an export. The endpoint columns are only available with a row per endpoint
+*/
+type exportColumn struct {
+	name     string
+	endpoint bool
+	value    func(row exportRow) any
+}
+
+// Columns of GET /domains-info/export, in the order they are listed in the errors
+var exportColumns = []exportColumn{
+	{name: "id", value: func(row exportRow) any { return row.record.ID }},
+	{name: "version", value: func(row exportRow) any { return row.record.Version }},
+	{name: "host", value: func(row exportRow) any { return row.report.Host }},
+	{name: "timestamp", value: func(row exportRow) any { return row.report.Timestamp }},
+	{name: "grade", value: func(row exportRow) any { return row.report.Grade }},
+	{name: "score", value: func(row exportRow) any { return row.report.Score }},
+	{name: "verdict", value: func(row exportRow) any { return row.report.Verdict }},
+	{name: "verdictText", value: func(row exportRow) any { return row.report.VerdictText }},
+	{name: "webProtocol", value: func(row exportRow) any { return row.report.WebProtocol }},
+	{name: "endpoints", value: func(row exportRow) any { return len(row.report.Endpoints) }},
+	{name: "minExpiresInDays", value: func(row exportRow) any {
+		var days any
+		for _, endpoint := range row.report.Endpoints {
+			if endpoint.Certificate != nil && (days == nil || endpoint.Certificate.ExpiresInDays < days.(float64)) {
+				days = endpoint.Certificate.ExpiresInDays
+			}
+		}
+		return days
+	}},
+	{name: "summary", value: func(row exportRow) any { return row.report.Summary }},
+	{name: "startTime", value: scanValue(func(s *scripts.ScanMetadata) any {
+		if s.StartTime == nil {
+			return nil
+		}
+		return *s.StartTime
+	})},
+	{name: "durationSeconds", value: scanValue(func(s *scripts.ScanMetadata) any { return s.DurationSeconds })},
+	{name: "engineVersion", value: scanValue(func(s *scripts.ScanMetadata) any { return s.EngineVersion })},
+	{name: "criteriaVersion", value: scanValue(func(s *scripts.ScanMetadata) any { return s.CriteriaVersion })},
+	{name: "fromCache", value: scanValue(func(s *scripts.ScanMetadata) any { return s.FromCache })},
+	{name: "scanRequestID", value: scanValue(func(s *scripts.ScanMetadata) any { return s.ScanRequestID })},
+
+	{name: "ipAddress", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.IPAddress })},
+	{name: "endpointGrade", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.Grade })},
+	{name: "endpointScore", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.Score })},
+	{name: "endpointVerdict", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.Verdict })},
+	{name: "protocols", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.Protocols })},
+	{name: "hasWeakCiphers", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.HasWeakCiphers })},
+	{name: "hstsStatus", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any {
+		if e.HSTS == nil {
+			return nil
+		}
+		return e.HSTS.Status
+	})},
+	{name: "server", endpoint: true, value: endpointValue(func(e *scripts.FilteredEndpoint) any { return e.Server })},
+	{name: "certificateSubject", endpoint: true, value: certificateValue(func(c *scripts.FilteredCertificate) any { return c.Subject })},
+	{name: "certificateIssuer", endpoint: true, value: certificateValue(func(c *scripts.FilteredCertificate) any { return c.Issuer })},
+	{name: "certificateExpiresInDays", endpoint: true, value: certificateValue(func(c *scripts.FilteredCertificate) any { return c.ExpiresInDays })},
+	{name: "keyAlgorithm", endpoint: true, value: certificateValue(func(c *scripts.FilteredCertificate) any { return c.KeyAlgorithm })},
+	{name: "keySize", endpoint: true, value: certificateValue(func(c *scripts.FilteredCertificate) any { return c.KeySize })},
+	{name: "signatureAlgorithm", endpoint: true, value: certificateValue(func(c *scripts.FilteredCertificate) any { return c.SignatureAlgorithm })},
+}
+
+// Columns exported when ?columns= is not given
+var (
+	defaultHostColumns     = []string{"host", "timestamp", "grade", "score", "verdict", "endpoints", "minExpiresInDays"}
+	defaultEndpointColumns = []string{"host", "timestamp", "ipAddress", "endpointGrade", "endpointScore", "protocols", "certificateIssuer", "certificateExpiresInDays"}
+)
+
+// scanValue adapts a field of the assessment details to an export column, the value is empty for a report without them
+func scanValue(field func(*scripts.ScanMetadata) any) func(row exportRow) any {
+	return func(row exportRow) any {
+		if row.report.Scan == nil {
+			return nil
+		}
+		return field(row.report.Scan)
+	}
+}
+
+// endpointValue adapts a field of an endpoint to an export column, the value is empty for a host without endpoints
+func endpointValue(field func(*scripts.FilteredEndpoint) any) func(row exportRow) any {
+	return func(row exportRow) any {
+		if row.endpoint == nil {
+			return nil
+		}
+		return field(row.endpoint)
+	}
+}
+
+// certificateValue adapts a field of the endpoint certificate to an export column, the value is empty without certificate
+func certificateValue(field func(*scripts.FilteredCertificate) any) func(row exportRow) any {
+	return endpointValue(func(endpoint *scripts.FilteredEndpoint) any {
+		if endpoint.Certificate == nil {
+			return nil
+		}
+		return field(endpoint.Certificate)
+	})
+}
+
+/*
+selectExportColumns resolves the columns of an export
+Args:
+
+	names []string: The requested column names, the defaults of the row type when empty
+	perEndpoint bool: If true there is a row per endpoint, otherwise a row per host
+
+Returns:
+
+	[]exportColumn: The columns in the requested order
+	error: An error if a column does not exist or needs a row per endpoint
+*/
+func selectExportColumns(names []string, perEndpoint bool) ([]exportColumn, error) {
+	if len(names) == 0 {
+		names = defaultHostColumns
+		if perEndpoint {
+			names = defaultEndpointColumns
+		}
+	}
+
+	columns := make([]exportColumn, 0, len(names))
+	for _, name := range names {
+		index := -1
+		for i, column := range exportColumns {
+			if column.name == name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			available := make([]string, len(exportColumns))
+			for i, column := range exportColumns {
+				available[i] = column.name
+			}
+			return nil, fmt.Errorf("Invalid column %q, allowed values: %s", name, strings.Join(available, ", "))
+		}
+		if exportColumns[index].endpoint && !perEndpoint {
+			return nil, fmt.Errorf("The column %q needs a row per endpoint (?rows=endpoint)", name)
+		}
+		columns = append(columns, exportColumns[index])
+	}
+	return columns, nil
+}
+
+/*
+exportWriter writes the rows of an export in a file format
+*/
+type exportWriter interface {
+	// WriteHeader writes the column names, it is called once before the rows
+	WriteHeader(columns []string) error
+	// WriteRow writes the values of a row, in the order of the columns
+	WriteRow(values []any) error
+	// Close writes the end of the file, it does not close the underlying writer
+	Close() error
+}
+
+/*
+Struct created to hold a file format of GET /domains-info/export
+*/
+type exportFormat struct {
+	contentType string
+	extension   string
+	newWriter   func(w io.Writer) exportWriter
+}
+
+// Formats of GET /domains-info/export by their ?format= value
+var exportFormats = map[string]exportFormat{
+	"csv": {
+		contentType: "text/csv; charset=utf-8",
+		extension:   "csv",
+		newWriter:   func(w io.Writer) exportWriter { return &csvExportWriter{csv: csv.NewWriter(w)} },
+	},
+	"jsonl": {
+		contentType: "application/x-ndjson",
+		extension:   "jsonl",
+		newWriter:   func(w io.Writer) exportWriter { return &jsonlExportWriter{out: bufio.NewWriter(w)} },
+	},
+	"xlsx": {
+		contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		extension:   "xlsx",
+		newWriter:   func(w io.Writer) exportWriter { return &xlsxExportWriter{zip: zip.NewWriter(w)} },
+	},
+}
+
+/*
+formatCell converts an exported value to text: times in RFC 3339, lists separated by commas and nothing for a missing
+value. The texts are neutralized with neutralizeFormula, so a value of the report (e.g. the server banner) is not run
+as a formula when the file is opened in a spreadsheet
+Args:
+
+	value any: The value
+
+Returns:
+
+	string: The text of the value
+*/
+func formatCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case []string:
+		return neutralizeFormula(strings.Join(v, ", "))
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64, bool:
+		return fmt.Sprint(v)
+	default:
+		return neutralizeFormula(fmt.Sprint(v))
+	}
+}
+
+/*
+neutralizeFormula prefixes with a quote the texts that a spreadsheet reads as a formula: the ones starting with =, +,
+-, @, a tab or a carriage return (CSV/formula injection)
+Args:
+
+	text string: The text of a cell
+
+Returns:
+
+	string: The text, prefixed with ' if it could be a formula
+*/
+func neutralizeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+/*
+Struct created to hold a CSV export: a header line and a line per row
+*/
+type csvExportWriter struct {
+	csv *csv.Writer
+}
+
+func (w *csvExportWriter) WriteHeader(columns []string) error {
+	return w.csv.Write(columns)
+}
+
+func (w *csvExportWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatCell(value)
+	}
+	return w.csv.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+/*
+Struct created to hold a JSON Lines export: a JSON object per row with the columns in the requested order
+*/
+type jsonlExportWriter struct {
+	out     *bufio.Writer
+	columns [][]byte
+}
+
+func (w *jsonlExportWriter) WriteHeader(columns []string) error {
+	w.columns = make([][]byte, len(columns))
+	for i, column := range columns {
+		w.columns[i], _ = json.Marshal(column)
+	}
+	return nil
+}
+
+func (w *jsonlExportWriter) WriteRow(values []any) error {
+	w.out.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			w.out.WriteByte(',')
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		w.out.Write(w.columns[i])
+		w.out.WriteByte(':')
+		w.out.Write(raw)
+	}
+	w.out.WriteString("}\n")
+	return nil
+}
+
+func (w *jsonlExportWriter) Close() error {
+	return w.out.Flush()
+}
+
+/*
+Struct created to hold an Excel (Office Open XML) export. The workbook has a single sheet written row by row
+inside the zip file, the strings are inline so no shared strings table has to be kept in memory
+*/
+type xlsxExportWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+// Fixed parts of the workbook, the sheet is written by xlsxExportWriter
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="domains-info" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+func (w *xlsxExportWriter) WriteHeader(columns []string) error {
+	for _, part := range xlsxParts {
+		file, err := w.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := w.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(sheet)
+	w.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		values[i] = column
+	}
+	return w.WriteRow(values)
+}
+
+func (w *xlsxExportWriter) WriteRow(values []any) error {
+	w.rows++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		cell := xlsxColumnName(i) + strconv.Itoa(w.rows)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int, int64, float64:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>%s</v></c>`, cell, formatCell(v))
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(w.sheet, `<c r="%s" t="b"><v>%d</v></c>`, cell, b)
+		default: // Texts, neutralized by formatCell like in the CSV export
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, cell)
+			if err := xml.EscapeText(w.sheet, []byte(formatCell(v))); err != nil {
+				return err
+			}
+			w.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (w *xlsxExportWriter) Close() error {
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+/*
+xlsxColumnName returns the letters of a spreadsheet column
+Args:
+
+	index int: The column index, from 0
+
+Returns:
+
+	string: The column name (A, B, ..., Z, AA, ...)
+*/
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
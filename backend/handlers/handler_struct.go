@@ -1,27 +1,33 @@
 package handlers
 
 import (
-	"github.com/Nebula-Challenge/config"
-	"github.com/Nebula-Challenge/scripts"
+	"errors"
+	"fmt"
+	"net/http"
 	"sync"
-)
+	"time"
 
-// Struct to hold scan request status and result
-type ScanRequest struct {
-	Status         string                     `json:"status"`
-	Result         []byte                     `json:"result"` // Store the TLS assessment result
-	FilteredResult *scripts.FilteredTLSReport `json:"filteredResult"`
-	Error          string                     `json:"error"`
-}
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
 
 /*
-Handler struct to hold the MongoDB client instance
+Handler struct to hold the repositories the handlers read and write through, so the API does not depend on
+a specific storage backend
 */
 type Handler struct {
-	DB           *config.DatabaseConfig  // The MongoDB Instance
-	mu           sync.Mutex              // Mutex to protect access to scanRequests map
-	scanRequests map[string]*ScanRequest // Map to store scan requests and their statuses
+	Domains     repository.DomainRepository    // Filtered domain reports
+	Policies    repository.PolicyRepository    // Verdict policies
+	Scans       repository.ScanRepository      // Scan requests and their statuses
+	RawReports  repository.RawReportRepository // Raw SSL Labs reports of the scans, nil when they are not kept
+	CAAResolver scripts.CAAResolver            // Resolver used to look up the DNS CAA records of scanned hosts
 
+	scanSlots    chan struct{} // A slot per assessment that can run at the same time
+	pollInterval time.Duration
+	scanTimeout  time.Duration
+	importMu     sync.Mutex // Serializes the duplicate check and the insert of the imported reports
+	hostCreateMu sync.Mutex // Serializes the first insert of a host by PUT /domains/:host/report
 }
 
 /*
@@ -29,15 +35,56 @@ NewHandler is used to create an instance of the handler Struct
 
 params
 
-	db *config.DatabaseConfig: pointer to the MongoDB configuration struct
+	repos *repository.Repositories: pointer to the repositories of the storage backend (MongoDB, SQLite or memory)
 
 return
 
 	*Handler: pointer to a new Hanlder instance
 */
-func NewHandler(db *config.DatabaseConfig) *Handler {
+func NewHandler(repos *repository.Repositories) *Handler {
 	return &Handler{
-		DB:           db,
-		scanRequests: make(map[string]*ScanRequest),
+		Domains:      repos.Domains,
+		Policies:     repos.Policies,
+		Scans:        repos.Scans,
+		RawReports:   repos.RawReports,
+		CAAResolver:  scripts.NewDNSResolver(),
+		scanSlots:    make(chan struct{}, 4),
+		pollInterval: 10 * time.Second,
+		scanTimeout:  30 * time.Minute,
+	}
+}
+
+/*
+ConfigureScans sets how the scans of /start-scan are run, it must be called before serving requests
+
+params
+
+	workers int: Assessments run at the same time, the scans started beyond them wait for a free one
+	pollInterval time.Duration: Wait between two polls of an assessment
+	timeout time.Duration: Maximum duration of an assessment, 0 for no limit
+*/
+func (h *Handler) ConfigureScans(workers int, pollInterval time.Duration, timeout time.Duration) {
+	h.scanSlots = make(chan struct{}, workers)
+	h.pollInterval = pollInterval
+	h.scanTimeout = timeout
+}
+
+/*
+respondRepositoryError sends the response of a repository error: 400 for an invalid ID, 501 for an operation the
+storage backend does not support and 500 for the rest
+Args:
+
+	c *gin.Context: The Gin context of the request
+	err error: The error returned by the repository
+	message string: The prefix of the 500 error message (e.g. "Error obtaining data")
+*/
+func respondRepositoryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format: " + fmt.Sprint(err)})
+	case errors.Is(err, repository.ErrUnsupported):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": fmt.Sprint(err)})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message + ": " + fmt.Sprint(err)})
 	}
 }
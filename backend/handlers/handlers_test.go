@@ -0,0 +1,576 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nebula-Challenge/handlers"
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/routes"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+newTestRouter creates the API router on top of the in-memory repositories
+Args:
+
+	t *testing.T: The test
+
+Returns:
+
+	*gin.Engine: The router with every route
+	*repository.Repositories: The repositories used by the handlers
+*/
+func newTestRouter(t *testing.T) (*gin.Engine, *repository.Repositories) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemoryRepositories()
+	handler := handlers.NewHandler(repos)
+	handler.CAAResolver = scripts.StaticCAAResolver{} // No DNS queries from the tests
+	router := gin.New()
+	routes.SetupRoutes(router, handler)
+	return router, repos
+}
+
+/*
+serve sends a request to the router and returns the recorded response
+Args:
+
+	router *gin.Engine: The router
+	method string: The HTTP method
+	path string: The path with its query
+	body string: The JSON body, empty for none
+	headers ...string: Pairs of header names and values
+
+Returns:
+
+	*httptest.ResponseRecorder: The response
+*/
+func serve(router *gin.Engine, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+/*
+decodeBody decodes a JSON response, failing the test if it is not valid JSON
+*/
+func decodeBody[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var body T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", recorder.Body.String(), err)
+	}
+	return body
+}
+
+/*
+testReport builds a stored report with one endpoint
+*/
+func testReport(host, grade, verdict string, score int, protocols ...string) *scripts.FilteredTLSReport {
+	return &scripts.FilteredTLSReport{
+		Host:        host,
+		Grade:       grade,
+		Verdict:     verdict,
+		Score:       score,
+		Aggregation: scripts.DefaultAggregation,
+		Language:    "es",
+		Timestamp:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Endpoints: []scripts.FilteredEndpoint{{
+			IPAddress: "192.0.2.1",
+			Grade:     grade,
+			Verdict:   verdict,
+			Score:     score,
+			Protocols: protocols,
+		}},
+	}
+}
+
+/*
+insertReports stores the reports and returns their IDs by host
+*/
+func insertReports(t *testing.T, repos *repository.Repositories, reports ...*scripts.FilteredTLSReport) map[string]string {
+	t.Helper()
+	ids := map[string]string{}
+	for _, report := range reports {
+		id, err := repos.Domains.Insert(context.Background(), report)
+		if err != nil {
+			t.Fatalf("inserting %s: %v", report.Host, err)
+		}
+		ids[report.Host] = id
+	}
+	return ids
+}
+
+type listResponse struct {
+	Data []struct {
+		Host string `json:"host"`
+	} `json:"data"`
+	Page       int64 `json:"page"`
+	Limit      int64 `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int64 `json:"totalPages"`
+}
+
+func TestGetDomainsInformation(t *testing.T) {
+	router, repos := newTestRouter(t)
+	insertReports(t, repos,
+		testReport("c.example", "B", "ACCEPTABLE", 70, "TLS 1.2"),
+		testReport("a.example", "A+", "EXCELLENT", 95, "TLS 1.3"),
+		testReport("e.example", "C", "POOR", 50, "TLS 1.0", "TLS 1.2"),
+		testReport("b.example", "A", "GOOD", 85, "TLS 1.2", "TLS 1.3"),
+		testReport("d.example", "F", "VERY_POOR", 10, "TLS 1.0"),
+	)
+
+	tests := []struct {
+		name       string
+		query      string
+		hosts      []string
+		total      int64
+		totalPages int64
+	}{
+		{"sorted by host", "?sort=host", []string{"a.example", "b.example", "c.example", "d.example", "e.example"}, 5, 1},
+		{"exact host ignoring case", "?host=B.EXAMPLE", []string{"b.example"}, 1, 1},
+		{"grades", "?grade=A,A%2B&sort=host", []string{"a.example", "b.example"}, 2, 1},
+		{"verdict", "?verdict=POOR,VERY_POOR&sort=host", []string{"d.example", "e.example"}, 2, 1},
+		{"score range", "?minScore=50&maxScore=85&sort=-score", []string{"b.example", "c.example", "e.example"}, 3, 1},
+		{"protocol", "?protocol=TLS%201.0&sort=host", []string{"d.example", "e.example"}, 2, 1},
+		{"grade by rank", "?sort=grade", []string{"d.example", "e.example", "c.example", "b.example", "a.example"}, 5, 1},
+		{"verdict by rank descending", "?sort=-verdict", []string{"a.example", "b.example", "c.example", "e.example", "d.example"}, 5, 1},
+		{"second page", "?sort=host&page=2&limit=2", []string{"c.example", "d.example"}, 5, 3},
+		{"last page", "?sort=host&page=3&limit=2", []string{"e.example"}, 5, 3},
+		{"page after the last one", "?sort=host&page=4&limit=2", []string{}, 5, 3},
+		{"highest page", "?page=10000000&limit=500", []string{}, 5, 1},
+		{"no match", "?grade=T", []string{}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, http.MethodGet, "/domains-info"+test.query, "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body.String())
+			}
+			body := decodeBody[listResponse](t, recorder)
+			hosts := []string{}
+			for _, record := range body.Data {
+				hosts = append(hosts, record.Host)
+			}
+			if !slices.Equal(hosts, test.hosts) {
+				t.Errorf("hosts = %v, want %v", hosts, test.hosts)
+			}
+			if body.Total != test.total || body.TotalPages != test.totalPages {
+				t.Errorf("total = %d, totalPages = %d, want %d and %d", body.Total, body.TotalPages, test.total, test.totalPages)
+			}
+		})
+	}
+}
+
+func TestGetDomainsInformationInvalidQuery(t *testing.T) {
+	router, _ := newTestRouter(t)
+	for _, query := range []string{
+		"?page=0",
+		"?page=10000001",
+		"?page=9223372036854775807&limit=500",
+		"?limit=501",
+		"?sort=unknown",
+		"?minScore=abc",
+		"?from=yesterday",
+		"?lang=fr",
+	} {
+		t.Run(query, func(t *testing.T) {
+			recorder := serve(router, http.MethodGet, "/domains-info"+query, "")
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestPutDomainInformationIfMatch(t *testing.T) {
+	router, repos := newTestRouter(t)
+	id := insertReports(t, repos, testReport("a.example", "A", "GOOD", 85, "TLS 1.2"))["a.example"]
+	path := "/domains-info/" + id
+
+	get := serve(router, http.MethodGet, path, "")
+	if get.Code != http.StatusOK || get.Header().Get("ETag") != `"1"` {
+		t.Fatalf("GET status = %d, ETag = %s", get.Code, get.Header().Get("ETag"))
+	}
+	document := get.Body.String() // The document returned by GET can be sent back
+
+	steps := []struct {
+		name    string
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{"without If-Match", "", http.StatusPreconditionRequired, ""},
+		{"invalid If-Match", "abc", http.StatusBadRequest, ""},
+		{"current version", `"1"`, http.StatusOK, `"2"`},
+		{"stale version", `"1"`, http.StatusPreconditionFailed, `"2"`},
+		{"weak ETag", `W/"2"`, http.StatusOK, `"3"`},
+		{"any version", "*", http.StatusOK, `"4"`},
+	}
+	for _, step := range steps {
+		var headers []string
+		if step.ifMatch != "" {
+			headers = []string{"If-Match", step.ifMatch}
+		}
+		recorder := serve(router, http.MethodPut, path, document, headers...)
+		if recorder.Code != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, recorder.Code, step.status, recorder.Body.String())
+		}
+		if etag := recorder.Header().Get("ETag"); etag != step.etag {
+			t.Errorf("%s: ETag = %q, want %q", step.name, etag, step.etag)
+		}
+	}
+
+	if recorder := serve(router, http.MethodPut, "/domains-info/000000000000000000000000", document, "If-Match", "*"); recorder.Code != http.StatusNotFound {
+		t.Errorf("PUT of a missing register: status = %d, want 404", recorder.Code)
+	}
+}
+
+func TestPatchDomainInformationIfMatch(t *testing.T) {
+	router, repos := newTestRouter(t)
+	id := insertReports(t, repos, testReport("a.example", "A", "GOOD", 85, "TLS 1.2"))["a.example"]
+	path := "/domains-info/" + id
+
+	patch := `{"endpoints":[{"ipAddress":"192.0.2.1","grade":"F","protocols":["TLS 1.2"]}]}`
+	if recorder := serve(router, http.MethodPatch, path, patch, "If-Match", `"2"`); recorder.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale PATCH: status = %d, want 412: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder := serve(router, http.MethodPatch, path, patch, "If-Match", `"1"`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PATCH: status = %d, want 200: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// The domain grade and verdict are derived again from the patched endpoint
+	stored, err := repos.Domains.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != 2 || stored.Document["grade"] != "F" || stored.Document["verdict"] != "VERY_POOR" {
+		t.Errorf("stored version = %d, grade = %v, verdict = %v, want 2, F and VERY_POOR", stored.Version, stored.Document["grade"], stored.Document["verdict"])
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	router, repos := newTestRouter(t)
+	ids := insertReports(t, repos,
+		testReport("a.example", "A+", "EXCELLENT", 95, "TLS 1.2", "TLS 1.3"),
+		testReport("b.example", "B", "ACCEPTABLE", 70, "TLS 1.0", "TLS 1.2"),
+		&scripts.FilteredTLSReport{Host: "empty.example", Timestamp: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+	)
+
+	policy := `{"name":"strict","description":"Test policy","rules":{"minGrade":"A","requiredProtocols":["TLS 1.3"],"forbiddenProtocols":["TLS 1.0"]}}`
+	if recorder := serve(router, http.MethodPost, "/policies", policy); recorder.Code != http.StatusCreated {
+		t.Fatalf("POST /policies: status = %d, want 201: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve(router, http.MethodPost, "/policies", `{"name":"broken","rules":{"minGrade":"Z"}}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("POST of an invalid policy: status = %d, want 400", recorder.Code)
+	}
+	if policies := decodeBody[[]scripts.Policy](t, serve(router, http.MethodGet, "/policies", "")); len(policies) != 1 || policies[0].Name != "strict" {
+		t.Errorf("GET /policies = %+v, want only strict", policies)
+	}
+
+	tests := []struct {
+		host   string
+		passed bool
+		failed []string
+	}{
+		{"a.example", true, nil},
+		{"b.example", false, []string{"forbiddenProtocols", "minGrade", "requiredProtocols"}},
+		{"empty.example", false, []string{"forbiddenProtocols", "minGrade", "requiredProtocols"}}, // No endpoint proves any rule
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			recorder := serve(router, http.MethodGet, "/domains-info/"+ids[test.host]+"/evaluate?policy=strict", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body.String())
+			}
+			evaluation := decodeBody[scripts.PolicyEvaluation](t, recorder)
+			var failed []string
+			for _, result := range evaluation.Results {
+				if !result.Passed {
+					failed = append(failed, result.Rule)
+				}
+			}
+			slices.Sort(failed)
+			if evaluation.Passed != test.passed || !slices.Equal(failed, test.failed) {
+				t.Errorf("passed = %v with failed rules %v, want %v with %v", evaluation.Passed, failed, test.passed, test.failed)
+			}
+		})
+	}
+
+	if recorder := serve(router, http.MethodGet, "/domains-info/"+ids["a.example"]+"/evaluate", ""); recorder.Code != http.StatusBadRequest {
+		t.Errorf("evaluate without policy: status = %d, want 400", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodGet, "/domains-info/"+ids["a.example"]+"/evaluate?policy=missing", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("evaluate with a missing policy: status = %d, want 404", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodDelete, "/policies/strict", ""); recorder.Code != http.StatusOK {
+		t.Errorf("DELETE /policies/strict: status = %d, want 200", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodGet, "/policies/strict", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("GET of a deleted policy: status = %d, want 404", recorder.Code)
+	}
+}
+
+func TestExportNeutralizesFormulas(t *testing.T) {
+	router, repos := newTestRouter(t)
+	report := testReport("formula.example.com", "A", "SAFE", 95, "+TLS 1.3")
+	report.Endpoints[0].Server = "=HYPERLINK(\"http://attacker.example\")"
+	insertReports(t, repos, report)
+
+	recorder := serve(router, http.MethodGet, "/domains-info/export?format=csv&rows=endpoint&columns=host,server,protocols,endpointScore", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	want := "host,server,protocols,endpointScore\nformula.example.com,\"'=HYPERLINK(\"\"http://attacker.example\"\")\",'+TLS 1.3,95\n"
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("CSV export = %q, want %q", got, want)
+	}
+
+	recorder = serve(router, http.MethodGet, "/domains-info/export?format=xlsx&rows=endpoint&columns=host,server,endpointScore", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if err != nil {
+		t.Fatalf("invalid XLSX: %v", err)
+	}
+	sheet, err := archive.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatalf("XLSX without sheet: %v", err)
+	}
+	defer sheet.Close()
+	content, _ := io.ReadAll(sheet)
+	if !strings.Contains(string(content), `<t xml:space="preserve">&#39;=HYPERLINK(&#34;http://attacker.example&#34;)</t>`) {
+		t.Errorf("the server of the XLSX export is not neutralized: %s", content)
+	}
+	if !strings.Contains(string(content), `<v>95</v>`) {
+		t.Errorf("the score of the XLSX export is not a number: %s", content)
+	}
+}
+
+type importResponse struct {
+	Total            int               `json:"total"`
+	Created          int               `json:"created"`
+	Skipped          int               `json:"skipped"`
+	Failed           int               `json:"failed"`
+	Results          []json.RawMessage `json:"results"`
+	ResultsTruncated bool              `json:"resultsTruncated"`
+}
+
+/*
+rawReports returns a JSON Lines dump of count raw SSL Labs reports of a host, one per minute
+*/
+func rawReports(host string, count int) string {
+	var dump strings.Builder
+	for i := range count {
+		fmt.Fprintf(&dump, `{"host":%q,"status":"READY","testTime":%d,"endpoints":[{"ipAddress":"192.0.2.1","grade":"A","statusMessage":"Ready"}]}`+"\n",
+			host, time.Date(2024, 1, 1, 0, i, 0, 0, time.UTC).UnixMilli())
+	}
+	return dump.String()
+}
+
+func TestImportDomainsInformation(t *testing.T) {
+	router, _ := newTestRouter(t)
+	importDump := func(dump string) importResponse {
+		recorder := serve(router, http.MethodPost, "/domains-info/import", dump, "Content-Type", "application/x-ndjson")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+		}
+		return decodeBody[importResponse](t, recorder)
+	}
+
+	// The counts cover every report, the list of results stops at 1000
+	dump := rawReports("bulk.example.com", 1100)
+	got := importDump(dump)
+	if got.Total != 1100 || got.Created != 1100 || len(got.Results) != 1000 || !got.ResultsTruncated {
+		t.Errorf("first import: total %d, created %d, %d results, truncated %t", got.Total, got.Created, len(got.Results), got.ResultsTruncated)
+	}
+	got = importDump(dump + `{"host":"bulk.example.com","status":"IN_PROGRESS"}` + "\n")
+	if got.Total != 1101 || got.Skipped != 1100 || got.Failed != 1 {
+		t.Errorf("second import: total %d, skipped %d, failed %d", got.Total, got.Skipped, got.Failed)
+	}
+
+	recorder := serve(router, http.MethodPost, "/domains-info/import", "", "Content-Type", "application/x-ndjson")
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("empty import: status %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+/*
+failingDomains is a domain repository whose ForEach fails after a number of registers
+*/
+type failingDomains struct {
+	repository.DomainRepository
+	after int
+}
+
+func (d failingDomains) ForEach(ctx context.Context, query repository.DomainQuery, fn func(*repository.DomainRecord) error) error {
+	count := 0
+	return d.DomainRepository.ForEach(ctx, query, func(record *repository.DomainRecord) error {
+		if count == d.after {
+			return errors.New("storage unavailable")
+		}
+		count++
+		return fn(record)
+	})
+}
+
+func TestExportInterrupted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemoryRepositories()
+	for i := range 500 {
+		insertReports(t, repos, testReport(fmt.Sprintf("host-%03d.example.com", i), "A", "SAFE", 95, "TLS 1.3"))
+	}
+	handler := handlers.NewHandler(repos)
+	router := gin.New()
+	routes.SetupRoutes(router, handler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Before the first bytes the error is a JSON response, without the headers of the file
+	handler.Domains = failingDomains{DomainRepository: repos.Domains, after: 0}
+	recorder := serve(router, http.MethodGet, "/domains-info/export?format=csv", "")
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("Content-Type %q, want application/json", contentType)
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); disposition != "" {
+		t.Errorf("Content-Disposition %q, want none", disposition)
+	}
+
+	// After them the connection is closed, so the client does not get a complete file
+	handler.Domains = failingDomains{DomainRepository: repos.Domains, after: 400}
+	response, err := http.Get(server.URL + "/domains-info/export?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err == nil {
+		t.Errorf("the interrupted export was read as complete (%d bytes)", len(body))
+	}
+}
+
+func TestAggregateDomainInformationValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+	facet := func(pipeline string) string { return `[{"$facet": {"nested": ` + pipeline + `}}]` }
+	stages := func(count int) string {
+		return "[" + strings.TrimSuffix(strings.Repeat(`{"$match": {}},`, count), ",") + "]"
+	}
+	tests := []struct {
+		name     string
+		pipeline string
+		reason   string // Empty when the pipeline is allowed
+	}{
+		{"match and sort", `[{"$match": {"grade": "A"}}, {"$sort": {"score": -1}}]`, ""},
+		{"facet", facet(`[{"$group": {"_id": "$grade"}}]`), ""},
+		{"out", `[{"$match": {}}, {"$out": "copy"}]`, "$out is not allowed"},
+		{"merge", `[{"$merge": {"into": "copy"}}]`, "$merge is not allowed"},
+		{"lookup", `[{"$lookup": {"from": "scans", "localField": "host", "foreignField": "host", "as": "scans"}}]`, "$lookup is not allowed"},
+		{"lookup in facet", facet(`[{"$lookup": {"from": "scans", "pipeline": [], "as": "scans"}}]`), "$lookup is not allowed"},
+		{"where in match", `[{"$match": {"$where": "sleep(1000)"}}]`, "$where operator is not allowed"},
+		{"function in expr", `[{"$match": {"$expr": {"$function": {"body": "return true", "args": [], "lang": "js"}}}}]`, "$function operator is not allowed"},
+		{"function in facet", facet(`[{"$match": {"$expr": {"$and": [{"$function": {"body": "return true", "args": [], "lang": "js"}}]}}}]`), "$function operator is not allowed"},
+		{"unknown stage", `[{"$densify": {}}]`, "not a supported stage"},
+		{"stage limit", stages(21), "the maximum is 20"},
+		{"depth limit", facet(facet(facet(`[{"$match": {}}]`))), "nested more than 2 levels"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, http.MethodPost, "/domains-info/aggregate", test.pipeline)
+			if test.reason == "" {
+				// The memory repository cannot run aggregations, an allowed pipeline gets past the validation
+				if recorder.Code == http.StatusBadRequest {
+					t.Fatalf("status = 400, want the pipeline allowed: %s", recorder.Body.String())
+				}
+				return
+			}
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", recorder.Code, recorder.Body.String())
+			}
+			if body := decodeBody[map[string]string](t, recorder); !strings.Contains(body["error"], test.reason) {
+				t.Errorf("error = %q, want it to contain %q", body["error"], test.reason)
+			}
+		})
+	}
+}
+
+/*
+slowInserts is a domain repository whose inserts take a while, so concurrent requests overlap between their lookup
+and their insert
+*/
+type slowInserts struct {
+	repository.DomainRepository
+}
+
+func (d slowInserts) Insert(ctx context.Context, report *scripts.FilteredTLSReport) (string, error) {
+	time.Sleep(20 * time.Millisecond)
+	return d.DomainRepository.Insert(ctx, report)
+}
+
+func TestPutDomainReportByHostConcurrentCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemoryRepositories()
+	handler := handlers.NewHandler(repos)
+	handler.Domains = slowInserts{DomainRepository: repos.Domains}
+	router := gin.New()
+	routes.SetupRoutes(router, handler)
+	body, err := json.Marshal(testReport("new.example", "A", "GOOD", 85, "TLS 1.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 20
+	statuses := make(chan int, requests)
+	start := make(chan struct{})
+	for range requests {
+		go func() {
+			<-start
+			statuses <- serve(router, http.MethodPut, "/domains/new.example/report", string(body)).Code
+		}()
+	}
+	close(start)
+	created := 0
+	for range requests {
+		switch status := <-statuses; status {
+		case http.StatusCreated:
+			created++
+		case http.StatusOK, http.StatusConflict: // Replaced, or still updated by the other requests after every attempt
+		default:
+			t.Errorf("status = %d, want 201, 200 or 409", status)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d requests created the host, want 1", created)
+	}
+	if _, total, err := repos.Domains.List(context.Background(), repository.DomainQuery{Host: "new.example", Page: 1, Limit: 10}); err != nil || total != 1 {
+		t.Errorf("registers of the host = %d (%v), want 1", total, err)
+	}
+}
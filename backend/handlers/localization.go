@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+requestLanguage resolves the language of the response, the ?lang= parameter takes precedence over the Accept-Language header
+Args:
+
+	c *gin.Context: The Gin context of the request
+
+Returns:
+
+	string: The language code (scripts.DefaultLanguage when none is requested)
+	error: An error if the ?lang= parameter has an unsupported language
+*/
+func requestLanguage(c *gin.Context) (string, error) {
+	if lang := c.Query("lang"); lang != "" {
+		if !scripts.IsSupportedLanguage(lang) {
+			return "", fmt.Errorf("Unsupported language %q, allowed values: es, en", lang)
+		}
+		return lang, nil
+	}
+	if lang := scripts.ParseAcceptLanguage(c.GetHeader("Accept-Language")); lang != "" {
+		return lang, nil
+	}
+	return scripts.DefaultLanguage, nil
+}
+
+/*
+localizeRecord regenerates the texts of a stored domain report in the given language,
+documents that do not have the FilteredTLSReport shape are returned untouched
+Args:
+
+	record *repository.DomainRecord: The stored register
+	lang string: The language code
+
+Returns:
+
+	map[string]any: The document with the summary, findings and verdict texts localized
+*/
+func localizeRecord(record *repository.DomainRecord, lang string) map[string]any {
+	doc := record.Document
+	if _, ok := doc["endpoints"]; !ok {
+		return doc
+	}
+
+	report, err := record.Report()
+	if err != nil {
+		return doc
+	}
+
+	raw, err := json.Marshal(scripts.LocalizeReport(report, lang))
+	if err != nil {
+		return doc
+	}
+	var localized map[string]any
+	if err := json.Unmarshal(raw, &localized); err != nil {
+		return doc
+	}
+	for _, key := range []string{"endpoints", "grade", "verdict", "verdictText", "language", "findings", "summary"} {
+		doc[key] = localized[key]
+	}
+
+	return doc
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+PostPolicy handles the POST request to create or replace a verdict policy, the body can be YAML
+(Content-Type application/yaml, application/x-yaml or text/yaml) or JSON. A body example in YAML:
+
+	name: strict
+	description: Policy for internet facing services
+	rules:
+	  minGrade: A
+	  requiredProtocols: ["TLS 1.3"]
+	  forbiddenProtocols: ["TLS 1.0", "TLS 1.1"]
+	  forbiddenCiphers: ["CBC", "RC4", "3DES"]
+	  minKeySize: 2048
+	  hstsRequired: true
+	  minExpiryDays: 30
+
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the stored policy or an error message
+*/
+func (h *Handler) PostPolicy(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading body: " + fmt.Sprint(err)})
+		return
+	}
+
+	format := "json"
+	if strings.Contains(c.ContentType(), "yaml") {
+		format = "yaml"
+	}
+	policy, err := scripts.ParsePolicy(body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = h.Policies.Save(context.TODO(), policy); err != nil {
+		respondRepositoryError(c, err, "Error saving policy")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Policy saved successfully", "policy": policy})
+}
+
+/*
+GetPolicies handles the GET request to list every stored verdict policy
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the list of policies or an error message
+*/
+func (h *Handler) GetPolicies(c *gin.Context) {
+	policies, err := h.Policies.List(context.TODO())
+	if err != nil {
+		respondRepositoryError(c, err, "Error obtaining data")
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+/*
+GetPolicyByName handles the GET request to retrieve a verdict policy by its name
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the policy or an error message
+*/
+func (h *Handler) GetPolicyByName(c *gin.Context) {
+	policy, status, err := h.findPolicy(c.Param("name"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+/*
+DeletePolicy handles the DELETE request to remove a verdict policy by its name
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response confirming deletion or an error message
+*/
+func (h *Handler) DeletePolicy(c *gin.Context) {
+	err := h.Policies.Delete(context.TODO(), c.Param("name"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Policy not found"})
+		return
+	}
+	if err != nil {
+		respondRepositoryError(c, err, "Error deleting policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Policy successfully deleted"})
+}
+
+/*
+EvaluatePolicy handles the POST request to evaluate the report sent in the body (a FilteredTLSReport,
+e.g. the filteredResult of /scan-status) against the named policy
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the pass/fail result of every rule or an error message
+*/
+func (h *Handler) EvaluatePolicy(c *gin.Context) {
+	var report scripts.FilteredTLSReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error decoding JSON: " + fmt.Sprint(err)})
+		return
+	}
+
+	policy, status, err := h.findPolicy(c.Param("name"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy.Evaluate(&report))
+}
+
+/*
+EvaluateDomainInformation handles the GET request to evaluate a stored domain report against the policy given in ?policy=
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the pass/fail result of every rule or an error message
+*/
+func (h *Handler) EvaluateDomainInformation(c *gin.Context) {
+	if c.Query("policy") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter policy is required"})
+		return
+	}
+
+	policy, status, err := h.findPolicy(c.Query("policy"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	domainInfo, err := h.Domains.Get(context.TODO(), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+	if err != nil {
+		respondRepositoryError(c, err, "Error obtaining data")
+		return
+	}
+
+	report, err := domainInfo.Report()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stored document is not a valid report: " + fmt.Sprint(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy.Evaluate(report))
+}
+
+/*
+findPolicy loads a verdict policy from the policy repository by its name
+Args:
+
+	name string: The name of the policy
+
+Returns:
+
+	*scripts.Policy: Pointer of the policy
+	int: The HTTP status to answer with when there is an error
+	error: Any error encountered during the process
+*/
+func (h *Handler) findPolicy(name string) (*scripts.Policy, int, error) {
+	policy, err := h.Policies.Get(context.TODO(), name)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, http.StatusNotFound, fmt.Errorf("Policy %q not found", name)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Error obtaining data: %v", err)
+	}
+	return policy, http.StatusOK, nil
+}
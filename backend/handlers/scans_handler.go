@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/Nebula-Challenge/repository"
 	"github.com/Nebula-Challenge/scripts"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -21,30 +25,56 @@ Returns:
 */
 func (h *Handler) StartScan(c *gin.Context) {
 	var req struct {
-		Domain string `json:"domain"`
+		Domain      string `json:"domain"`
+		Aggregation string `json:"aggregation"` // Optional: worst (default), best or majority
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
-
+	if req.Aggregation == "" {
+		req.Aggregation = scripts.DefaultAggregation
+	}
+	if !scripts.IsValidAggregation(req.Aggregation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid aggregation, allowed values: worst, best, majority"})
+		return
+	}
+	lang, err := requestLanguage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	scanRequestID := uuid.New().String()
-	h.mu.Lock() //Acceder a la gorutina de manera segura
-	h.scanRequests[scanRequestID] = &ScanRequest{Status: "IN_PROGRESS"}
-	h.mu.Unlock()
+	options := scripts.FilterOptions{Aggregation: req.Aggregation, Language: lang, ScanRequestID: scanRequestID, RequestedAt: time.Now()}
+	if err := h.Scans.Create(context.TODO(), scanRequestID, &repository.ScanRequest{Status: "IN_PROGRESS"}); err != nil {
+		respondRepositoryError(c, err, "Error saving scan request")
+		return
+	}
 
 	go func() { // gorutina para manejar la evaluacion asincronamente (un hilo ligero de go)
-		_, err := scripts.CheckTLS(req.Domain, true)
-		if err != nil {
-			h.updateScanRequest(scanRequestID, "error", nil, err.Error())
-			return
+		h.scanSlots <- struct{}{} // Waits for a free worker, the scan stays IN_PROGRESS meanwhile
+		defer func() { <-h.scanSlots }()
+
+		ctx := context.Background()
+		if h.scanTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, h.scanTimeout)
+			defer cancel()
 		}
 
-		result, err := scripts.PollUntilReady(req.Domain)
+		// The timeout bounds the whole assessment, including the request that starts it
+		var result []byte
+		_, err := scripts.CheckTLS(ctx, req.Domain, true)
+		if err == nil {
+			result, err = scripts.PollUntilReadyContext(ctx, req.Domain, h.pollInterval)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("the assessment did not finish within %s", h.scanTimeout)
+		}
 		if err != nil {
-			h.updateScanRequest(scanRequestID, "error", nil, err.Error())
+			h.updateScanRequest(scanRequestID, "error", nil, err.Error(), options)
 		} else {
-			h.updateScanRequest(scanRequestID, "complete", result, "")
+			h.updateScanRequest(scanRequestID, "complete", result, "", options)
 		}
 
 	}()
@@ -53,7 +83,7 @@ func (h *Handler) StartScan(c *gin.Context) {
 
 /*
 GetScanStatus handles the GET request to retrieve the status of a TLS scan, its porpous is to give the frontend a way to check the status of a previously initiated scan and ,
-if completed, retrieve the results.
+if completed, retrieve the results. The report texts are localized with the ?lang= parameter or the Accept-Language header.
 Args:
 
 	c *gin.Context: The Gin context for handling the request and response
@@ -63,44 +93,226 @@ Returns:
 	None: Sends a JSON response with the scan status and result or an error message
 */
 func (h *Handler) GetScanStatus(c *gin.Context) {
+	lang, err := requestLanguage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	scanRequestID := c.Param("scanRequestID")
-	h.mu.Lock()
-	scanRequest, exists := h.scanRequests[scanRequestID]
-	h.mu.Unlock()
-	if !exists {
+	scanRequest, err := h.Scans.Get(context.TODO(), scanRequestID)
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Scan request not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": scanRequest.Status, "result": scanRequest.Result, "filteredResult": scanRequest.FilteredResult, "error": scanRequest.Error})
+	if err != nil {
+		respondRepositoryError(c, err, "Error obtaining scan request")
+		return
+	}
+	filteredResult := scripts.LocalizeReport(scanRequest.FilteredResult, lang) // Localized copy, the stored report is not modified
+	c.JSON(http.StatusOK, gin.H{"status": scanRequest.Status, "result": scanRequest.Result, "filteredResult": filteredResult, "error": scanRequest.Error, "rawReport": scanRequest.RawReport})
 }
 
 /*
-updateScanRequest updates the status and result of a scan request map in a thread-safe manner
+RefilterScan handles the POST request to regenerate the filtered report of a scan from its stored raw SSL Labs
+report, so old scans benefit from the improvements of the filter. The body is optional:
+{"aggregation": "best", "persist": true}. The report keeps the time of the assessment, and the scan request is
+updated if it still exists. With persist the domain registers generated from the scan (scan.scanRequestID) are
+replaced by the new report too, or it is inserted as a new register if there is none
+
+Args:
+
+	c *gin.Context: The Gin context for handling the request and response
+
+Returns:
+
+	None: Sends a JSON response with the new filtered report or an error message
+*/
+func (h *Handler) RefilterScan(c *gin.Context) {
+	var req struct {
+		Aggregation string `json:"aggregation"` // Optional: worst (default), best or majority
+		Persist     bool   `json:"persist"`     // Optional: also write the report to the domain registers
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	if req.Aggregation == "" {
+		req.Aggregation = scripts.DefaultAggregation
+	}
+	if !scripts.IsValidAggregation(req.Aggregation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid aggregation, allowed values: worst, best, majority"})
+		return
+	}
+	lang, err := requestLanguage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.RawReports == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "The raw reports are not stored (RAW_REPORTS_STORE=none)"})
+		return
+	}
+
+	scanRequestID := c.Param("scanRequestID")
+	raw, err := h.RawReports.Load(c.Request.Context(), scanRequestID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Raw report not found"})
+		return
+	}
+	if err != nil {
+		respondRepositoryError(c, err, "Error loading raw report")
+		return
+	}
+
+	scanRequest, err := h.Scans.Get(c.Request.Context(), scanRequestID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) { // A scan request removed by the retention keeps its raw report
+		respondRepositoryError(c, err, "Error obtaining scan request")
+		return
+	}
+
+	options := scripts.FilterOptions{Aggregation: req.Aggregation, Language: lang, ScanRequestID: scanRequestID}
+	filtered, err := h.filterRawReport(scanRequestID, raw, options)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Error filtering report: " + fmt.Sprint(err)})
+		return
+	}
+
+	updated := false
+	if scanRequest != nil {
+		// The request time is not stored, the origin of the report is the one found when the scan completed
+		if previous := scanRequest.FilteredResult; previous != nil && previous.Scan != nil {
+			filtered.Scan.FromCache = previous.Scan.FromCache
+		}
+		scanRequest.FilteredResult = filtered
+		if err := h.Scans.Update(c.Request.Context(), scanRequestID, scanRequest); err != nil {
+			respondRepositoryError(c, err, "Error updating scan request")
+			return
+		}
+		updated = true
+	}
+
+	response := gin.H{"scanRequestID": scanRequestID, "updated": updated}
+	if req.Persist {
+		domainIDs, err := h.persistRefilteredReport(c.Request.Context(), scanRequestID, filtered, scanRequest != nil)
+		var conflict *repository.VersionConflictError
+		if errors.As(err, &conflict) || errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A domain register of the scan was modified while it was being replaced, try again"})
+			return
+		}
+		if err != nil {
+			respondRepositoryError(c, err, "Error storing the domain report")
+			return
+		}
+		response["domainIDs"] = domainIDs
+	}
+	response["filteredResult"] = scripts.LocalizeReport(filtered, lang)
+	c.JSON(http.StatusOK, response)
+}
+
+/*
+persistRefilteredReport replaces the domain registers generated from a scan with its regenerated report, keeping
+their versions checked, or inserts the report when the scan has no register
+Args:
+
+	ctx context.Context: The context of the request
+	scanRequestID string: The ID of the scan
+	report *scripts.FilteredTLSReport: The regenerated report
+	knownOrigin bool: True if report.Scan.FromCache was taken from the scan request, otherwise the stored one is kept
+
+Returns:
+
+	[]string: The IDs of the registers written
+	error: Any error of the repository, *repository.VersionConflictError if a register changed meanwhile
+*/
+func (h *Handler) persistRefilteredReport(ctx context.Context, scanRequestID string, report *scripts.FilteredTLSReport, knownOrigin bool) ([]string, error) {
+	var stored []repository.DomainRecord
+	err := h.Domains.ForEach(ctx, repository.DomainQuery{ScanRequestID: scanRequestID}, func(record *repository.DomainRecord) error {
+		stored = append(stored, *record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stored) == 0 {
+		id, err := h.Domains.Insert(ctx, report)
+		if err != nil {
+			return nil, err
+		}
+		return []string{id}, nil
+	}
+
+	ids := make([]string, 0, len(stored))
+	for _, record := range stored {
+		if !knownOrigin {
+			if previous, err := record.Report(); err == nil && previous.Scan != nil {
+				report.Scan.FromCache = previous.Scan.FromCache
+			}
+		}
+		if _, err := h.Domains.Replace(ctx, record.ID, record.Version, report); err != nil {
+			return ids, err
+		}
+		ids = append(ids, record.ID)
+	}
+	return ids, nil
+}
+
+/*
+updateScanRequest updates the status and result of a scan request in the scan repository. The raw report of a
+completed scan is stored compressed in the raw report repository and only its reference is kept in the scan
 Args:
 
 	id string: The scan request ID
 	status string: The new status of the scan request
 	result map[string]interface{}: The result of the scan request
 	errMsg string: Any error message associated with the scan request
+	options scripts.FilterOptions: The options used to filter the result
 */
-func (h *Handler) updateScanRequest(id string, status string, result []byte, errMsg string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()                            // Para evitar condidiones de carrera
-	if value, exist := h.scanRequests[id]; exist { // Verifica que el ID exista antes de actualizar el estado de este scan Request
-		value.Status = status
-		value.Result = result
-		value.Error = errMsg
-
-		if status == "complete" && len(result) > 0 {
-			filtered, err := scripts.FilterSSLReport(result)
-			if err != nil {
-				fmt.Printf("Error filtering report for scan %s: %v", id, err)
-				value.FilteredResult = nil
-			} else {
-				value.FilteredResult = filtered
+func (h *Handler) updateScanRequest(id string, status string, result []byte, errMsg string, options scripts.FilterOptions) {
+	scanRequest := &repository.ScanRequest{Status: status, Result: result, Error: errMsg}
+	if status == "complete" && len(result) > 0 {
+		filtered, err := h.filterRawReport(id, result, options)
+		if err != nil {
+			fmt.Printf("Error filtering report for scan %s: %v", id, err)
+		}
+		scanRequest.FilteredResult = filtered
+		if h.RawReports != nil {
+			if scanRequest.RawReport, err = h.RawReports.Save(context.Background(), id, result); err != nil {
+				fmt.Printf("Error storing raw report for scan %s: %v", id, err)
 			}
-
-			value.Result = nil //To not save useless data in memory
 		}
+		scanRequest.Result = nil //To not save useless data
+	}
+	if err := h.Scans.Update(context.Background(), id, scanRequest); err != nil {
+		fmt.Printf("Error updating scan %s: %v", id, err)
+	}
+}
+
+/*
+filterRawReport filters a raw SSL Labs report and checks the DNS CAA records of its host
+Args:
+
+	id string: The scan request ID, for the log messages
+	raw []byte: The raw report
+	options scripts.FilterOptions: The options of the filter
+
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the filtered report
+	error: The error of the filter, a failed CAA lookup is only logged
+*/
+func (h *Handler) filterRawReport(id string, raw []byte, options scripts.FilterOptions) (*scripts.FilteredTLSReport, error) {
+	filtered, err := scripts.FilterSSLReportWithOptions(raw, options)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := scripts.ApplyCAACheck(ctx, filtered, h.CAAResolver); err != nil {
+		fmt.Printf("Error checking CAA for scan %s: %v", id, err)
 	}
+	return filtered, nil
 }
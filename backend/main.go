@@ -1,38 +1,178 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"time"
+
 	"github.com/Nebula-Challenge/config"
 	"github.com/Nebula-Challenge/handlers"
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/retention"
 	"github.com/Nebula-Challenge/routes"
+	"github.com/Nebula-Challenge/scripts"
 	"github.com/gin-gonic/gin"
-	"log"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 /*
-init function to establish MongoDB connection before the main function runs
+openRepositories creates the repositories of the configured storage backend: mongo (connection settings in the mongo
+section), sqlite (a database file) or memory, which keeps the data in memory and needs no database
+
+params
+
+	storage config.StorageSettings: The storage settings
+	mongoSettings *config.MongoSettings: pointer with the MongoDB connection settings, used by the mongo backend
+
+returns
+
+	*repository.Repositories: pointer to the repositories
+	err: Any error encountered during the process
+*/
+func openRepositories(storage config.StorageSettings, mongoSettings *config.MongoSettings) (*repository.Repositories, error) {
+	switch storage.Backend {
+	case config.StorageMongo:
+		dbConfig, err := config.GetMongoClient(mongoSettings)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Connected to MongoDB successfully")
+		repos, err := repository.NewMongoRepositories(dbConfig.Client, dbConfig.DbName)
+		if err != nil {
+			config.CloseMongoConnection()
+			return nil, fmt.Errorf("failed to migrate MongoDB: %v", err)
+		}
+		if repos.RawReports, err = openRawReports(storage, config.RawReportsGridFS, dbConfig.Client.Database(dbConfig.DbName)); err != nil {
+			config.CloseMongoConnection()
+			return nil, err
+		}
+		return repos, nil
+	case config.StorageSQLite:
+		repos, err := repository.NewSQLiteRepositories(storage.SQLitePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open SQLite database %s: %v", storage.SQLitePath, err)
+		}
+		if repos.RawReports, err = openRawReports(storage, config.RawReportsFilesystem, nil); err != nil {
+			repos.Close(context.Background())
+			return nil, err
+		}
+		fmt.Println("Using the SQLite database " + storage.SQLitePath)
+		return repos, nil
+	case config.StorageMemory:
+		fmt.Println("Using the in-memory storage, the data is lost when the server stops")
+		repos := repository.NewMemoryRepositories()
+		var err error
+		if repos.RawReports, err = openRawReports(storage, config.RawReportsMemory, nil); err != nil {
+			return nil, err
+		}
+		return repos, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, allowed values: mongo, sqlite, memory", storage.Backend)
+	}
+}
+
+/*
+openRawReports creates the repository of the raw SSL Labs reports of the configured store: gridfs (MongoDB only),
+filesystem (a directory), memory or none
+
+params
+
+	storage config.StorageSettings: The storage settings, with the store, its directory and the compression
+	defaultStore string: The store used when none is configured, it depends on the storage backend
+	db *mongo.Database: The MongoDB database, nil with the other backends
+
+returns
+
+	repository.RawReportRepository: The repository, nil with none
+	err: Any error encountered during the process
 */
-func init() {
-	if err := config.ConnectToMongo(); err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v ", err)
+func openRawReports(storage config.StorageSettings, defaultStore string, db *mongo.Database) (repository.RawReportRepository, error) {
+	store := storage.RawReportsStore
+	if store == "" {
+		store = defaultStore
 	}
 
-	fmt.Println("Connected to MongoDB successfully")
+	switch store {
+	case config.RawReportsGridFS:
+		if db == nil {
+			return nil, fmt.Errorf("the gridfs raw reports store requires the mongo storage backend")
+		}
+		return repository.NewGridFSRawReports(db, storage.RawReportsCompression)
+	case config.RawReportsFilesystem:
+		raw, err := repository.NewFileRawReports(storage.RawReportsDir, storage.RawReportsCompression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the raw reports directory %s: %v", storage.RawReportsDir, err)
+		}
+		return raw, nil
+	case config.RawReportsMemory:
+		return repository.NewMemoryRawReports(storage.RawReportsCompression)
+	case config.RawReportsNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown raw reports store %q, allowed values: gridfs, filesystem, memory, none", store)
+	}
 }
 
 /*
-main is the entry point of the application, setting up the Gin router and routes
+retentionPolicy builds the policy of the retention job from its settings, already validated by config.Load
+
+params
+
+	settings config.RetentionSettings: The retention settings
+
+returns
+
+	retention.Policy: The policy
+*/
+func retentionPolicy(settings config.RetentionSettings) retention.Policy {
+	return retention.Policy{
+		ReportsMaxAge:    time.Duration(settings.ReportsMaxAge),
+		Snapshots:        settings.Snapshots,
+		SnapshotsMaxAge:  time.Duration(settings.SnapshotsMaxAge),
+		ScansMaxAge:      time.Duration(settings.ScansMaxAge),
+		RawReportsMaxAge: time.Duration(settings.RawReportsMaxAge),
+		ArchiveDir:       settings.ArchiveDir,
+		Interval:         time.Duration(settings.Interval),
+	}
+}
+
+/*
+main is the entry point of the application, loading the settings and setting up the storage, the retention job,
+the Gin router and routes
 */
 func main() {
+	settings, err := config.Load(os.Args[0], os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v ", err)
+	}
+	scripts.ConfigureSSLLabs(settings.SSLLabs.APIURL, time.Duration(settings.SSLLabs.RequestTimeout))
 
-	// Good practice to close the MongoDB connection when the application exits
-	defer config.CloseMongoConnection()
+	repos, err := openRepositories(settings.Storage, &settings.Mongo)
+	if err != nil {
+		log.Fatalf("Failed to open the storage: %v ", err)
+	}
+	// Good practice to close the database connection when the application exits
+	defer repos.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	retention.Start(ctx, repos, retentionPolicy(settings.Retention))
 
 	// Setting up the Gin router and routes
-	dbConfig := config.GetMongoClient()
-	handler := handlers.NewHandler(dbConfig)
+	handler := handlers.NewHandler(repos)
+	handler.ConfigureScans(settings.Scans.Workers, time.Duration(settings.Scans.PollInterval), time.Duration(settings.Scans.Timeout))
+	gin.SetMode(settings.Server.GinMode)
 	router := gin.Default()
 	routes.SetupRoutes(router, handler)
 
-	router.Run("localhost:8080")
+	if err := router.Run(settings.Server.ListenAddress()); err != nil {
+		log.Fatalf("Failed to start the server: %v ", err)
+	}
 }
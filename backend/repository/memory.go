@@ -0,0 +1,594 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+NewMemoryRepositories creates repositories that keep everything in memory, used to run the API locally
+without a database. The data is lost when the process exits
+Returns:
+
+	*Repositories: Pointer of the repositories
+*/
+func NewMemoryRepositories() *Repositories {
+	return &Repositories{
+		Domains:  &memoryDomainRepository{domains: map[string]*memoryDomain{}},
+		Policies: &memoryPolicyRepository{policies: map[string]scripts.Policy{}},
+		Scans:    &memoryScanRepository{scans: map[string]memoryScan{}},
+		Close:    func(context.Context) error { return nil },
+	}
+}
+
+/*
+Struct created to hold a domain report stored in memory
+*/
+type memoryDomain struct {
+	id      string // ObjectID in hex, so the IDs look the same as with MongoDB and sort by insertion time
+	version int64
+	report  *scripts.FilteredTLSReport
+}
+
+type memoryDomainRepository struct {
+	mu      sync.RWMutex
+	domains map[string]*memoryDomain
+}
+
+func (r *memoryDomainRepository) List(_ context.Context, query DomainQuery) ([]DomainRecord, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches := r.matches(query)
+	total := int64(len(matches))
+	start := min(query.Offset(), total)
+	end := min(start+max(query.Limit, 0), total)
+
+	records := make([]DomainRecord, 0, end-start)
+	for _, domain := range matches[start:end] {
+		record, err := domain.record()
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, *record)
+	}
+	return records, total, nil
+}
+
+func (r *memoryDomainRepository) ForEach(ctx context.Context, query DomainQuery, fn func(*DomainRecord) error) error {
+	r.mu.RLock()
+	matches := r.matches(query)
+	return r.forEach(ctx, matches, fn)
+}
+
+/*
+forEach calls fn with each of the given registers without holding the lock. Only the ID, version and report
+pointer of each register are copied under the lock (the stored reports are never modified, Replace stores a new
+one), the records are built as fn needs them. The caller must hold the read lock, forEach releases it
+Args:
+
+	ctx context.Context: The context of the operation
+	domains []*memoryDomain: The registers
+	fn func(*DomainRecord) error: The function called with each register, its error stops the iteration
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func (r *memoryDomainRepository) forEach(ctx context.Context, domains []*memoryDomain, fn func(*DomainRecord) error) error {
+	snapshot := make([]memoryDomain, len(domains))
+	for i, domain := range domains {
+		snapshot[i] = *domain
+	}
+	r.mu.RUnlock()
+
+	for i := range snapshot {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := snapshot[i].record()
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+matches returns the registers matching the filters of a query, sorted by its fields and then by ID. The caller must hold the lock
+Args:
+
+	query DomainQuery: The query
+
+Returns:
+
+	[]*memoryDomain: The sorted registers
+*/
+func (r *memoryDomainRepository) matches(query DomainQuery) []*memoryDomain {
+	var matches []*memoryDomain
+	for _, domain := range r.domains {
+		if matchesDomainQuery(domain.report, query) {
+			matches = append(matches, domain)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, field := range query.Sort {
+			if order := compareSortValues(sortValues(matches[i].report, field.Field), sortValues(matches[j].report, field.Field), field.Descending); order != 0 {
+				if field.Descending {
+					return order > 0
+				}
+				return order < 0
+			}
+		}
+		return matches[i].id < matches[j].id
+	})
+	return matches
+}
+
+func (r *memoryDomainRepository) Get(_ context.Context, id string) (*DomainRecord, error) {
+	if _, err := parseObjectID(id); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	domain, exists := r.domains[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return domain.record()
+}
+
+func (r *memoryDomainRepository) Latest(_ context.Context, host string) (*DomainRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var latest *memoryDomain
+	for _, domain := range r.domains {
+		if domain.report.Host == host && (latest == nil || domain.id > latest.id) {
+			latest = domain
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest.record()
+}
+
+func (r *memoryDomainRepository) Insert(_ context.Context, report *scripts.FilteredTLSReport) (string, error) {
+	stored, err := copyReport(report)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := primitive.NewObjectID().Hex()
+	r.domains[id] = &memoryDomain{id: id, version: 1, report: stored}
+	return id, nil
+}
+
+func (r *memoryDomainRepository) Replace(_ context.Context, id string, version int64, report *scripts.FilteredTLSReport) (int64, error) {
+	if _, err := parseObjectID(id); err != nil {
+		return 0, err
+	}
+	stored, err := copyReport(report)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	domain, exists := r.domains[id]
+	if !exists {
+		return 0, ErrNotFound
+	}
+	if version >= 0 && version != domain.version {
+		return 0, &VersionConflictError{Current: domain.version}
+	}
+	domain.version++
+	domain.report = stored
+	return domain.version, nil
+}
+
+func (r *memoryDomainRepository) Delete(_ context.Context, id string) error {
+	if _, err := parseObjectID(id); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.domains[id]; !exists {
+		return ErrNotFound
+	}
+	delete(r.domains, id)
+	return nil
+}
+
+func (r *memoryDomainRepository) ForEachBefore(ctx context.Context, before time.Time, fn func(*DomainRecord) error) error {
+	r.mu.RLock()
+	var matches []*memoryDomain
+	for _, domain := range r.domains {
+		if domain.report.Timestamp.Before(before) {
+			matches = append(matches, domain)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.report.Host != b.report.Host {
+			return a.report.Host < b.report.Host
+		}
+		if !a.report.Timestamp.Equal(b.report.Timestamp) {
+			return a.report.Timestamp.After(b.report.Timestamp)
+		}
+		return a.id > b.id
+	})
+	return r.forEach(ctx, matches, fn)
+}
+
+func (r *memoryDomainRepository) DeleteMany(_ context.Context, ids []string) (int64, error) {
+	for _, id := range ids {
+		if _, err := parseObjectID(id); err != nil {
+			return 0, err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for _, id := range ids {
+		if _, exists := r.domains[id]; exists {
+			delete(r.domains, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *memoryDomainRepository) Aggregate(context.Context, []bson.D, time.Duration) ([]map[string]any, error) {
+	return nil, fmt.Errorf("%w: aggregation pipelines require MongoDB", ErrUnsupported)
+}
+
+/*
+record converts a domain stored in memory into a DomainRecord
+Returns:
+
+	*DomainRecord: Pointer of the record
+	error: Any error encountered during the process
+*/
+func (d *memoryDomain) record() (*DomainRecord, error) {
+	raw, err := json.Marshal(d.report)
+	if err != nil {
+		return nil, err
+	}
+	return jsonRecord(d.id, d.version, raw)
+}
+
+/*
+matchesDomainQuery checks a report against the filters of a domain query, with the same semantics as the MongoDB filter
+Args:
+
+	report *scripts.FilteredTLSReport: The report
+	query DomainQuery: The query
+
+Returns:
+
+	bool: True if the report matches every filter
+*/
+func matchesDomainQuery(report *scripts.FilteredTLSReport, query DomainQuery) bool {
+	if query.Host != "" && !strings.EqualFold(report.Host, query.Host) {
+		return false
+	}
+	if query.ScanRequestID != "" && (report.Scan == nil || report.Scan.ScanRequestID != query.ScanRequestID) {
+		return false
+	}
+	if len(query.Grades) > 0 && !contains(query.Grades, report.Grade) {
+		return false
+	}
+	if len(query.Verdicts) > 0 && !contains(query.Verdicts, report.Verdict) {
+		return false
+	}
+	if !inRange(report.Score, query.MinScore, query.MaxScore) {
+		return false
+	}
+	if query.From != nil && report.Timestamp.Before(*query.From) || query.To != nil && report.Timestamp.After(*query.To) {
+		return false
+	}
+
+	if query.MinExpiresInDays == nil && query.MaxExpiresInDays == nil && query.Issuer == "" && query.Protocol == "" {
+		return true
+	}
+	// The conditions of the endpoint fields are matched on the same endpoint
+	for _, endpoint := range report.Endpoints {
+		certificate := endpoint.Certificate
+		if (query.MinExpiresInDays != nil || query.MaxExpiresInDays != nil) && (certificate == nil || !inRange(certificate.ExpiresInDays, query.MinExpiresInDays, query.MaxExpiresInDays)) {
+			continue
+		}
+		if query.Issuer != "" && (certificate == nil || !strings.Contains(strings.ToLower(certificate.Issuer), strings.ToLower(query.Issuer))) {
+			continue
+		}
+		if query.Protocol != "" && !contains(endpoint.Protocols, query.Protocol) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+/*
+sortValues returns the values a report is sorted by for a field of DomainSortFields, the endpoint fields have one value per endpoint
+Args:
+
+	report *scripts.FilteredTLSReport: The report
+	field string: The sort field
+
+Returns:
+
+	[]any: The values, strings or float64
+*/
+func sortValues(report *scripts.FilteredTLSReport, field string) []any {
+	var values []any
+	switch field {
+	case "host":
+		values = append(values, report.Host)
+	case "grade":
+		values = append(values, float64(rankedSortFields[field].rank(report.Grade)))
+	case "verdict":
+		values = append(values, float64(rankedSortFields[field].rank(report.Verdict)))
+	case "score":
+		values = append(values, float64(report.Score))
+	case "timestamp":
+		values = append(values, float64(report.Timestamp.UnixNano()))
+	default:
+		for _, endpoint := range report.Endpoints {
+			switch {
+			case field == "protocol":
+				for _, protocol := range endpoint.Protocols {
+					values = append(values, protocol)
+				}
+			case endpoint.Certificate == nil:
+			case field == "expiresInDays":
+				values = append(values, endpoint.Certificate.ExpiresInDays)
+			case field == "issuer":
+				values = append(values, endpoint.Certificate.Issuer)
+			}
+		}
+	}
+	return values
+}
+
+/*
+compareSortValues compares the sort values of two reports like MongoDB does with arrays: the smallest value
+is used in ascending order and the largest in descending order, a report without values goes first
+Args:
+
+	a []any: The values of the first report
+	b []any: The values of the second report
+	descending bool: The sort direction
+
+Returns:
+
+	int: Negative if a goes before b in ascending order, positive if after, 0 if equal
+*/
+func compareSortValues(a []any, b []any, descending bool) int {
+	pick := func(values []any) any {
+		var picked any
+		for _, value := range values {
+			if picked == nil || (compareValues(value, picked) < 0) != descending {
+				picked = value
+			}
+		}
+		return picked
+	}
+	first, second := pick(a), pick(b)
+	switch {
+	case first == nil && second == nil:
+		return 0
+	case first == nil:
+		return -1
+	case second == nil:
+		return 1
+	}
+	return compareValues(first, second)
+}
+
+/*
+compareValues compares two sort values of the same field
+Args:
+
+	a any: A string or float64
+	b any: A value of the same type
+
+Returns:
+
+	int: -1, 0 or 1
+*/
+func compareValues(a any, b any) int {
+	if first, ok := a.(float64); ok {
+		second, _ := b.(float64)
+		switch {
+		case first < second:
+			return -1
+		case first > second:
+			return 1
+		}
+		return 0
+	}
+	first, _ := a.(string)
+	second, _ := b.(string)
+	return strings.Compare(first, second)
+}
+
+/*
+inRange checks a value against optional inclusive bounds
+Args:
+
+	value T: The value
+	lower *T: The lower bound, nil for none
+	upper *T: The upper bound, nil for none
+
+Returns:
+
+	bool: True if the value is within the bounds
+*/
+func inRange[T int | float64](value T, lower *T, upper *T) bool {
+	return (lower == nil || value >= *lower) && (upper == nil || value <= *upper)
+}
+
+/*
+contains checks if a slice contains a string
+Args:
+
+	values []string: The slice
+	value string: The string to look for
+
+Returns:
+
+	bool: True if the value is in the slice
+*/
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+copyReport makes a deep copy of a report, so the stored reports cannot be modified by the callers
+Args:
+
+	report *scripts.FilteredTLSReport: The report
+
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the copy
+	error: Any error encountered during the process
+*/
+func copyReport(report *scripts.FilteredTLSReport) (*scripts.FilteredTLSReport, error) {
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	var copied scripts.FilteredTLSReport
+	if err := json.Unmarshal(raw, &copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+type memoryPolicyRepository struct {
+	mu       sync.RWMutex
+	policies map[string]scripts.Policy
+}
+
+func (r *memoryPolicyRepository) Save(_ context.Context, policy *scripts.Policy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policies[policy.Name] = *policy
+	return nil
+}
+
+func (r *memoryPolicyRepository) List(context.Context) ([]scripts.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policies := []scripts.Policy{}
+	for _, policy := range r.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+func (r *memoryPolicyRepository) Get(_ context.Context, name string) (*scripts.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policy, exists := r.policies[name]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &policy, nil
+}
+
+func (r *memoryPolicyRepository) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.policies[name]; !exists {
+		return ErrNotFound
+	}
+	delete(r.policies, name)
+	return nil
+}
+
+/*
+Struct created to hold a scan request stored in memory and the time of its last update
+*/
+type memoryScan struct {
+	scan      ScanRequest
+	updatedAt time.Time
+}
+
+type memoryScanRepository struct {
+	mu    sync.RWMutex
+	scans map[string]memoryScan
+}
+
+func (r *memoryScanRepository) Create(_ context.Context, id string, scan *ScanRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scans[id] = memoryScan{scan: *scan, updatedAt: time.Now()}
+	return nil
+}
+
+func (r *memoryScanRepository) Get(_ context.Context, id string) (*ScanRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, exists := r.scans[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	scan := stored.scan
+	return &scan, nil
+}
+
+func (r *memoryScanRepository) Update(_ context.Context, id string, scan *ScanRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.scans[id]; !exists {
+		return ErrNotFound
+	}
+	r.scans[id] = memoryScan{scan: *scan, updatedAt: time.Now()}
+	return nil
+}
+
+func (r *memoryScanRepository) DeleteBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, stored := range r.scans {
+		if stored.updatedAt.Before(before) {
+			delete(r.scans, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
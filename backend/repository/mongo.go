@@ -0,0 +1,739 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Document path each field of DomainSortFields sorts by
+var mongoSortPaths = map[string]string{
+	"host":          "host",
+	"grade":         "_gradeRank", // Computed by mongoRankFields
+	"verdict":       "_verdictRank",
+	"score":         "score",
+	"timestamp":     "timestamp",
+	"expiresInDays": "endpoints.certificate.expiresInDays",
+	"issuer":        "endpoints.certificate.issuer",
+	"protocol":      "endpoints.protocols",
+}
+
+/*
+Struct created to hold a domain report as it is stored in the domains_info collection, the version
+is increased on every update and used for the optimistic concurrency (ETag / If-Match)
+*/
+type domainDocument struct {
+	*scripts.FilteredTLSReport `bson:",inline"`
+	Version                    int64 `bson:"version"`
+}
+
+/*
+NewMongoRepositories creates the repositories backed by a MongoDB database, applying the pending migrations
+(indexes and validators) first
+Args:
+
+	client *mongo.Client: The connected MongoDB client
+	dbName string: The database name
+
+Returns:
+
+	*Repositories: Pointer of the repositories, Close disconnects the client
+	error: The error of the migration that failed
+*/
+func NewMongoRepositories(client *mongo.Client, dbName string) (*Repositories, error) {
+	db := client.Database(dbName)
+	applied, err := MigrateMongo(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) > 0 {
+		fmt.Printf("Applied MongoDB migrations %v\n", applied)
+	}
+
+	return &Repositories{
+		Domains:  &mongoDomainRepository{coll: db.Collection("domains_info")},
+		Policies: &mongoPolicyRepository{coll: db.Collection("policies")},
+		Scans:    &mongoScanRepository{coll: db.Collection("scans")},
+		Close:    client.Disconnect,
+	}, nil
+}
+
+type mongoDomainRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoDomainRepository) List(ctx context.Context, query DomainQuery) ([]DomainRecord, int64, error) {
+	filter := mongoDomainFilter(query)
+	total, err := r.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := r.find(ctx, filter, query, query.Offset(), query.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	var documents []bson.M
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, 0, err
+	}
+
+	records := make([]DomainRecord, len(documents))
+	for i, doc := range documents {
+		records[i] = mongoRecord(doc)
+	}
+	return records, total, nil
+}
+
+func (r *mongoDomainRepository) ForEach(ctx context.Context, query DomainQuery, fn func(*DomainRecord) error) error {
+	cursor, err := r.find(ctx, mongoDomainFilter(query), query, 0, 0)
+	if err != nil {
+		return err
+	}
+	return decodeEach(ctx, cursor, fn)
+}
+
+func (r *mongoDomainRepository) Get(ctx context.Context, id string) (*DomainRecord, error) {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, bson.M{"_id": objectID}, options.FindOne())
+}
+
+func (r *mongoDomainRepository) Latest(ctx context.Context, host string) (*DomainRecord, error) {
+	latest := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}) // The ObjectID grows with the insertion time
+	return r.findOne(ctx, bson.M{"host": host}, latest)
+}
+
+func (r *mongoDomainRepository) Insert(ctx context.Context, report *scripts.FilteredTLSReport) (string, error) {
+	result, err := r.coll.InsertOne(ctx, domainDocument{FilteredTLSReport: report, Version: 1})
+	if err != nil {
+		return "", err
+	}
+	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		return objectID.Hex(), nil
+	}
+	return fmt.Sprint(result.InsertedID), nil
+}
+
+func (r *mongoDomainRepository) Replace(ctx context.Context, id string, version int64, report *scripts.FilteredTLSReport) (int64, error) {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return 0, err
+	}
+	onlyVersion := options.FindOne().SetProjection(bson.M{"version": 1})
+
+	if version < 0 {
+		record, err := r.findOne(ctx, bson.M{"_id": objectID}, onlyVersion)
+		if err != nil {
+			return 0, err
+		}
+		version = record.Version
+	}
+
+	result, err := r.coll.ReplaceOne(ctx, versionFilter(objectID, version), domainDocument{FilteredTLSReport: report, Version: version + 1})
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		// Either the register does not exist or another request changed it first
+		record, err := r.findOne(ctx, bson.M{"_id": objectID}, onlyVersion)
+		if err != nil {
+			return 0, err
+		}
+		return 0, &VersionConflictError{Current: record.Version}
+	}
+	return version + 1, nil
+}
+
+func (r *mongoDomainRepository) Delete(ctx context.Context, id string) error {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return err
+	}
+	result, err := r.coll.DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoDomainRepository) ForEachBefore(ctx context.Context, before time.Time, fn func(*DomainRecord) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "host", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	return r.forEach(ctx, bson.M{"timestamp": bson.M{"$lt": before}}, opts, fn)
+}
+
+func (r *mongoDomainRepository) DeleteMany(ctx context.Context, ids []string) (int64, error) {
+	objectIDs := make([]primitive.ObjectID, len(ids))
+	for i, id := range ids {
+		objectID, err := parseObjectID(id)
+		if err != nil {
+			return 0, err
+		}
+		objectIDs[i] = objectID
+	}
+	result, err := r.coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": objectIDs}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoDomainRepository) Aggregate(ctx context.Context, pipeline []bson.D, maxTime time.Duration) ([]map[string]any, error) {
+	opts := options.Aggregate().SetMaxTime(maxTime).SetAllowDiskUse(false)
+	cursor, err := r.coll.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+
+	// maxTimeMS also applies to the getMore commands of cursor.All
+	var documents []bson.M
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, aggregateError(err)
+	}
+	result := make([]map[string]any, len(documents))
+	for i, doc := range documents {
+		result[i] = doc
+	}
+	return result, nil
+}
+
+/*
+aggregateError maps the MaxTimeMSExpired error of an aggregation to ErrTimeout
+Args:
+
+	err error: The error of the aggregate or getMore command
+
+Returns:
+
+	error: ErrTimeout if the server aborted the aggregation after maxTimeMS, err otherwise
+*/
+func aggregateError(err error) error {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(50) { // MaxTimeMSExpired
+		return ErrTimeout
+	}
+	return err
+}
+
+/*
+findOne reads a single register
+Args:
+
+	ctx context.Context: The context of the operation
+	filter bson.M: The filter
+	opts *options.FindOneOptions: The sort and projection
+
+Returns:
+
+	*DomainRecord: Pointer of the register
+	error: ErrNotFound if no register matches
+*/
+func (r *mongoDomainRepository) findOne(ctx context.Context, filter bson.M, opts *options.FindOneOptions) (*DomainRecord, error) {
+	var doc bson.M
+	if err := r.coll.FindOne(ctx, filter, opts).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	record := mongoRecord(doc)
+	return &record, nil
+}
+
+/*
+forEach calls fn with every register found by a query, decoding them one at a time from the cursor
+Args:
+
+	ctx context.Context: The context of the operation
+	filter any: The filter of the query
+	opts *options.FindOptions: The options of the query
+	fn func(*DomainRecord) error: The function called with each register, its error stops the iteration
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func (r *mongoDomainRepository) forEach(ctx context.Context, filter any, opts *options.FindOptions, fn func(*DomainRecord) error) error {
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return decodeEach(ctx, cursor, fn)
+}
+
+/*
+decodeEach calls fn with every register of a cursor, decoding them one at a time, and closes the cursor
+Args:
+
+	ctx context.Context: The context of the operation
+	cursor *mongo.Cursor: The cursor
+	fn func(*DomainRecord) error: The function called with each register, its error stops the iteration
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func decodeEach(ctx context.Context, cursor *mongo.Cursor, fn func(*DomainRecord) error) error {
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		record := mongoRecord(doc)
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+/*
+find runs the query of a domain list. A sort by grade or verdict needs the rank of the values, which is computed in
+an aggregation pipeline and removed from the documents; the other sorts use a plain find, which can use the indexes
+Args:
+
+	ctx context.Context: The context of the operation
+	filter bson.D: The filter of the query
+	query DomainQuery: The query, with the sort
+	skip int64: The registers to skip
+	limit int64: The maximum number of registers, 0 for all of them
+
+Returns:
+
+	*mongo.Cursor: The cursor of the registers
+	error: Any error encountered during the process
+*/
+func (r *mongoDomainRepository) find(ctx context.Context, filter bson.D, query DomainQuery, skip int64, limit int64) (*mongo.Cursor, error) {
+	sort := mongoSort(query)
+	rankFields := mongoRankFields(query)
+	if len(rankFields) == 0 {
+		opts := options.Find().SetSort(sort).SetSkip(skip)
+		if limit > 0 {
+			opts.SetLimit(limit)
+		}
+		return r.coll.Find(ctx, filter, opts)
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}, {{Key: "$addFields", Value: rankFields}}, {{Key: "$sort", Value: sort}}}
+	if skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: skip}})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	unset := make(bson.A, len(rankFields))
+	for i, field := range rankFields {
+		unset[i] = field.Key
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+	return r.coll.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+}
+
+/*
+mongoRankFields builds the computed rank of each field of the sort that is ordered by meaning (grade and verdict),
+a $switch over the known values
+Args:
+
+	query DomainQuery: The query
+
+Returns:
+
+	bson.D: The fields for $addFields, empty if the sort does not need them
+*/
+func mongoRankFields(query DomainQuery) bson.D {
+	var fields bson.D
+	for _, field := range query.Sort {
+		ranks, ranked := rankedSortFields[field.Field]
+		name := mongoSortPaths[field.Field]
+		if !ranked || slices.ContainsFunc(fields, func(e bson.E) bool { return e.Key == name }) {
+			continue
+		}
+		branches := bson.A{}
+		for _, value := range ranks.values() {
+			branches = append(branches, bson.D{
+				{Key: "case", Value: bson.D{{Key: "$eq", Value: bson.A{"$" + field.Field, value}}}},
+				{Key: "then", Value: ranks.rank(value)},
+			})
+		}
+		fields = append(fields, bson.E{Key: name, Value: bson.D{{Key: "$switch", Value: bson.D{
+			{Key: "branches", Value: branches},
+			{Key: "default", Value: ranks.unknown},
+		}}}})
+	}
+	return fields
+}
+
+/*
+mongoSort builds the MongoDB sort of a domain query, the ID breaks the ties so the pages are stable
+Args:
+
+	query DomainQuery: The query
+
+Returns:
+
+	bson.D: The sort
+*/
+func mongoSort(query DomainQuery) bson.D {
+	var sort bson.D
+	for _, field := range query.Sort {
+		order := 1
+		if field.Descending {
+			order = -1
+		}
+		sort = append(sort, bson.E{Key: mongoSortPaths[field.Field], Value: order})
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1})
+}
+
+/*
+mongoDomainFilter builds the MongoDB filter of a domain query
+Args:
+
+	query DomainQuery: The query
+
+Returns:
+
+	bson.D: The filter
+*/
+func mongoDomainFilter(query DomainQuery) bson.D {
+	filter := bson.D{}
+	if query.Host != "" {
+		filter = append(filter, bson.E{Key: "host", Value: bson.D{{Key: "$regex", Value: "^" + regexp.QuoteMeta(query.Host) + "$"}, {Key: "$options", Value: "i"}}})
+	}
+	if query.ScanRequestID != "" {
+		filter = append(filter, bson.E{Key: "scan.scanRequestID", Value: query.ScanRequestID})
+	}
+	if len(query.Grades) > 0 {
+		filter = append(filter, bson.E{Key: "grade", Value: bson.D{{Key: "$in", Value: query.Grades}}})
+	}
+	if len(query.Verdicts) > 0 {
+		filter = append(filter, bson.E{Key: "verdict", Value: bson.D{{Key: "$in", Value: query.Verdicts}}})
+	}
+	if scoreRange := mongoRange(query.MinScore, query.MaxScore); len(scoreRange) > 0 {
+		filter = append(filter, bson.E{Key: "score", Value: scoreRange})
+	}
+
+	// The conditions of the endpoint fields are matched on the same endpoint
+	var endpointConditions bson.D
+	if expiryRange := mongoRange(query.MinExpiresInDays, query.MaxExpiresInDays); len(expiryRange) > 0 {
+		endpointConditions = append(endpointConditions, bson.E{Key: "certificate.expiresInDays", Value: expiryRange})
+	}
+	if query.Issuer != "" {
+		endpointConditions = append(endpointConditions, bson.E{Key: "certificate.issuer", Value: bson.D{{Key: "$regex", Value: regexp.QuoteMeta(query.Issuer)}, {Key: "$options", Value: "i"}}})
+	}
+	if query.Protocol != "" {
+		endpointConditions = append(endpointConditions, bson.E{Key: "protocols", Value: query.Protocol})
+	}
+	if len(endpointConditions) > 0 {
+		filter = append(filter, bson.E{Key: "endpoints", Value: bson.D{{Key: "$elemMatch", Value: endpointConditions}}})
+	}
+
+	if dateRange := mongoRange(query.From, query.To); len(dateRange) > 0 {
+		filter = append(filter, bson.E{Key: "timestamp", Value: dateRange})
+	}
+	return filter
+}
+
+/*
+mongoRange builds a $gte/$lte condition from optional bounds
+Args:
+
+	lower *T: The lower bound, nil for none
+	upper *T: The upper bound, nil for none
+
+Returns:
+
+	bson.D: The condition, empty when there are no bounds
+*/
+func mongoRange[T any](lower *T, upper *T) bson.D {
+	condition := bson.D{}
+	if lower != nil {
+		condition = append(condition, bson.E{Key: "$gte", Value: *lower})
+	}
+	if upper != nil {
+		condition = append(condition, bson.E{Key: "$lte", Value: *upper})
+	}
+	return condition
+}
+
+/*
+versionFilter builds the filter that matches a register only if it has the given version,
+the registers stored before the versioning have no version field and count as version 0
+Args:
+
+	id primitive.ObjectID: The ID of the register
+	version int64: The expected version
+
+Returns:
+
+	bson.M: The filter
+*/
+func versionFilter(id primitive.ObjectID, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "$or": bson.A{bson.M{"version": 0}, bson.M{"version": bson.M{"$exists": false}}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
+
+/*
+mongoRecord converts a document of domains_info into a DomainRecord
+Args:
+
+	doc bson.M: The document obtained from MongoDB
+
+Returns:
+
+	DomainRecord: The record, the registers stored before the versioning have version 0
+*/
+func mongoRecord(doc bson.M) DomainRecord {
+	record := DomainRecord{Document: doc}
+	if objectID, ok := doc["_id"].(primitive.ObjectID); ok {
+		record.ID = objectID.Hex()
+	} else {
+		record.ID = fmt.Sprint(doc["_id"])
+	}
+	switch version := doc["version"].(type) {
+	case int64:
+		record.Version = version
+	case int32:
+		record.Version = int64(version)
+	case float64:
+		record.Version = int64(version)
+	}
+	return record
+}
+
+/*
+parseObjectID converts a domain ID into a MongoDB ObjectID
+Args:
+
+	id string: The ID, 24 hex digits
+
+Returns:
+
+	primitive.ObjectID: The ObjectID
+	error: ErrInvalidID if the ID does not have the ObjectID format
+*/
+func parseObjectID(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: %v", ErrInvalidID, err)
+	}
+	return objectID, nil
+}
+
+type mongoPolicyRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoPolicyRepository) Save(ctx context.Context, policy *scripts.Policy) error {
+	_, err := r.coll.ReplaceOne(ctx, bson.M{"name": policy.Name}, policy, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoPolicyRepository) List(ctx context.Context) ([]scripts.Policy, error) {
+	cursor, err := r.coll.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 0}))
+	if err != nil {
+		return nil, err
+	}
+	policies := []scripts.Policy{}
+	if err = cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (r *mongoPolicyRepository) Get(ctx context.Context, name string) (*scripts.Policy, error) {
+	var policy scripts.Policy
+	if err := r.coll.FindOne(ctx, bson.M{"name": name}).Decode(&policy); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *mongoPolicyRepository) Delete(ctx context.Context, name string) error {
+	result, err := r.coll.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+/*
+Struct created to hold a scan request as it is stored in the scans collection
+*/
+type scanDocument struct {
+	ID           string `bson:"_id"`
+	*ScanRequest `bson:",inline"`
+	UpdatedAt    time.Time `bson:"updatedAt"`
+}
+
+type mongoScanRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoScanRepository) Create(ctx context.Context, id string, scan *ScanRequest) error {
+	_, err := r.coll.InsertOne(ctx, scanDocument{ID: id, ScanRequest: scan, UpdatedAt: time.Now()})
+	return err
+}
+
+func (r *mongoScanRepository) Get(ctx context.Context, id string) (*ScanRequest, error) {
+	var doc scanDocument
+	if err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.ScanRequest, nil
+}
+
+func (r *mongoScanRepository) Update(ctx context.Context, id string, scan *ScanRequest) error {
+	result, err := r.coll.ReplaceOne(ctx, bson.M{"_id": id}, scanDocument{ID: id, ScanRequest: scan, UpdatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoScanRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.coll.DeleteMany(ctx, bson.M{"updatedAt": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+/*
+Struct created to hold a file of the raw reports GridFS bucket, only the fields that are read
+*/
+type gridFSRawReport struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Metadata struct {
+		Encoding string `bson:"encoding"`
+	} `bson:"metadata"`
+}
+
+type gridFSRawReportRepository struct {
+	bucket   *gridfs.Bucket
+	encoding string
+}
+
+/*
+NewGridFSRawReports creates a raw report repository that stores the reports in the GridFS bucket raw_reports,
+the file name is the scan request ID and the compression is kept in the metadata
+Args:
+
+	db *mongo.Database: The database
+	encoding string: The compression of the new reports (gzip or zstd)
+
+Returns:
+
+	RawReportRepository: The repository
+	error: Any error encountered during the process
+*/
+func NewGridFSRawReports(db *mongo.Database, encoding string) (RawReportRepository, error) {
+	if !IsValidRawEncoding(encoding) {
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName("raw_reports"))
+	if err != nil {
+		return nil, err
+	}
+	return &gridFSRawReportRepository{bucket: bucket, encoding: encoding}, nil
+}
+
+func (r *gridFSRawReportRepository) Save(ctx context.Context, id string, raw []byte) (*RawReportRef, error) {
+	data, ref, err := encodeRawReport(id, r.encoding, raw)
+	if err != nil {
+		return nil, err
+	}
+	metadata := bson.M{"encoding": ref.Encoding, "size": ref.Size}
+	fileID, err := r.bucket.UploadFromStream(id, bytes.NewReader(data), options.GridFSUpload().SetMetadata(metadata))
+	if err != nil {
+		return nil, err
+	}
+
+	// The previous reports of the scan request are removed once the new one is complete
+	cursor, err := r.bucket.FindContext(ctx, bson.M{"filename": id, "_id": bson.M{"$ne": fileID}})
+	if err != nil {
+		return nil, err
+	}
+	var previous []gridFSRawReport
+	if err := cursor.All(ctx, &previous); err != nil {
+		return nil, err
+	}
+	for _, file := range previous {
+		if err := r.bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, err
+		}
+	}
+	return ref, nil
+}
+
+func (r *gridFSRawReportRepository) Load(ctx context.Context, id string) ([]byte, error) {
+	latest := options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: -1}}).SetLimit(1)
+	cursor, err := r.bucket.FindContext(ctx, bson.M{"filename": id}, latest)
+	if err != nil {
+		return nil, err
+	}
+	var files []gridFSRawReport
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var data bytes.Buffer
+	if _, err := r.bucket.DownloadToStream(files[0].ID, &data); err != nil {
+		return nil, err
+	}
+	return decompressRaw(files[0].Metadata.Encoding, data.Bytes())
+}
+
+func (r *gridFSRawReportRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	cursor, err := r.bucket.FindContext(ctx, bson.M{"uploadDate": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	var files []gridFSRawReport
+	if err := cursor.All(ctx, &files); err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, file := range files { // GridFS removes a file and its chunks one at a time
+		if err := r.bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
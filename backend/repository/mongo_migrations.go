@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+Struct created to hold a migration of the MongoDB storage, the migrations are applied in order on startup and
+recorded in the migrations collection. They must be idempotent: two servers starting at the same time can both
+apply a migration before one of them records it
+*/
+type mongoMigration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+/*
+Struct created to hold a migration as it is recorded in the migrations collection
+*/
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// Migrations of the MongoDB storage, a migration must never be changed once released: add a new one instead
+var mongoMigrations = []mongoMigration{
+	{
+		Version: 1,
+		Name:    "domains_info indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("domains_info"), []mongo.IndexModel{
+				// The latest report of a host (compliance, PUT /domains/:host/report)
+				{Keys: bson.D{{Key: "host", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("host_latest")},
+				{Keys: bson.D{{Key: "timestamp", Value: -1}}, Options: options.Index().SetName("timestamp")},
+				{Keys: bson.D{{Key: "grade", Value: 1}}, Options: options.Index().SetName("grade")},
+				{Keys: bson.D{{Key: "verdict", Value: 1}}, Options: options.Index().SetName("verdict")},
+				{Keys: bson.D{{Key: "score", Value: 1}}, Options: options.Index().SetName("score")},
+				{Keys: bson.D{{Key: "endpoints.certificate.expiresInDays", Value: 1}}, Options: options.Index().SetName("certificate_expiry")},
+			})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "scans indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// No TTL index: the retention job removes the old scan requests according to its configured age
+			return createIndexes(ctx, db.Collection("scans"), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "status", Value: 1}}, Options: options.Index().SetName("status")},
+				{Keys: bson.D{{Key: "updatedAt", Value: 1}}, Options: options.Index().SetName("updated_at")},
+			})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "policies unique name",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("policies"), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetName("name").SetUnique(true)},
+			})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "JSON schema validators",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := setValidator(ctx, db, "domains_info", domainsInfoSchema); err != nil {
+				return err
+			}
+			if err := setValidator(ctx, db, "scans", scansSchema); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "policies", policiesSchema)
+		},
+	},
+}
+
+// Validator of domains_info, it only checks the fields the queries rely on, scripts.ValidateReport checks the rest
+var domainsInfoSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"host", "timestamp"},
+	"properties": bson.M{
+		"host":      bson.M{"bsonType": "string", "minLength": 1},
+		"timestamp": bson.M{"bsonType": "date"},
+		"grade":     bson.M{"bsonType": "string"},
+		"verdict":   bson.M{"bsonType": "string"},
+		"score":     bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0, "maximum": 100},
+		"version":   bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+		"endpoints": bson.M{"bsonType": bson.A{"array", "null"}},
+	},
+}
+
+var scansSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"status", "updatedAt"},
+	"properties": bson.M{
+		"status":    bson.M{"bsonType": "string"},
+		"updatedAt": bson.M{"bsonType": "date"},
+	},
+}
+
+var policiesSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"name", "rules"},
+	"properties": bson.M{
+		"name":  bson.M{"bsonType": "string", "minLength": 1},
+		"rules": bson.M{"bsonType": "object"},
+	},
+}
+
+/*
+MigrateMongo applies the migrations of mongoMigrations that are not recorded in the migrations collection
+Args:
+
+	ctx context.Context: The context of the operation
+	db *mongo.Database: The database
+
+Returns:
+
+	[]int: The versions applied by this call
+	error: The error of the first migration that fails, the following ones are not applied
+*/
+func MigrateMongo(ctx context.Context, db *mongo.Database) ([]int, error) {
+	coll := db.Collection("migrations")
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("reading the applied migrations: %v", err)
+	}
+	var applied []appliedMigration
+	if err := cursor.All(ctx, &applied); err != nil {
+		return nil, fmt.Errorf("reading the applied migrations: %v", err)
+	}
+	done := map[int]bool{}
+	for _, migration := range applied {
+		done[migration.Version] = true
+	}
+
+	var versions []int
+	for _, migration := range mongoMigrations {
+		if done[migration.Version] {
+			continue
+		}
+		if err := migration.Up(ctx, db); err != nil {
+			return versions, fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Name, err)
+		}
+		_, err := coll.InsertOne(ctx, appliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()})
+		if err != nil && !mongo.IsDuplicateKeyError(err) { // Recorded by another server first
+			return versions, fmt.Errorf("recording migration %d (%s): %v", migration.Version, migration.Name, err)
+		}
+		versions = append(versions, migration.Version)
+	}
+	return versions, nil
+}
+
+/*
+createIndexes creates the indexes of a collection, creating an index that already exists with the same keys and options does nothing
+Args:
+
+	ctx context.Context: The context of the operation
+	coll *mongo.Collection: The collection
+	models []mongo.IndexModel: The indexes
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func createIndexes(ctx context.Context, coll *mongo.Collection, models []mongo.IndexModel) error {
+	_, err := coll.Indexes().CreateMany(ctx, models)
+	return err
+}
+
+/*
+setValidator sets the JSON schema validator of a collection, creating the collection if it does not exist.
+The validation level is moderate, so the documents stored before the validator can still be updated
+Args:
+
+	ctx context.Context: The context of the operation
+	db *mongo.Database: The database
+	name string: The collection name
+	schema bson.M: The JSON schema
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func setValidator(ctx context.Context, db *mongo.Database, name string, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(26) { // NamespaceNotFound
+		opts := options.CreateCollection().SetValidator(validator).SetValidationLevel("moderate").SetValidationAction("error")
+		err = db.CreateCollection(ctx, name, opts)
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(48) { // NamespaceExists: created by another server meanwhile
+			return setValidator(ctx, db, name, schema)
+		}
+	}
+	return err
+}
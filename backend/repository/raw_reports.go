@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of the raw reports
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// Compression used when none is configured
+const DefaultRawEncoding = EncodingZstd
+
+// File extension of each compression
+var rawEncodingExtensions = map[string]string{EncodingGzip: ".gz", EncodingZstd: ".zst"}
+
+// The scan request IDs are UUIDs, anything else could escape the directory of the filesystem store
+var rawReportIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+/*
+Struct created to hold the reference of a scan request to its stored raw SSL Labs report
+*/
+type RawReportRef struct {
+	Encoding   string    `json:"encoding"`   // Compression of the stored report (gzip or zstd)
+	Size       int64     `json:"size"`       // Size of the report in bytes
+	StoredSize int64     `json:"storedSize"` // Size of the compressed report in bytes
+	StoredAt   time.Time `json:"storedAt"`
+}
+
+/*
+RawReportRepository stores the raw SSL Labs reports of the scans compressed, by the scan request ID
+*/
+type RawReportRepository interface {
+	// Save compresses and stores the raw report of a scan request, replacing the previous one (ErrInvalidID)
+	Save(ctx context.Context, id string, raw []byte) (*RawReportRef, error)
+	// Load returns the decompressed raw report of a scan request (ErrNotFound, ErrInvalidID)
+	Load(ctx context.Context, id string) ([]byte, error)
+	// DeleteBefore removes the raw reports stored before the given time and returns how many were removed
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+/*
+IsValidRawEncoding checks if the given compression is supported
+Args:
+
+	encoding string: The compression name
+
+Returns:
+
+	bool: True if it is gzip or zstd
+*/
+func IsValidRawEncoding(encoding string) bool {
+	return encoding == EncodingGzip || encoding == EncodingZstd
+}
+
+/*
+compressRaw compresses a raw report
+Args:
+
+	encoding string: The compression (gzip or zstd)
+	raw []byte: The report
+
+Returns:
+
+	[]byte: The compressed report
+	error: Any error encountered during the process
+*/
+func compressRaw(encoding string, raw []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		writer = gzip.NewWriter(&buffer)
+	case EncodingZstd:
+		encoder, err := zstd.NewWriter(&buffer)
+		if err != nil {
+			return nil, err
+		}
+		writer = encoder
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+	if _, err := writer.Write(raw); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+decompressRaw decompresses a stored raw report
+Args:
+
+	encoding string: The compression (gzip or zstd)
+	data []byte: The compressed report
+
+Returns:
+
+	[]byte: The report
+	error: Any error encountered during the process
+*/
+func decompressRaw(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+}
+
+/*
+encodeRawReport validates the scan request ID and compresses its raw report
+Args:
+
+	id string: The scan request ID
+	encoding string: The compression
+	raw []byte: The report
+
+Returns:
+
+	[]byte: The compressed report
+	*RawReportRef: Pointer to the reference of the report
+	error: Any error encountered during the process
+*/
+func encodeRawReport(id string, encoding string, raw []byte) ([]byte, *RawReportRef, error) {
+	if !rawReportIDPattern.MatchString(id) {
+		return nil, nil, ErrInvalidID
+	}
+	data, err := compressRaw(encoding, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, &RawReportRef{Encoding: encoding, Size: int64(len(raw)), StoredSize: int64(len(data)), StoredAt: time.Now().UTC()}, nil
+}
+
+/*
+Struct created to hold the raw reports in files of a directory, named <scan request ID>.json.gz or .json.zst
+*/
+type fileRawReportRepository struct {
+	dir      string
+	encoding string
+}
+
+/*
+NewFileRawReports creates a raw report repository that stores the reports as files in a directory
+Args:
+
+	dir string: The directory, created if it does not exist
+	encoding string: The compression of the new reports (gzip or zstd)
+
+Returns:
+
+	RawReportRepository: The repository
+	error: Any error encountered during the process
+*/
+func NewFileRawReports(dir string, encoding string) (RawReportRepository, error) {
+	if !IsValidRawEncoding(encoding) {
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileRawReportRepository{dir: dir, encoding: encoding}, nil
+}
+
+func (r *fileRawReportRepository) path(id string, encoding string) string {
+	return filepath.Join(r.dir, id+".json"+rawEncodingExtensions[encoding])
+}
+
+func (r *fileRawReportRepository) Save(_ context.Context, id string, raw []byte) (*RawReportRef, error) {
+	data, ref, err := encodeRawReport(id, r.encoding, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Written to a temporary file and renamed, so a report is never read half written
+	file, err := os.CreateTemp(r.dir, "."+id+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(file.Name(), r.path(id, r.encoding)); err != nil {
+		return nil, err
+	}
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} { // A previous report with another compression
+		if encoding != r.encoding {
+			os.Remove(r.path(id, encoding))
+		}
+	}
+	return ref, nil
+}
+
+func (r *fileRawReportRepository) Load(_ context.Context, id string) ([]byte, error) {
+	if !rawReportIDPattern.MatchString(id) {
+		return nil, ErrInvalidID
+	}
+	// The reports saved before a change of compression keep their own one
+	for _, encoding := range []string{r.encoding, EncodingGzip, EncodingZstd} {
+		data, err := os.ReadFile(r.path(id, encoding))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return decompressRaw(encoding, data)
+	}
+	return nil, ErrNotFound
+}
+
+func (r *fileRawReportRepository) DeleteBefore(_ context.Context, before time.Time) (int64, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, entry := range entries {
+		name := entry.Name()
+		id, encoding, ok := rawReportFileName(name)
+		if !ok || entry.IsDir() || !rawReportIDPattern.MatchString(id) || !IsValidRawEncoding(encoding) {
+			continue // Temporary files and anything else that is not a report
+		}
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+/*
+rawReportFileName splits the name of a report file into the scan request ID and the compression
+Args:
+
+	name string: The file name, <scan request ID>.json.gz or .json.zst
+
+Returns:
+
+	string: The scan request ID
+	string: The compression
+	bool: False if the name does not have a report extension
+*/
+func rawReportFileName(name string) (string, string, bool) {
+	for encoding, extension := range rawEncodingExtensions {
+		if id, found := strings.CutSuffix(name, ".json"+extension); found {
+			return id, encoding, true
+		}
+	}
+	return "", "", false
+}
+
+/*
+Struct created to hold a compressed raw report stored in memory
+*/
+type memoryRawReport struct {
+	encoding string
+	data     []byte
+	storedAt time.Time
+}
+
+type memoryRawReportRepository struct {
+	mu       sync.RWMutex
+	encoding string
+	reports  map[string]memoryRawReport
+}
+
+/*
+NewMemoryRawReports creates a raw report repository that keeps the reports in memory, they are lost when the server stops
+Args:
+
+	encoding string: The compression of the reports (gzip or zstd)
+
+Returns:
+
+	RawReportRepository: The repository
+	error: An error if the compression is not supported
+*/
+func NewMemoryRawReports(encoding string) (RawReportRepository, error) {
+	if !IsValidRawEncoding(encoding) {
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+	return &memoryRawReportRepository{encoding: encoding, reports: map[string]memoryRawReport{}}, nil
+}
+
+func (r *memoryRawReportRepository) Save(_ context.Context, id string, raw []byte) (*RawReportRef, error) {
+	data, ref, err := encodeRawReport(id, r.encoding, raw)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports[id] = memoryRawReport{encoding: r.encoding, data: data, storedAt: ref.StoredAt}
+	return ref, nil
+}
+
+func (r *memoryRawReportRepository) Load(_ context.Context, id string) ([]byte, error) {
+	r.mu.RLock()
+	report, exists := r.reports[id]
+	r.mu.RUnlock()
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return decompressRaw(report.encoding, report.data)
+}
+
+func (r *memoryRawReportRepository) DeleteBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, report := range r.reports {
+		if report.storedAt.Before(before) {
+			delete(r.reports, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// ErrNotFound is returned when the requested register does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID is returned when a domain ID does not have the expected format (a 24 hex digits ObjectID)
+	ErrInvalidID = errors.New("invalid ID")
+	// ErrUnsupported is returned by the operations a storage backend cannot run (e.g. MongoDB pipelines in memory)
+	ErrUnsupported = errors.New("operation not supported by the storage backend")
+	// ErrTimeout is returned when an operation exceeds its time limit
+	ErrTimeout = errors.New("operation timed out")
+)
+
+/*
+VersionConflictError is returned when a register is replaced with an expected version that is not the stored one
+*/
+type VersionConflictError struct {
+	Current int64 // The version currently stored
+}
+
+/*
+Error describes the conflict
+Returns:
+
+	string: The message with the current version
+*/
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict, current version: %d", e.Current)
+}
+
+/*
+Struct created to hold a stored domain report, the document keeps the JSON field names of FilteredTLSReport
+plus _id and version, registers stored before the typed reports may have other shapes
+*/
+type DomainRecord struct {
+	ID       string
+	Version  int64
+	Document map[string]any
+}
+
+/*
+Report converts the document of the record into the FilteredTLSReport struct
+Returns:
+
+	*scripts.FilteredTLSReport: Pointer of the decoded report
+	error: Any error encountered during the process
+*/
+func (r *DomainRecord) Report() (*scripts.FilteredTLSReport, error) {
+	raw, err := json.Marshal(r.Document)
+	if err != nil {
+		return nil, err
+	}
+	var report scripts.FilteredTLSReport
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+/*
+jsonRecord builds a DomainRecord from a report written in JSON, the document has the same fields the API exposes
+Args:
+
+	id string: The ID of the register
+	version int64: The version of the register
+	raw []byte: The report in JSON
+
+Returns:
+
+	*DomainRecord: Pointer of the record
+	error: Any error encountered during the process
+*/
+func jsonRecord(id string, version int64, raw []byte) (*DomainRecord, error) {
+	var document map[string]any
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	document["_id"] = id
+	document["version"] = version
+	return &DomainRecord{ID: id, Version: version, Document: document}, nil
+}
+
+// Fields GET /domains-info can sort by
+var DomainSortFields = []string{"host", "grade", "verdict", "score", "timestamp", "expiresInDays", "issuer", "protocol"}
+
+/*
+Struct created to hold the ranks of the values of a sort field that is ordered by meaning instead of alphabetically
+*/
+type valueRanks struct {
+	ranks   map[string]int
+	unknown int // Rank of the values that are not in ranks
+}
+
+// Sort fields ordered from the worst to the best value (F < ... < A+, VERY_POOR < ... < EXCELLENT)
+var rankedSortFields = map[string]valueRanks{
+	"grade":   newValueRanks(scripts.GradePriorities),
+	"verdict": newValueRanks(scripts.VerdictPriorities),
+}
+
+func newValueRanks(priorities func() (map[string]int, int)) valueRanks {
+	ranks, unknown := priorities()
+	return valueRanks{ranks: ranks, unknown: unknown}
+}
+
+// rank returns the rank of a value
+func (v valueRanks) rank(value string) int {
+	if rank, ok := v.ranks[value]; ok {
+		return rank
+	}
+	return v.unknown
+}
+
+// values returns the ranked values in a stable order, so the generated queries do not change between calls
+func (v valueRanks) values() []string {
+	values := make([]string, 0, len(v.ranks))
+	for value := range v.ranks {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+/*
+Struct created to hold a sort field of a DomainQuery
+*/
+type SortField struct {
+	Field      string // One of DomainSortFields
+	Descending bool
+}
+
+/*
+Struct created to hold the filters, sort and page of a domain list, the zero value of a filter disables it.
+The endpoint conditions (expiry range, issuer and protocol) must be met by the same endpoint
+*/
+type DomainQuery struct {
+	Host             string   // Exact host, case-insensitive
+	Grades           []string // Any of the grades
+	Verdicts         []string // Any of the verdicts
+	MinScore         *int
+	MaxScore         *int
+	MinExpiresInDays *float64
+	MaxExpiresInDays *float64
+	Issuer           string // Fragment of the certificate issuer, case-insensitive
+	Protocol         string // Protocol supported by the endpoint
+	From             *time.Time
+	To               *time.Time
+	ScanRequestID    string      // The scan request the report was generated from (scan.scanRequestID)
+	Sort             []SortField // The ID is always used as the last sort field so the pages are stable
+	Page             int64       // From 1
+	Limit            int64
+}
+
+/*
+Offset returns the number of registers before the page of the query, capped at math.MaxInt64 so it never overflows
+Returns:
+
+	int64: The registers to skip, 0 for the first page (or a page lower than 1)
+*/
+func (q DomainQuery) Offset() int64 {
+	if q.Page <= 1 || q.Limit <= 0 {
+		return 0
+	}
+	if q.Page-1 > math.MaxInt64/q.Limit {
+		return math.MaxInt64
+	}
+	return (q.Page - 1) * q.Limit
+}
+
+/*
+DomainRepository stores the filtered domain reports (the domains_info collection)
+*/
+type DomainRepository interface {
+	// List returns the page of registers that match the query and the total number of matching registers
+	List(ctx context.Context, query DomainQuery) ([]DomainRecord, int64, error)
+	// Get returns a register by its ID (ErrNotFound, ErrInvalidID)
+	Get(ctx context.Context, id string) (*DomainRecord, error)
+	// Latest returns the most recently inserted register of a host (ErrNotFound)
+	Latest(ctx context.Context, host string) (*DomainRecord, error)
+	// Insert stores a report as a new register with version 1 and returns its ID
+	Insert(ctx context.Context, report *scripts.FilteredTLSReport) (string, error)
+	// Replace replaces a register only if it has the expected version (-1 for any), returning the new version
+	// (ErrNotFound, ErrInvalidID, *VersionConflictError)
+	Replace(ctx context.Context, id string, version int64, report *scripts.FilteredTLSReport) (int64, error)
+	// Delete removes a register by its ID (ErrNotFound, ErrInvalidID)
+	Delete(ctx context.Context, id string) error
+	// ForEach calls fn with every register matching the filters and sort of a query, ignoring its page, stopping at
+	// the first error of fn. The documents are read as fn needs them instead of being loaded at once (the memory
+	// backend only keeps the list of matching registers)
+	ForEach(ctx context.Context, query DomainQuery, fn func(*DomainRecord) error) error
+	// ForEachBefore calls fn with every register whose report timestamp is before the given time, sorted by host
+	// and newest first, stopping at the first error of fn. fn must not write to the repository
+	ForEachBefore(ctx context.Context, before time.Time, fn func(*DomainRecord) error) error
+	// DeleteMany removes registers by their IDs and returns how many were removed (ErrInvalidID)
+	DeleteMany(ctx context.Context, ids []string) (int64, error)
+	// Aggregate runs a validated MongoDB pipeline aborting it after maxTime (ErrTimeout, ErrUnsupported)
+	Aggregate(ctx context.Context, pipeline []bson.D, maxTime time.Duration) ([]map[string]any, error)
+}
+
+/*
+PolicyRepository stores the verdict policies by name (the policies collection)
+*/
+type PolicyRepository interface {
+	// Save creates or replaces the policy with the same name
+	Save(ctx context.Context, policy *scripts.Policy) error
+	List(ctx context.Context) ([]scripts.Policy, error)
+	// Get returns a policy by its name (ErrNotFound)
+	Get(ctx context.Context, name string) (*scripts.Policy, error)
+	// Delete removes a policy by its name (ErrNotFound)
+	Delete(ctx context.Context, name string) error
+}
+
+/*
+Struct created to hold the status and result of a scan request
+*/
+type ScanRequest struct {
+	Status         string                     `json:"status"`
+	Result         []byte                     `json:"result"` // Store the TLS assessment result
+	FilteredResult *scripts.FilteredTLSReport `json:"filteredResult"`
+	Error          string                     `json:"error"`
+	RawReport      *RawReportRef              `json:"rawReport,omitempty"` // The stored raw report, nil when it was not kept
+}
+
+/*
+ScanRepository stores the scan requests started with /start-scan
+*/
+type ScanRepository interface {
+	// Create stores a new scan request
+	Create(ctx context.Context, id string, scan *ScanRequest) error
+	// Get returns a scan request by its ID (ErrNotFound)
+	Get(ctx context.Context, id string) (*ScanRequest, error)
+	// Update replaces a scan request (ErrNotFound)
+	Update(ctx context.Context, id string, scan *ScanRequest) error
+	// DeleteBefore removes the scan requests last updated before the given time and returns how many were removed
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+/*
+Struct created to hold the repositories the handlers depend on
+*/
+type Repositories struct {
+	Domains    DomainRepository
+	Policies   PolicyRepository
+	Scans      ScanRepository
+	RawReports RawReportRepository             // Raw SSL Labs reports of the scans, nil when they are not kept
+	Close      func(ctx context.Context) error // Releases the storage connection
+}
@@ -0,0 +1,720 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nebula-Challenge/scripts"
+	_ "github.com/mattn/go-sqlite3" // Registers the sqlite3 driver
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+Struct created to hold a schema migration of the SQLite storage, the migrations are applied in order on startup
+and recorded in the schema_migrations table
+*/
+type sqliteMigration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// IDs removed per DELETE statement, below the SQLite limit of query parameters
+const sqliteDeleteBatch = 500
+
+// Schema of the SQLite storage, a migration must never be changed once released: add a new one instead
+var sqliteMigrations = []sqliteMigration{
+	{
+		Version: 1,
+		Name:    "create domains, policies and scans",
+		Statements: []string{
+			// The report is kept as JSON in document, the columns hold the fields the list filters and sorts by
+			`CREATE TABLE domains (
+				seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				id TEXT NOT NULL UNIQUE,
+				host TEXT NOT NULL,
+				grade TEXT NOT NULL DEFAULT '',
+				verdict TEXT NOT NULL DEFAULT '',
+				score INTEGER NOT NULL DEFAULT 0,
+				timestamp INTEGER NOT NULL,
+				version INTEGER NOT NULL,
+				document TEXT NOT NULL
+			)`,
+			`CREATE INDEX domains_host ON domains (host COLLATE NOCASE)`,
+			`CREATE INDEX domains_host_latest ON domains (host, seq)`,
+			`CREATE INDEX domains_timestamp ON domains (timestamp)`,
+			`CREATE INDEX domains_grade ON domains (grade)`,
+			`CREATE INDEX domains_score ON domains (score)`,
+			`CREATE TABLE policies (
+				name TEXT PRIMARY KEY,
+				document TEXT NOT NULL
+			)`,
+			`CREATE TABLE scans (
+				id TEXT PRIMARY KEY,
+				status TEXT NOT NULL,
+				result BLOB,
+				filtered_result TEXT,
+				error TEXT NOT NULL DEFAULT '',
+				updated_at INTEGER NOT NULL
+			)`,
+			`CREATE INDEX scans_status ON scans (status)`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "raw report reference of the scans",
+		Statements: []string{
+			`ALTER TABLE scans ADD COLUMN raw_report TEXT`,
+		},
+	},
+}
+
+// SQL expression each field of DomainSortFields sorts by, the endpoint fields use the smallest value
+// in ascending order and the largest in descending order, like MongoDB does with arrays
+var sqliteSortExpressions = map[string][2]string{
+	"host":          {"d.host", "d.host"},
+	"grade":         {sqliteRankCase("d.grade", rankedSortFields["grade"]), sqliteRankCase("d.grade", rankedSortFields["grade"])},
+	"verdict":       {sqliteRankCase("d.verdict", rankedSortFields["verdict"]), sqliteRankCase("d.verdict", rankedSortFields["verdict"])},
+	"score":         {"d.score", "d.score"},
+	"timestamp":     {"d.timestamp", "d.timestamp"},
+	"expiresInDays": {sqliteEndpointAggregate("MIN", "$.certificate.expiresInDays"), sqliteEndpointAggregate("MAX", "$.certificate.expiresInDays")},
+	"issuer":        {sqliteEndpointAggregate("MIN", "$.certificate.issuer"), sqliteEndpointAggregate("MAX", "$.certificate.issuer")},
+	"protocol": {
+		"(SELECT MIN(p.value) FROM json_each(d.document, '$.endpoints') e, json_each(e.value, '$.protocols') p)",
+		"(SELECT MAX(p.value) FROM json_each(d.document, '$.endpoints') e, json_each(e.value, '$.protocols') p)",
+	},
+}
+
+/*
+sqliteRankCase builds the CASE expression that sorts a column by the rank of its values
+Args:
+
+	column string: The column
+	ranks valueRanks: The ranks of the values, they are constants so they are written in the expression
+
+Returns:
+
+	string: The expression
+*/
+func sqliteRankCase(column string, ranks valueRanks) string {
+	var expression strings.Builder
+	expression.WriteString("CASE " + column)
+	for _, value := range ranks.values() {
+		fmt.Fprintf(&expression, " WHEN '%s' THEN %d", strings.ReplaceAll(value, "'", "''"), ranks.rank(value))
+	}
+	fmt.Fprintf(&expression, " ELSE %d END", ranks.unknown)
+	return expression.String()
+}
+
+/*
+sqliteEndpointAggregate builds the subquery that aggregates a field over the endpoints of a report
+Args:
+
+	function string: The SQL aggregate function (MIN or MAX)
+	path string: The JSON path of the field inside an endpoint
+
+Returns:
+
+	string: The subquery
+*/
+func sqliteEndpointAggregate(function string, path string) string {
+	return fmt.Sprintf("(SELECT %s(json_extract(e.value, '%s')) FROM json_each(d.document, '$.endpoints') e)", function, path)
+}
+
+/*
+NewSQLiteRepositories opens (or creates) a SQLite database file and applies the pending schema migrations
+Args:
+
+	path string: The path of the database file
+
+Returns:
+
+	*Repositories: Pointer of the repositories, Close closes the database
+	error: Any error encountered opening the database or migrating it
+*/
+func NewSQLiteRepositories(path string) (*Repositories, error) {
+	// WAL lets the readers work while a write is in progress, busy_timeout waits for the lock instead of failing
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateSQLite(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Repositories{
+		Domains:  &sqliteDomainRepository{db: db},
+		Policies: &sqlitePolicyRepository{db: db},
+		Scans:    &sqliteScanRepository{db: db},
+		Close:    func(context.Context) error { return db.Close() },
+	}, nil
+}
+
+/*
+migrateSQLite applies the migrations of sqliteMigrations that are not recorded in schema_migrations,
+each one in its own transaction
+Args:
+
+	ctx context.Context: The context of the operation
+	db *sql.DB: The database
+
+Returns:
+
+	error: The error of the first migration that fails
+*/
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %v", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("reading schema_migrations: %v", err)
+	}
+
+	for _, migration := range sqliteMigrations {
+		if migration.Version <= current {
+			continue
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, statement := range migration.Statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			migration.Version, migration.Name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+type sqliteDomainRepository struct {
+	db *sql.DB
+}
+
+func (r *sqliteDomainRepository) List(ctx context.Context, query DomainQuery) ([]DomainRecord, int64, error) {
+	where, args := sqliteDomainFilter(query)
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM domains d`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT d.id, d.version, d.document FROM domains d`+where+
+		` ORDER BY `+sqliteOrderBy(query)+` LIMIT ? OFFSET ?`,
+		append(args, query.Limit, query.Offset())...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	records := []DomainRecord{}
+	for rows.Next() {
+		record, err := scanDomainRow(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, *record)
+	}
+	return records, total, rows.Err()
+}
+
+func (r *sqliteDomainRepository) ForEach(ctx context.Context, query DomainQuery, fn func(*DomainRecord) error) error {
+	where, args := sqliteDomainFilter(query)
+	return r.forEach(ctx, `SELECT d.id, d.version, d.document FROM domains d`+where+` ORDER BY `+sqliteOrderBy(query), args, fn)
+}
+
+func (r *sqliteDomainRepository) Get(ctx context.Context, id string) (*DomainRecord, error) {
+	if _, err := parseObjectID(id); err != nil {
+		return nil, err
+	}
+	return scanDomainRow(r.db.QueryRowContext(ctx, `SELECT id, version, document FROM domains WHERE id = ?`, id))
+}
+
+func (r *sqliteDomainRepository) Latest(ctx context.Context, host string) (*DomainRecord, error) {
+	return scanDomainRow(r.db.QueryRowContext(ctx, `SELECT id, version, document FROM domains WHERE host = ? ORDER BY seq DESC LIMIT 1`, host))
+}
+
+func (r *sqliteDomainRepository) Insert(ctx context.Context, report *scripts.FilteredTLSReport) (string, error) {
+	document, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	id := primitive.NewObjectID().Hex() // Same ID format as MongoDB, so the API does not depend on the backend
+	_, err = r.db.ExecContext(ctx, `INSERT INTO domains (id, host, grade, verdict, score, timestamp, version, document) VALUES (?, ?, ?, ?, ?, ?, 1, ?)`,
+		id, report.Host, report.Grade, report.Verdict, report.Score, report.Timestamp.UnixNano(), string(document))
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (r *sqliteDomainRepository) Replace(ctx context.Context, id string, version int64, report *scripts.FilteredTLSReport) (int64, error) {
+	if _, err := parseObjectID(id); err != nil {
+		return 0, err
+	}
+	document, err := json.Marshal(report)
+	if err != nil {
+		return 0, err
+	}
+
+	var newVersion int64
+	err = r.db.QueryRowContext(ctx, `UPDATE domains SET host = ?, grade = ?, verdict = ?, score = ?, timestamp = ?, document = ?, version = version + 1
+		WHERE id = ? AND (? < 0 OR version = ?) RETURNING version`,
+		report.Host, report.Grade, report.Verdict, report.Score, report.Timestamp.UnixNano(), string(document), id, version, version).Scan(&newVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the register does not exist or another request changed it first
+		var current int64
+		err = r.db.QueryRowContext(ctx, `SELECT version FROM domains WHERE id = ?`, id).Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 0, &VersionConflictError{Current: current}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return newVersion, nil
+}
+
+func (r *sqliteDomainRepository) Delete(ctx context.Context, id string) error {
+	if _, err := parseObjectID(id); err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx, `DELETE FROM domains WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqliteDomainRepository) ForEachBefore(ctx context.Context, before time.Time, fn func(*DomainRecord) error) error {
+	return r.forEach(ctx, `SELECT id, version, document FROM domains WHERE timestamp < ? ORDER BY host, timestamp DESC, seq DESC`, []any{before.UnixNano()}, fn)
+}
+
+/*
+forEach calls fn with every register returned by a query, reading them one at a time
+Args:
+
+	ctx context.Context: The context of the operation
+	query string: The query, it must select the id, version and document columns
+	args []any: The arguments of the query
+	fn func(*DomainRecord) error: The function called with each register, its error stops the iteration
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func (r *sqliteDomainRepository) forEach(ctx context.Context, query string, args []any, fn func(*DomainRecord) error) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scanDomainRow(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *sqliteDomainRepository) DeleteMany(ctx context.Context, ids []string) (int64, error) {
+	for _, id := range ids {
+		if _, err := parseObjectID(id); err != nil {
+			return 0, err
+		}
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for start := 0; start < len(ids); start += sqliteDeleteBatch {
+		batch := ids[start:min(start+sqliteDeleteBatch, len(ids))]
+		result, err := tx.ExecContext(ctx, `DELETE FROM domains WHERE id IN (`+placeholders(len(batch))+`)`, stringArgs(batch)...)
+		if err != nil {
+			return 0, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += count
+	}
+	return deleted, tx.Commit()
+}
+
+func (r *sqliteDomainRepository) Aggregate(context.Context, []bson.D, time.Duration) ([]map[string]any, error) {
+	return nil, fmt.Errorf("%w: aggregation pipelines require MongoDB", ErrUnsupported)
+}
+
+/*
+sqliteOrderBy builds the ORDER BY clause of a domain query, the insertion order breaks the ties so the pages are stable
+Args:
+
+	query DomainQuery: The query
+
+Returns:
+
+	string: The ORDER BY expressions, the table is aliased as d
+*/
+func sqliteOrderBy(query DomainQuery) string {
+	var orderBy []string
+	for _, field := range query.Sort {
+		expressions := sqliteSortExpressions[field.Field]
+		if field.Descending {
+			orderBy = append(orderBy, expressions[1]+" DESC")
+		} else {
+			orderBy = append(orderBy, expressions[0]+" ASC")
+		}
+	}
+	return strings.Join(append(orderBy, "d.seq ASC"), ", ")
+}
+
+/*
+sqliteDomainFilter builds the WHERE clause of a domain query, with the same semantics as the MongoDB filter
+Args:
+
+	query DomainQuery: The query
+
+Returns:
+
+	string: The WHERE clause (empty when there are no filters), the table is aliased as d
+	[]any: The arguments of the clause
+*/
+func sqliteDomainFilter(query DomainQuery) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, values ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if query.Host != "" {
+		add("d.host = ? COLLATE NOCASE", query.Host)
+	}
+	if query.ScanRequestID != "" {
+		add("json_extract(d.document, '$.scan.scanRequestID') = ?", query.ScanRequestID)
+	}
+	if len(query.Grades) > 0 {
+		add("d.grade IN ("+placeholders(len(query.Grades))+")", stringArgs(query.Grades)...)
+	}
+	if len(query.Verdicts) > 0 {
+		add("d.verdict IN ("+placeholders(len(query.Verdicts))+")", stringArgs(query.Verdicts)...)
+	}
+	if query.MinScore != nil {
+		add("d.score >= ?", *query.MinScore)
+	}
+	if query.MaxScore != nil {
+		add("d.score <= ?", *query.MaxScore)
+	}
+	if query.From != nil {
+		add("d.timestamp >= ?", query.From.UnixNano())
+	}
+	if query.To != nil {
+		add("d.timestamp <= ?", query.To.UnixNano())
+	}
+
+	// The conditions of the endpoint fields are matched on the same endpoint
+	var endpointConditions []string
+	var endpointArgs []any
+	if query.MinExpiresInDays != nil {
+		endpointConditions = append(endpointConditions, "json_extract(e.value, '$.certificate.expiresInDays') >= ?")
+		endpointArgs = append(endpointArgs, *query.MinExpiresInDays)
+	}
+	if query.MaxExpiresInDays != nil {
+		endpointConditions = append(endpointConditions, "json_extract(e.value, '$.certificate.expiresInDays') <= ?")
+		endpointArgs = append(endpointArgs, *query.MaxExpiresInDays)
+	}
+	if query.Issuer != "" {
+		endpointConditions = append(endpointConditions, "instr(lower(json_extract(e.value, '$.certificate.issuer')), lower(?)) > 0")
+		endpointArgs = append(endpointArgs, query.Issuer)
+	}
+	if query.Protocol != "" {
+		endpointConditions = append(endpointConditions, "EXISTS (SELECT 1 FROM json_each(e.value, '$.protocols') p WHERE p.value = ?)")
+		endpointArgs = append(endpointArgs, query.Protocol)
+	}
+	if len(endpointConditions) > 0 {
+		add("EXISTS (SELECT 1 FROM json_each(d.document, '$.endpoints') e WHERE "+strings.Join(endpointConditions, " AND ")+")", endpointArgs...)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+/*
+placeholders builds the list of placeholders of an IN condition
+Args:
+
+	count int: The number of values
+
+Returns:
+
+	string: The placeholders separated by commas (e.g. "?, ?, ?")
+*/
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+/*
+stringArgs converts a slice of strings into query arguments
+Args:
+
+	values []string: The strings
+
+Returns:
+
+	[]any: The arguments
+*/
+func stringArgs(values []string) []any {
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+/*
+scanDomainRow reads a register selected as id, version, document
+Args:
+
+	row interface{ Scan(...any) error }: The row (*sql.Row or *sql.Rows)
+
+Returns:
+
+	*DomainRecord: Pointer of the record
+	error: ErrNotFound if there is no row
+*/
+func scanDomainRow(row interface{ Scan(...any) error }) (*DomainRecord, error) {
+	var id, document string
+	var version int64
+	if err := row.Scan(&id, &version, &document); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return jsonRecord(id, version, []byte(document))
+}
+
+type sqlitePolicyRepository struct {
+	db *sql.DB
+}
+
+func (r *sqlitePolicyRepository) Save(ctx context.Context, policy *scripts.Policy) error {
+	document, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO policies (name, document) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET document = excluded.document`, policy.Name, string(document))
+	return err
+}
+
+func (r *sqlitePolicyRepository) List(ctx context.Context) ([]scripts.Policy, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT document FROM policies ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []scripts.Policy{}
+	for rows.Next() {
+		var document string
+		if err := rows.Scan(&document); err != nil {
+			return nil, err
+		}
+		var policy scripts.Policy
+		if err := json.Unmarshal([]byte(document), &policy); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+func (r *sqlitePolicyRepository) Get(ctx context.Context, name string) (*scripts.Policy, error) {
+	var document string
+	if err := r.db.QueryRowContext(ctx, `SELECT document FROM policies WHERE name = ?`, name).Scan(&document); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var policy scripts.Policy
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *sqlitePolicyRepository) Delete(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM policies WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type sqliteScanRepository struct {
+	db *sql.DB
+}
+
+func (r *sqliteScanRepository) Create(ctx context.Context, id string, scan *ScanRequest) error {
+	filtered, rawReport, err := scanJSONColumns(scan)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO scans (id, status, result, filtered_result, error, raw_report, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, scan.Status, scan.Result, filtered, scan.Error, rawReport, time.Now().UnixNano())
+	return err
+}
+
+func (r *sqliteScanRepository) Get(ctx context.Context, id string) (*ScanRequest, error) {
+	var scan ScanRequest
+	var filtered, rawReport sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT status, result, filtered_result, error, raw_report FROM scans WHERE id = ?`, id).
+		Scan(&scan.Status, &scan.Result, &filtered, &scan.Error, &rawReport)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filtered.Valid {
+		if err := json.Unmarshal([]byte(filtered.String), &scan.FilteredResult); err != nil {
+			return nil, err
+		}
+	}
+	if rawReport.Valid {
+		if err := json.Unmarshal([]byte(rawReport.String), &scan.RawReport); err != nil {
+			return nil, err
+		}
+	}
+	return &scan, nil
+}
+
+func (r *sqliteScanRepository) Update(ctx context.Context, id string, scan *ScanRequest) error {
+	filtered, rawReport, err := scanJSONColumns(scan)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx, `UPDATE scans SET status = ?, result = ?, filtered_result = ?, error = ?, raw_report = ?, updated_at = ? WHERE id = ?`,
+		scan.Status, scan.Result, filtered, scan.Error, rawReport, time.Now().UnixNano(), id)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+/*
+scanJSONColumns converts the filtered report and the raw report reference of a scan into the values of the
+filtered_result and raw_report columns
+Args:
+
+	scan *ScanRequest: The scan request
+
+Returns:
+
+	sql.NullString: The filtered report in JSON, NULL when the scan has no report yet
+	sql.NullString: The raw report reference in JSON, NULL when the raw report was not kept
+	error: Any error encountered during the process
+*/
+func scanJSONColumns(scan *ScanRequest) (sql.NullString, sql.NullString, error) {
+	filtered, err := jsonColumn(scan.FilteredResult, scan.FilteredResult == nil)
+	if err != nil {
+		return sql.NullString{}, sql.NullString{}, err
+	}
+	rawReport, err := jsonColumn(scan.RawReport, scan.RawReport == nil)
+	return filtered, rawReport, err
+}
+
+/*
+jsonColumn converts a value into the JSON of a nullable column
+Args:
+
+	value any: The value
+	null bool: If true the column is NULL
+
+Returns:
+
+	sql.NullString: The value in JSON
+	error: Any error encountered during the process
+*/
+func jsonColumn(value any, null bool) (sql.NullString, error) {
+	if null {
+		return sql.NullString{}, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+func (r *sqliteScanRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM scans WHERE updated_at < ?`, before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,328 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nebula-Challenge/repository"
+)
+
+// Periods of the snapshots kept of the reports older than the retention
+const (
+	SnapshotsNone    = "none"
+	SnapshotsDaily   = "daily"
+	SnapshotsWeekly  = "weekly"
+	SnapshotsMonthly = "monthly"
+)
+
+// Registers removed per DeleteMany call
+const deleteBatch = 1000
+
+/*
+Struct created to hold the retention policy of the stored data, built from config.RetentionSettings. A zero duration
+keeps the data forever
+*/
+type Policy struct {
+	// Age after which the full history of reports is downsampled, 0 disables the retention of reports
+	ReportsMaxAge time.Duration
+	// Period of the snapshots kept of the downsampled reports: the newest report of each host in each period
+	Snapshots string
+	// Age after which the snapshots are removed too
+	SnapshotsMaxAge time.Duration
+	// Age after which the scan requests are removed
+	ScansMaxAge time.Duration
+	// Age after which the raw SSL Labs reports of the scans are removed, they can no longer be refiltered
+	RawReportsMaxAge time.Duration
+	// Directory of the compressed JSON Lines archives written before removing reports
+	ArchiveDir string
+	// Time between two runs of the background job
+	Interval time.Duration
+}
+
+/*
+Struct created to hold the outcome of a retention run
+*/
+type Result struct {
+	Archive           string `json:"archive,omitempty"`
+	ReportsKept       int64  `json:"reportsKept"`
+	ReportsDeleted    int64  `json:"reportsDeleted"`
+	ScansDeleted      int64  `json:"scansDeleted"`
+	RawReportsDeleted int64  `json:"rawReportsDeleted"`
+}
+
+/*
+snapshotKey returns the period of the snapshots a report timestamp belongs to
+Args:
+
+	period string: The period of the snapshots (daily, weekly or monthly)
+	timestamp time.Time: The timestamp of the report
+
+Returns:
+
+	string: The period, e.g. "2024-05" for monthly snapshots
+*/
+func snapshotKey(period string, timestamp time.Time) string {
+	timestamp = timestamp.UTC()
+	switch period {
+	case SnapshotsDaily:
+		return timestamp.Format("2006-01-02")
+	case SnapshotsWeekly:
+		year, week := timestamp.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return timestamp.Format("2006-01")
+	}
+}
+
+/*
+Run applies a retention policy once. The reports older than ReportsMaxAge are downsampled keeping, for each host,
+its latest report and the newest report of each snapshot period younger than SnapshotsMaxAge; the rest are written
+to a gzip compressed JSON Lines file in ArchiveDir and removed only after the archive is complete. The scan
+requests last updated before ScansMaxAge and the raw reports stored before RawReportsMaxAge are removed
+Args:
+
+	ctx context.Context: The context of the operation
+	repos *repository.Repositories: The repositories
+	policy Policy: The retention policy
+	now time.Time: The reference time of the ages
+
+Returns:
+
+	*Result: Pointer to the outcome of the run
+	error: Any error encountered during the process, nothing is removed if the archive can not be written
+*/
+func Run(ctx context.Context, repos *repository.Repositories, policy Policy, now time.Time) (*Result, error) {
+	result := &Result{}
+	if policy.ReportsMaxAge > 0 {
+		if err := downsampleReports(ctx, repos.Domains, policy, now, result); err != nil {
+			return result, err
+		}
+	}
+	if policy.ScansMaxAge > 0 {
+		deleted, err := repos.Scans.DeleteBefore(ctx, now.Add(-policy.ScansMaxAge))
+		if err != nil {
+			return result, fmt.Errorf("removing old scan requests: %v", err)
+		}
+		result.ScansDeleted = deleted
+	}
+	if policy.RawReportsMaxAge > 0 && repos.RawReports != nil {
+		deleted, err := repos.RawReports.DeleteBefore(ctx, now.Add(-policy.RawReportsMaxAge))
+		if err != nil {
+			return result, fmt.Errorf("removing old raw reports: %v", err)
+		}
+		result.RawReportsDeleted = deleted
+	}
+	return result, nil
+}
+
+/*
+downsampleReports archives and removes the reports the policy does not keep, see Run
+Args:
+
+	ctx context.Context: The context of the operation
+	domains repository.DomainRepository: The repository of the reports
+	policy Policy: The retention policy
+	now time.Time: The reference time of the ages
+	result *Result: The outcome of the run, updated with the reports kept and removed
+
+Returns:
+
+	error: Any error encountered during the process
+*/
+func downsampleReports(ctx context.Context, domains repository.DomainRepository, policy Policy, now time.Time, result *Result) error {
+	snapshotsFrom := time.Time{}
+	if policy.SnapshotsMaxAge > 0 {
+		snapshotsFrom = now.Add(-policy.SnapshotsMaxAge)
+	}
+
+	archive, err := newArchive(policy.ArchiveDir, now)
+	if err != nil {
+		return fmt.Errorf("creating the archive: %v", err)
+	}
+	defer archive.discard()
+
+	var ids []string
+	host, latestID := "", ""
+	periods := map[string]bool{}
+	// The registers come sorted by host and newest first, so the first one of a period is its snapshot
+	err = domains.ForEachBefore(ctx, now.Add(-policy.ReportsMaxAge), func(record *repository.DomainRecord) error {
+		report, err := record.Report()
+		if err != nil {
+			return fmt.Errorf("reading register %s: %v", record.ID, err)
+		}
+		if report.Host != host {
+			host, latestID = report.Host, ""
+			clear(periods)
+			latest, err := domains.Latest(ctx, host)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+			if latest != nil {
+				latestID = latest.ID
+			}
+		}
+		// The latest report of a host is never removed: compliance and the updates depend on it. It is the newest
+		// insert, which is not the newest timestamp when an older report was imported later
+		if record.ID == latestID {
+			result.ReportsKept++
+			return nil
+		}
+		if policy.Snapshots != SnapshotsNone && !report.Timestamp.Before(snapshotsFrom) {
+			key := snapshotKey(policy.Snapshots, report.Timestamp)
+			if !periods[key] {
+				periods[key] = true
+				result.ReportsKept++
+				return nil
+			}
+		}
+		if err := archive.write(record.Document); err != nil {
+			return fmt.Errorf("writing the archive: %v", err)
+		}
+		ids = append(ids, record.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if result.Archive, err = archive.commit(); err != nil {
+		return fmt.Errorf("writing the archive: %v", err)
+	}
+	for start := 0; start < len(ids); start += deleteBatch {
+		deleted, err := domains.DeleteMany(ctx, ids[start:min(start+deleteBatch, len(ids))])
+		result.ReportsDeleted += deleted
+		if err != nil {
+			return fmt.Errorf("removing archived reports: %v", err)
+		}
+	}
+	return nil
+}
+
+/*
+Struct created to hold an archive being written: a temporary file renamed when it is complete, so a partial
+archive never has the final name
+*/
+type archive struct {
+	file *os.File
+	gzip *gzip.Writer
+	enc  *json.Encoder
+	path string
+}
+
+/*
+newArchive creates the temporary file of an archive named domains_info-<UTC time>.jsonl.gz
+Args:
+
+	dir string: The directory of the archives, created if it does not exist
+	now time.Time: The time of the run
+
+Returns:
+
+	*archive: Pointer to the archive
+	error: Any error encountered during the process
+*/
+func newArchive(dir string, now time.Time) (*archive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, ".domains_info-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	writer := gzip.NewWriter(file)
+	return &archive{
+		file: file,
+		gzip: writer,
+		enc:  json.NewEncoder(writer),
+		path: filepath.Join(dir, "domains_info-"+now.UTC().Format("20060102T150405Z")+".jsonl.gz"),
+	}, nil
+}
+
+// write appends a register to the archive, one JSON document with its _id and version per line
+func (a *archive) write(document map[string]any) error {
+	return a.enc.Encode(document)
+}
+
+/*
+commit flushes the archive to disk and gives it its final name, adding a suffix if an archive with that name exists
+
+Returns:
+
+	string: The path of the archive
+	error: Any error encountered during the process
+*/
+func (a *archive) commit() (string, error) {
+	if err := a.gzip.Close(); err != nil {
+		return "", err
+	}
+	if err := a.file.Sync(); err != nil {
+		return "", err
+	}
+	if err := a.file.Close(); err != nil {
+		return "", err
+	}
+	path := a.path
+	for suffix := 1; ; suffix++ {
+		// A hard link fails instead of replacing an existing archive
+		err := os.Link(a.file.Name(), path)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		path = strings.TrimSuffix(a.path, ".jsonl.gz") + "-" + strconv.Itoa(suffix) + ".jsonl.gz"
+	}
+	os.Remove(a.file.Name())
+	a.file = nil
+	return path, nil
+}
+
+// discard removes the temporary file if the archive was not committed
+func (a *archive) discard() {
+	if a.file == nil {
+		return
+	}
+	a.file.Close()
+	os.Remove(a.file.Name())
+}
+
+/*
+Start runs the retention policy in the background right away and then every policy.Interval, until ctx is done
+Args:
+
+	ctx context.Context: The context that stops the job
+	repos *repository.Repositories: The repositories
+	policy Policy: The retention policy
+*/
+func Start(ctx context.Context, repos *repository.Repositories, policy Policy) {
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for {
+			result, err := Run(ctx, repos, policy, time.Now())
+			if err != nil {
+				log.Printf("Retention job failed: %v", err)
+			} else if result.ReportsDeleted > 0 || result.ScansDeleted > 0 || result.RawReportsDeleted > 0 {
+				log.Printf("Retention job: %d reports archived in %s and removed, %d scan requests and %d raw reports removed", result.ReportsDeleted, result.Archive, result.ScansDeleted, result.RawReportsDeleted)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
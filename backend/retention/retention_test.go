@@ -0,0 +1,85 @@
+package retention
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nebula-Challenge/repository"
+	"github.com/Nebula-Challenge/scripts"
+)
+
+func TestRunKeepsLatestInsert(t *testing.T) {
+	now := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+
+	tests := []struct {
+		name      string
+		snapshots string
+		inserted  []time.Time // Timestamps in insertion order, the last one is the latest report of the host
+		kept      []time.Time
+	}{
+		{
+			name:      "reports inserted in order",
+			snapshots: SnapshotsNone,
+			inserted:  []time.Time{days(300), days(200), days(100)},
+			kept:      []time.Time{days(100)},
+		},
+		{
+			name:      "imported report older than the others",
+			snapshots: SnapshotsNone,
+			inserted:  []time.Time{days(100), days(200), days(400)},
+			kept:      []time.Time{days(400)},
+		},
+		{
+			name:      "imported report in a period with a snapshot",
+			snapshots: SnapshotsMonthly,
+			inserted:  []time.Time{days(100), days(200), days(201)},
+			kept:      []time.Time{days(100), days(200), days(201)},
+		},
+		{
+			name:      "recent reports are kept",
+			snapshots: SnapshotsNone,
+			inserted:  []time.Time{days(100), days(5), days(200)},
+			kept:      []time.Time{days(5), days(200)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := repository.NewMemoryRepositories()
+			for _, timestamp := range test.inserted {
+				if _, err := repos.Domains.Insert(ctx, &scripts.FilteredTLSReport{Host: "example.com", Timestamp: timestamp}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			policy := Policy{ReportsMaxAge: 30 * 24 * time.Hour, Snapshots: test.snapshots, ArchiveDir: t.TempDir(), Interval: time.Hour}
+			result, err := Run(ctx, repos, policy, now)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			var kept []time.Time
+			err = repos.Domains.ForEach(ctx, repository.DomainQuery{Host: "example.com"}, func(record *repository.DomainRecord) error {
+				report, err := record.Report()
+				if err != nil {
+					return err
+				}
+				kept = append(kept, report.Timestamp)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.SortFunc(kept, time.Time.Compare)
+			slices.SortFunc(test.kept, time.Time.Compare)
+			if !slices.Equal(kept, test.kept) {
+				t.Errorf("kept %v, want %v", kept, test.kept)
+			}
+			if deleted := int64(len(test.inserted) - len(test.kept)); result.ReportsDeleted != deleted {
+				t.Errorf("ReportsDeleted = %d, want %d", result.ReportsDeleted, deleted)
+			}
+		})
+	}
+}
@@ -32,13 +32,36 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler) {
 		Defining the route group for domain information
 	*/
 	router.GET("/domains-info", handler.GetDomainsInformation)
+	router.GET("/domains-info/export", handler.ExportDomainsInformation)
 	router.GET("/domains-info/:id", handler.GetDomainsInformationByID)
 	router.POST("/create-domain-info", handler.PostDomainInformation)
+	router.PUT("/domains-info/:id", handler.PutDomainInformation)
+	router.PATCH("/domains-info/:id", handler.PatchDomainInformation)
 	router.POST("/domains-info/aggregate", handler.AggregateDomainInformation)
+	router.POST("/domains-info/import", handler.ImportDomainsInformation)
 	router.DELETE("/domains-info/:id", handler.DeleteDomainById)
+	router.GET("/domains-info/:id/evaluate", handler.EvaluateDomainInformation)
+
+	//Compliance profiles routes
+	router.GET("/domains/:host/compliance", handler.GetDomainCompliance)
+
+	//Saved aggregations routes
+	router.GET("/aggregations", handler.GetSavedAggregations)
+	router.GET("/aggregations/:name", handler.RunSavedAggregation)
+
+	//Latest report per host routes
+	router.PUT("/domains/:host/report", handler.PutDomainReportByHost)
+
+	//Verdict policies routes
+	router.GET("/policies", handler.GetPolicies)
+	router.GET("/policies/:name", handler.GetPolicyByName)
+	router.POST("/policies", handler.PostPolicy)
+	router.DELETE("/policies/:name", handler.DeletePolicy)
+	router.POST("/policies/:name/evaluate", handler.EvaluatePolicy)
 
 	//SSL Labs TLS scan routes
 	router.POST("/start-scan", handler.StartScan)
 	router.GET("/scan-status/:scanRequestID", handler.GetScanStatus)
+	router.POST("/scans/:scanRequestID/refilter", handler.RefilterScan)
 
 }
@@ -0,0 +1,489 @@
+package scripts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the built-in compliance profiles
+const (
+	ProfileMozillaModern       = "mozilla-modern"
+	ProfileMozillaIntermediate = "mozilla-intermediate"
+	ProfileNIST80052r2         = "nist-800-52r2"
+	ProfilePCIDSS              = "pci-dss"
+)
+
+// Cipher suites (IANA names, as reported by SSL Labs) allowed by the Mozilla modern configuration
+var mozillaModernSuites = []string{
+	"TLS_AES_128_GCM_SHA256",
+	"TLS_AES_256_GCM_SHA384",
+	"TLS_CHACHA20_POLY1305_SHA256",
+}
+
+// Cipher suites (IANA names, as reported by SSL Labs) allowed by the Mozilla intermediate configuration
+var mozillaIntermediateSuites = append([]string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	"TLS_DHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_DHE_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+}, mozillaModernSuites...)
+
+// Fragments of cipher suite names that no profile accepts
+var insecureSuiteFragments = []string{"NULL", "EXPORT", "_anon_", "RC4", "_DES_", "3DES", "MD5"}
+
+/*
+Struct created to hold a single requirement of a compliance profile
+*/
+type complianceRequirement struct {
+	id          string
+	description string
+	violations  func(ep FilteredEndpoint) []string // Offending values of the endpoint, empty when it complies
+}
+
+/*
+Struct created to hold a built-in compliance profile
+*/
+type complianceProfile struct {
+	name         string
+	description  string
+	requirements []complianceRequirement
+}
+
+/*
+Struct created to hold the result of a single requirement of a compliance evaluation
+*/
+type RequirementResult struct {
+	ID                string   `json:"id"`
+	Description       string   `json:"description"`
+	Passed            bool     `json:"passed"`
+	Actual            string   `json:"actual"` // Offending values found, empty when the requirement passed
+	AffectedEndpoints []string `json:"affectedEndpoints"`
+}
+
+/*
+Struct created to hold the result of evaluating a report against a compliance profile
+*/
+type ComplianceResult struct {
+	Profile      string              `json:"profile"`
+	Description  string              `json:"description"`
+	Host         string              `json:"host"`
+	Compliant    bool                `json:"compliant"` // True only if every requirement passed
+	Requirements []RequirementResult `json:"requirements"`
+}
+
+/*
+complianceProfiles holds the built-in profiles indexed by name
+*/
+var complianceProfiles = map[string]complianceProfile{
+	ProfileMozillaModern: {
+		name:        ProfileMozillaModern,
+		description: "Mozilla Server Side TLS, modern configuration (v5.7)",
+		requirements: []complianceRequirement{
+			allowedProtocolsRequirement("TLS 1.3"),
+			allowedSuitesRequirement(mozillaModernSuites),
+			{
+				id:          "certificate.key",
+				description: "ECDSA certificate with a P-256 (or larger) key",
+				violations: func(ep FilteredEndpoint) []string {
+					if ep.Certificate == nil || ep.Certificate.KeyAlgorithm != "EC" || ep.Certificate.KeySize < 256 {
+						return []string{describeKey(ep)}
+					}
+					return nil
+				},
+			},
+			strongSignatureRequirement(),
+			certificateLifetimeRequirement(1.0),
+			hstsMaxAgeRequirement(63072000),
+		},
+	},
+	ProfileMozillaIntermediate: {
+		name:        ProfileMozillaIntermediate,
+		description: "Mozilla Server Side TLS, intermediate configuration (v5.7)",
+		requirements: []complianceRequirement{
+			allowedProtocolsRequirement("TLS 1.2", "TLS 1.3"),
+			allowedSuitesRequirement(mozillaIntermediateSuites),
+			keySizeRequirement(2048, 256),
+			strongSignatureRequirement(),
+			certificateLifetimeRequirement(1.0),
+			hstsMaxAgeRequirement(63072000),
+		},
+	},
+	ProfileNIST80052r2: {
+		name:        ProfileNIST80052r2,
+		description: "NIST SP 800-52 Rev. 2, guidelines for TLS implementations",
+		requirements: []complianceRequirement{
+			allowedProtocolsRequirement("TLS 1.2", "TLS 1.3"),
+			requiredProtocolRequirement("TLS 1.3"),
+			{
+				id:          "ciphers.approved",
+				description: "Only ephemeral key exchange (ECDHE/DHE) with AES-GCM, AES-CCM or AES-CBC, or TLS 1.3 AES suites",
+				violations: func(ep FilteredEndpoint) (offending []string) {
+					for _, suite := range ep.CipherSuites {
+						tls13 := suite == "TLS_AES_128_GCM_SHA256" || suite == "TLS_AES_256_GCM_SHA384" || strings.HasPrefix(suite, "TLS_AES_128_CCM")
+						ephemeral := strings.HasPrefix(suite, "TLS_ECDHE_") || strings.HasPrefix(suite, "TLS_DHE_")
+						if !tls13 && !(ephemeral && strings.Contains(suite, "_WITH_AES_")) {
+							offending = append(offending, suite)
+						}
+					}
+					return offending
+				},
+			},
+			keySizeRequirement(2048, 256),
+			strongSignatureRequirement(),
+			validCertificateRequirement(),
+		},
+	},
+	ProfilePCIDSS: {
+		name:        ProfilePCIDSS,
+		description: "PCI DSS v4.0 strong cryptography requirements (2.2.7, 4.2.1)",
+		requirements: []complianceRequirement{
+			allowedProtocolsRequirement("TLS 1.2", "TLS 1.3"),
+			{
+				id:          "ciphers.strong",
+				description: "No insecure cipher suites (NULL, EXPORT, anonymous, RC4, DES, 3DES) and at least 112 bits of strength",
+				violations: func(ep FilteredEndpoint) (offending []string) {
+					for _, suite := range ep.CipherSuites {
+						for _, fragment := range insecureSuiteFragments {
+							if strings.Contains(suite, fragment) {
+								offending = append(offending, suite)
+								break
+							}
+						}
+					}
+					if ep.HasWeakCiphers && len(offending) == 0 {
+						offending = append(offending, fmt.Sprintf("cipher strength %.0f bits", ep.MinCipherStrength))
+					}
+					return offending
+				},
+			},
+			keySizeRequirement(2048, 224),
+			strongSignatureRequirement(),
+			validCertificateRequirement(),
+		},
+	},
+}
+
+/*
+ComplianceProfileNames returns the names of the built-in compliance profiles, sorted alphabetically.
+
+Returns:
+
+	[]string: The profile names
+*/
+func ComplianceProfileNames() []string {
+	names := make([]string, 0, len(complianceProfiles))
+	for name := range complianceProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+IsComplianceProfile checks if the given name is one of the built-in compliance profiles.
+
+Args:
+
+	name string: The profile name
+
+Returns:
+
+	bool: true if the profile exists, false otherwise
+*/
+func IsComplianceProfile(name string) bool {
+	_, ok := complianceProfiles[name]
+	return ok
+}
+
+/*
+EvaluateCompliance checks a filtered report against every requirement of a built-in compliance profile.
+
+Args:
+
+	report *FilteredTLSReport: The report to evaluate
+	profileName string: The name of the profile (e.g. "pci-dss")
+
+Returns:
+
+	*ComplianceResult: The pass/fail result of every requirement
+	error: An error if the profile does not exist
+*/
+func EvaluateCompliance(report *FilteredTLSReport, profileName string) (*ComplianceResult, error) {
+	profile, ok := complianceProfiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("unknown compliance profile %q, allowed values: %s", profileName, strings.Join(ComplianceProfileNames(), ", "))
+	}
+
+	result := &ComplianceResult{
+		Profile:     profile.name,
+		Description: profile.description,
+		Host:        report.Host,
+		Compliant:   len(report.Endpoints) > 0,
+	}
+	for _, requirement := range profile.requirements {
+		var offending []string
+		affected := affectedEndpoints(report.Endpoints, func(ep FilteredEndpoint) bool {
+			violations := requirement.violations(ep)
+			for _, violation := range violations {
+				if !contains(offending, violation) {
+					offending = append(offending, violation)
+				}
+			}
+			return len(violations) > 0
+		})
+
+		requirementResult := RequirementResult{
+			ID:                requirement.id,
+			Description:       requirement.description,
+			Passed:            len(affected) == 0,
+			Actual:            strings.Join(offending, ", "),
+			AffectedEndpoints: affected,
+		}
+		if !requirementResult.Passed {
+			result.Compliant = false
+		}
+		result.Requirements = append(result.Requirements, requirementResult)
+	}
+
+	return result, nil
+}
+
+/*
+allowedProtocolsRequirement builds the requirement that only the given protocols are enabled.
+Args:
+
+	allowed ...string: The allowed protocols (e.g. "TLS 1.2", "TLS 1.3")
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func allowedProtocolsRequirement(allowed ...string) complianceRequirement {
+	return complianceRequirement{
+		id:          "protocols.allowed",
+		description: "Only " + strings.Join(allowed, " and ") + " are enabled",
+		violations: func(ep FilteredEndpoint) (offending []string) {
+			for _, protocol := range ep.Protocols {
+				if !contains(allowed, protocol) {
+					offending = append(offending, protocol)
+				}
+			}
+			return offending
+		},
+	}
+}
+
+/*
+requiredProtocolRequirement builds the requirement that a protocol is supported.
+Args:
+
+	protocol string: The required protocol (e.g. "TLS 1.3")
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func requiredProtocolRequirement(protocol string) complianceRequirement {
+	return complianceRequirement{
+		id:          "protocols.required",
+		description: protocol + " is supported",
+		violations: func(ep FilteredEndpoint) []string {
+			if !contains(ep.Protocols, protocol) {
+				return []string{protocol + " not supported"}
+			}
+			return nil
+		},
+	}
+}
+
+/*
+allowedSuitesRequirement builds the requirement that only the given cipher suites are enabled.
+Args:
+
+	allowed []string: The allowed cipher suites (IANA names)
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func allowedSuitesRequirement(allowed []string) complianceRequirement {
+	return complianceRequirement{
+		id:          "ciphers.allowed",
+		description: "Only the cipher suites of the profile are enabled",
+		violations: func(ep FilteredEndpoint) (offending []string) {
+			for _, suite := range ep.CipherSuites {
+				if !contains(allowed, suite) {
+					offending = append(offending, suite)
+				}
+			}
+			return offending
+		},
+	}
+}
+
+/*
+keySizeRequirement builds the requirement of minimum certificate key sizes.
+Args:
+
+	minRSA int64: The minimum RSA/DSA key size in bits
+	minEC int64: The minimum EC key size in bits
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func keySizeRequirement(minRSA int64, minEC int64) complianceRequirement {
+	return complianceRequirement{
+		id:          "certificate.keySize",
+		description: fmt.Sprintf("Certificate key of at least %d bits (RSA) or %d bits (EC)", minRSA, minEC),
+		violations: func(ep FilteredEndpoint) []string {
+			if ep.Certificate == nil {
+				return []string{"no certificate"}
+			}
+			minSize := minRSA
+			if ep.Certificate.KeyAlgorithm == "EC" {
+				minSize = minEC
+			}
+			if ep.Certificate.KeySize < minSize {
+				return []string{describeKey(ep)}
+			}
+			return nil
+		},
+	}
+}
+
+/*
+strongSignatureRequirement builds the requirement that the certificate is not signed with MD5 or SHA-1.
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func strongSignatureRequirement() complianceRequirement {
+	return complianceRequirement{
+		id:          "certificate.signature",
+		description: "Certificate signed with SHA-256 or stronger (no MD5 or SHA-1)",
+		violations: func(ep FilteredEndpoint) []string {
+			if ep.Certificate == nil {
+				return []string{"no certificate"}
+			}
+			algorithm := strings.ToUpper(ep.Certificate.SignatureAlgorithm)
+			if algorithm == "" || strings.Contains(algorithm, "MD5") || strings.Contains(algorithm, "SHA1") || strings.Contains(algorithm, "SHA-1") {
+				return []string{"signature " + ep.Certificate.SignatureAlgorithm}
+			}
+			return nil
+		},
+	}
+}
+
+/*
+certificateLifetimeRequirement builds the requirement of a maximum certificate lifetime.
+Args:
+
+	maxYears float64: The maximum validity period in years
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func certificateLifetimeRequirement(maxYears float64) complianceRequirement {
+	return complianceRequirement{
+		id:          "certificate.lifetime",
+		description: fmt.Sprintf("Certificate lifetime of at most %.0f year(s)", maxYears),
+		violations: func(ep FilteredEndpoint) []string {
+			if ep.Certificate == nil || ep.Certificate.ValidityYears > maxYears {
+				return []string{describeLifetime(ep)}
+			}
+			return nil
+		},
+	}
+}
+
+/*
+validCertificateRequirement builds the requirement that the certificate is not expired and the chain has no issues.
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func validCertificateRequirement() complianceRequirement {
+	return complianceRequirement{
+		id:          "certificate.valid",
+		description: "Certificate not expired and served with a valid chain",
+		violations: func(ep FilteredEndpoint) (offending []string) {
+			if ep.Certificate == nil || ep.Certificate.ExpiresInDays <= 0 {
+				offending = append(offending, "certificate expired or missing")
+			}
+			if ep.ChainIssues > 0 {
+				offending = append(offending, fmt.Sprintf("chain issues %d", ep.ChainIssues))
+			}
+			return offending
+		},
+	}
+}
+
+/*
+hstsMaxAgeRequirement builds the requirement that HSTS is present with a minimum max-age.
+Args:
+
+	minMaxAge int64: The minimum max-age in seconds
+
+Returns:
+
+	complianceRequirement: The requirement
+*/
+func hstsMaxAgeRequirement(minMaxAge int64) complianceRequirement {
+	return complianceRequirement{
+		id:          "hsts.maxAge",
+		description: fmt.Sprintf("HSTS enabled with max-age of at least %d seconds", minMaxAge),
+		violations: func(ep FilteredEndpoint) []string {
+			if !isHSTSPresent(ep.HSTS) {
+				return []string{"HSTS not present"}
+			}
+			if ep.HSTS.MaxAge < minMaxAge {
+				return []string{fmt.Sprintf("max-age %d", ep.HSTS.MaxAge)}
+			}
+			return nil
+		},
+	}
+}
+
+/*
+describeKey describes the certificate key of an endpoint (e.g. "RSA 2048").
+Args:
+
+	ep FilteredEndpoint: The endpoint
+
+Returns:
+
+	string: The key description
+*/
+func describeKey(ep FilteredEndpoint) string {
+	if ep.Certificate == nil {
+		return "no certificate"
+	}
+	return fmt.Sprintf("%s %d", ep.Certificate.KeyAlgorithm, ep.Certificate.KeySize)
+}
+
+/*
+describeLifetime describes the certificate validity period of an endpoint (e.g. "lifetime 1.1 years").
+Args:
+
+	ep FilteredEndpoint: The endpoint
+
+Returns:
+
+	string: The lifetime description
+*/
+func describeLifetime(ep FilteredEndpoint) string {
+	if ep.Certificate == nil {
+		return "no certificate"
+	}
+	return fmt.Sprintf("lifetime %.1f years", ep.Certificate.ValidityYears)
+}
@@ -0,0 +1,168 @@
+package scripts
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+compliantEndpoints returns, for every profile, an endpoint that passes all its requirements
+*/
+func compliantEndpoints() map[string]FilteredEndpoint {
+	certificate := func(algorithm string, size int64) *FilteredCertificate {
+		return &FilteredCertificate{KeyAlgorithm: algorithm, KeySize: size, SignatureAlgorithm: "SHA256withRSA", ValidityYears: 0.25, ExpiresInDays: 60}
+	}
+	hsts := &FilteredHSTS{Status: "present", MaxAge: 63072000}
+	return map[string]FilteredEndpoint{
+		ProfileMozillaModern: {
+			IPAddress:    "192.0.2.1",
+			Protocols:    []string{"TLS 1.3"},
+			CipherSuites: []string{"TLS_AES_128_GCM_SHA256", "TLS_CHACHA20_POLY1305_SHA256"},
+			Certificate:  certificate("EC", 256),
+			HSTS:         hsts,
+		},
+		ProfileMozillaIntermediate: {
+			IPAddress:    "192.0.2.1",
+			Protocols:    []string{"TLS 1.2", "TLS 1.3"},
+			CipherSuites: []string{"TLS_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384"},
+			Certificate:  certificate("RSA", 2048),
+			HSTS:         hsts,
+		},
+		ProfileNIST80052r2: {
+			IPAddress:    "192.0.2.1",
+			Protocols:    []string{"TLS 1.2", "TLS 1.3"},
+			CipherSuites: []string{"TLS_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384", "TLS_DHE_RSA_WITH_AES_128_CCM"},
+			Certificate:  certificate("RSA", 3072),
+		},
+		ProfilePCIDSS: {
+			IPAddress:    "192.0.2.1",
+			Protocols:    []string{"TLS 1.2"},
+			CipherSuites: []string{"TLS_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA"},
+			Certificate:  certificate("EC", 224),
+		},
+	}
+}
+
+func TestEvaluateCompliancePasses(t *testing.T) {
+	for profile, endpoint := range compliantEndpoints() {
+		t.Run(profile, func(t *testing.T) {
+			result, err := EvaluateCompliance(&FilteredTLSReport{Host: "example.com", Endpoints: []FilteredEndpoint{endpoint}}, profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Compliant || len(result.Requirements) != len(complianceProfiles[profile].requirements) {
+				t.Errorf("compliant = %v with %d requirements, want every requirement passed", result.Compliant, len(result.Requirements))
+			}
+			for _, requirement := range result.Requirements {
+				if !requirement.Passed {
+					t.Errorf("%s failed: %s", requirement.ID, requirement.Actual)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateComplianceFailures(t *testing.T) {
+	tests := []struct {
+		profile     string
+		requirement string
+		change      func(*FilteredEndpoint)
+		actual      string
+	}{
+		{ProfileMozillaModern, "protocols.allowed", func(e *FilteredEndpoint) { e.Protocols = []string{"TLS 1.2", "TLS 1.3"} }, "TLS 1.2"},
+		{ProfileMozillaModern, "ciphers.allowed", func(e *FilteredEndpoint) {
+			e.CipherSuites = append(e.CipherSuites, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256")
+		}, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		{ProfileMozillaModern, "certificate.key", func(e *FilteredEndpoint) { e.Certificate.KeyAlgorithm, e.Certificate.KeySize = "RSA", 4096 }, "RSA 4096"},
+		{ProfileMozillaModern, "certificate.signature", func(e *FilteredEndpoint) { e.Certificate.SignatureAlgorithm = "SHA1withRSA" }, "signature SHA1withRSA"},
+		{ProfileMozillaModern, "certificate.lifetime", func(e *FilteredEndpoint) { e.Certificate.ValidityYears = 1.1 }, "lifetime 1.1 years"},
+		{ProfileMozillaModern, "hsts.maxAge", func(e *FilteredEndpoint) { e.HSTS = &FilteredHSTS{Status: "present", MaxAge: 31536000} }, "max-age 31536000"},
+
+		{ProfileMozillaIntermediate, "protocols.allowed", func(e *FilteredEndpoint) { e.Protocols = append(e.Protocols, "TLS 1.1") }, "TLS 1.1"},
+		{ProfileMozillaIntermediate, "ciphers.allowed", func(e *FilteredEndpoint) {
+			e.CipherSuites = append(e.CipherSuites, "TLS_RSA_WITH_AES_128_CBC_SHA")
+		}, "TLS_RSA_WITH_AES_128_CBC_SHA"},
+		{ProfileMozillaIntermediate, "certificate.keySize", func(e *FilteredEndpoint) { e.Certificate.KeySize = 1024 }, "RSA 1024"},
+		{ProfileMozillaIntermediate, "certificate.keySize", func(e *FilteredEndpoint) { e.Certificate.KeyAlgorithm, e.Certificate.KeySize = "EC", 224 }, "EC 224"},
+		{ProfileMozillaIntermediate, "certificate.signature", func(e *FilteredEndpoint) { e.Certificate.SignatureAlgorithm = "MD5withRSA" }, "signature MD5withRSA"},
+		{ProfileMozillaIntermediate, "certificate.lifetime", func(e *FilteredEndpoint) { e.Certificate.ValidityYears = 2 }, "lifetime 2.0 years"},
+		{ProfileMozillaIntermediate, "hsts.maxAge", func(e *FilteredEndpoint) { e.HSTS = nil }, "HSTS not present"},
+
+		{ProfileNIST80052r2, "protocols.allowed", func(e *FilteredEndpoint) { e.Protocols = append(e.Protocols, "TLS 1.0") }, "TLS 1.0"},
+		{ProfileNIST80052r2, "protocols.required", func(e *FilteredEndpoint) { e.Protocols = []string{"TLS 1.2"} }, "TLS 1.3 not supported"},
+		{ProfileNIST80052r2, "ciphers.approved", func(e *FilteredEndpoint) {
+			e.CipherSuites = append(e.CipherSuites, "TLS_RSA_WITH_AES_128_GCM_SHA256", "TLS_CHACHA20_POLY1305_SHA256")
+		}, "TLS_RSA_WITH_AES_128_GCM_SHA256, TLS_CHACHA20_POLY1305_SHA256"},
+		{ProfileNIST80052r2, "certificate.keySize", func(e *FilteredEndpoint) { e.Certificate.KeySize = 1024 }, "RSA 1024"},
+		{ProfileNIST80052r2, "certificate.signature", func(e *FilteredEndpoint) { e.Certificate.SignatureAlgorithm = "" }, "signature "},
+		{ProfileNIST80052r2, "certificate.valid", func(e *FilteredEndpoint) { e.Certificate.ExpiresInDays = -3 }, "certificate expired or missing"},
+		{ProfileNIST80052r2, "certificate.valid", func(e *FilteredEndpoint) { e.ChainIssues = 2 }, "chain issues 2"},
+
+		{ProfilePCIDSS, "protocols.allowed", func(e *FilteredEndpoint) { e.Protocols = []string{"SSL 3.0", "TLS 1.0", "TLS 1.2"} }, "SSL 3.0, TLS 1.0"},
+		{ProfilePCIDSS, "ciphers.strong", func(e *FilteredEndpoint) {
+			e.CipherSuites = append(e.CipherSuites, "TLS_RSA_WITH_3DES_EDE_CBC_SHA", "TLS_RSA_WITH_RC4_128_SHA")
+		}, "TLS_RSA_WITH_3DES_EDE_CBC_SHA, TLS_RSA_WITH_RC4_128_SHA"},
+		{ProfilePCIDSS, "ciphers.strong", func(e *FilteredEndpoint) { e.HasWeakCiphers, e.MinCipherStrength = true, 56 }, "cipher strength 56 bits"},
+		{ProfilePCIDSS, "certificate.keySize", func(e *FilteredEndpoint) { e.Certificate.KeySize = 192 }, "EC 192"},
+		{ProfilePCIDSS, "certificate.signature", func(e *FilteredEndpoint) { e.Certificate.SignatureAlgorithm = "SHA-1" }, "signature SHA-1"},
+		{ProfilePCIDSS, "certificate.valid", func(e *FilteredEndpoint) { e.Certificate.ExpiresInDays = 0 }, "certificate expired or missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.profile+"/"+test.requirement+"/"+test.actual, func(t *testing.T) {
+			failing := compliantEndpoints()[test.profile]
+			certificate := *failing.Certificate
+			failing.Certificate = &certificate
+			test.change(&failing)
+			failing.IPAddress = "192.0.2.2"
+			passing := compliantEndpoints()[test.profile]
+
+			result, err := EvaluateCompliance(&FilteredTLSReport{Host: "example.com", Endpoints: []FilteredEndpoint{passing, failing}}, test.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Compliant {
+				t.Error("compliant = true, want false")
+			}
+			for _, requirement := range result.Requirements {
+				if requirement.ID != test.requirement {
+					if !requirement.Passed {
+						t.Errorf("%s failed too: %s", requirement.ID, requirement.Actual)
+					}
+					continue
+				}
+				if requirement.Passed || requirement.Actual != test.actual || !reflect.DeepEqual(requirement.AffectedEndpoints, []string{"192.0.2.2"}) {
+					t.Errorf("%s: passed = %v, actual = %q, affected = %v, want failed with %q on 192.0.2.2",
+						requirement.ID, requirement.Passed, requirement.Actual, requirement.AffectedEndpoints, test.actual)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateComplianceWithoutCertificate(t *testing.T) {
+	for profile, endpoint := range compliantEndpoints() {
+		t.Run(profile, func(t *testing.T) {
+			endpoint.Certificate = nil
+			result, err := EvaluateCompliance(&FilteredTLSReport{Host: "example.com", Endpoints: []FilteredEndpoint{endpoint}}, profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Compliant {
+				t.Error("compliant = true, want false without a certificate")
+			}
+		})
+	}
+}
+
+func TestEvaluateComplianceInvalid(t *testing.T) {
+	if _, err := EvaluateCompliance(&FilteredTLSReport{Host: "example.com"}, "hipaa"); err == nil {
+		t.Error("unknown profile: want an error")
+	}
+	result, err := EvaluateCompliance(&FilteredTLSReport{Host: "example.com"}, ProfilePCIDSS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Compliant {
+		t.Error("report without endpoints: compliant = true, want false")
+	}
+}
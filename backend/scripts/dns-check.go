@@ -0,0 +1,591 @@
+package scripts
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	dnsTypeCAA   = 257
+	dnsClassIN   = 1
+	dnsRcodeOK   = 0
+	dnsRcodeNX   = 3
+	dnsFlagTC    = 0x0200
+	dnsHeaderLen = 12
+	dnsMaxName   = 255 // Longest encoded DNS name (RFC 1035)
+)
+
+// Issuer Critical flag of a CAA record (RFC 8659 4.1)
+const caaFlagCritical = 0x80
+
+// CAA property tags understood by a CA, an unknown tag with the critical flag forbids the issuance (RFC 8659 4.5)
+var knownCAATags = map[string]bool{"issue": true, "issuewild": true, "iodef": true, "issuemail": true, "issuevmc": true}
+
+// Possible values of FilteredCAA.IssuerStatus
+const (
+	CAAIssuerPermitted    = "permitted"     // Every certificate issuer is authorized by the CAA records
+	CAAIssuerNotPermitted = "not_permitted" // At least one certificate issuer is not authorized
+	CAAIssuerUnrestricted = "unrestricted"  // There are no issue/issuewild records, any CA may issue
+	CAAIssuerUnknown      = "unknown"       // The issuer could not be mapped to a CAA identifier
+)
+
+/*
+Struct created to hold a single DNS CAA record
+*/
+type CAARecord struct {
+	Flags int64  `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+/*
+Struct created to hold the CAA posture of the host (that is in the FilteredTLSReport struct)
+*/
+type FilteredCAA struct {
+	PolicyHostname string      `json:"policyHostname"` // Name where the records were found (the host or one of its parents)
+	Records        []CAARecord `json:"records"`
+	Source         string      `json:"source"` // "ssllabs" when taken from the report, "dns" when looked up natively
+	IssuerStatus   string      `json:"issuerStatus"`
+	Mismatches     []string    `json:"mismatches"` // Certificate issuers that are not permitted by the records
+}
+
+/*
+CAAResolver is the interface used to look up the CAA records of a DNS name, so the real DNS can be replaced by a local stand-in
+*/
+type CAAResolver interface {
+	LookupCAA(ctx context.Context, name string) ([]CAARecord, error)
+}
+
+/*
+DNSResolver is the native CAAResolver implementation, it sends raw DNS queries to a nameserver over UDP (falling back to TCP on truncation)
+*/
+type DNSResolver struct {
+	Server  string        // Nameserver address in host:port format
+	Timeout time.Duration // Timeout of every query
+}
+
+/*
+StaticCAAResolver is a local DNS stand-in that answers from an in-memory map of name -> records, useful for tests and offline runs
+*/
+type StaticCAAResolver map[string][]CAARecord
+
+/*
+NewDNSResolver creates a DNSResolver that uses the first nameserver of /etc/resolv.conf, or a public resolver if it cannot be read
+
+Returns:
+
+	*DNSResolver: pointer to a new DNSResolver instance
+*/
+func NewDNSResolver() *DNSResolver {
+	server := "8.8.8.8"
+	if file, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				server = fields[1]
+				break
+			}
+		}
+	}
+
+	return &DNSResolver{
+		Server:  net.JoinHostPort(server, "53"),
+		Timeout: 5 * time.Second,
+	}
+}
+
+/*
+LookupCAA returns the records stored in the stand-in for the given name
+Args:
+
+	ctx context.Context: Not used, present to satisfy the CAAResolver interface
+	name string: The DNS name to query
+
+Returns:
+
+	[]CAARecord: The records stored for the name (empty if there are none)
+	error: Always nil
+*/
+func (r StaticCAAResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	return r[strings.TrimSuffix(strings.ToLower(name), ".")], nil
+}
+
+/*
+LookupCAA returns the CAA records published for the exact given name (without climbing to the parent domains)
+Args:
+
+	ctx context.Context: Context to cancel the query
+	name string: The DNS name to query
+
+Returns:
+
+	[]CAARecord: The records found (empty if the name has none or does not exist)
+	error: Any error encountered during the process
+*/
+func (r *DNSResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildDNSQuery(id, name, dnsTypeCAA)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := r.exchange(ctx, "udp", query)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) >= dnsHeaderLen && binary.BigEndian.Uint16(response[2:4])&dnsFlagTC != 0 {
+		if response, err = r.exchange(ctx, "tcp", query); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseCAAResponse(id, response)
+}
+
+/*
+exchange sends a DNS query to the resolver server and returns the raw response
+Args:
+
+	ctx context.Context: Context to cancel the query
+	network string: "udp" or "tcp"
+	query []byte: The DNS message to send
+
+Returns:
+
+	[]byte: The raw DNS response
+	error: Any error encountered during the process
+*/
+func (r *DNSResolver) exchange(ctx context.Context, network string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: r.Timeout}
+	conn, err := dialer.DialContext(ctx, network, r.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(r.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		// DNS over TCP prefixes every message with its length
+		prefixed := make([]byte, 2, len(query)+2)
+		binary.BigEndian.PutUint16(prefixed, uint16(len(query)))
+		if _, err = conn.Write(append(prefixed, query...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err = io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		response := make([]byte, binary.BigEndian.Uint16(length[:]))
+		_, err = io.ReadFull(conn, response)
+		return response, err
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 4096)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+	return response[:n], nil
+}
+
+/*
+buildDNSQuery encodes a recursive DNS query for a single question
+Args:
+
+	id uint16: The message ID
+	name string: The DNS name to query
+	qtype uint16: The record type to query
+
+Returns:
+
+	[]byte: The encoded DNS message
+	error: Any error encountered during the process
+*/
+func buildDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, dnsHeaderLen, 512)
+	binary.BigEndian.PutUint16(msg[0:2], id)
+	binary.BigEndian.PutUint16(msg[2:4], 0x0100) // Recursion desired
+	binary.BigEndian.PutUint16(msg[4:6], 1)      // One question
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	if len(msg)-dnsHeaderLen > dnsMaxName {
+		return nil, fmt.Errorf("DNS name %q longer than %d bytes", name, dnsMaxName)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+
+	return msg, nil
+}
+
+/*
+parseCAAResponse decodes the CAA records of the answer section of a DNS response
+Args:
+
+	id uint16: The expected message ID
+	msg []byte: The raw DNS response
+
+Returns:
+
+	records []CAARecord: The CAA records found in the answers
+	err error: Any error encountered during the process
+*/
+func parseCAAResponse(id uint16, msg []byte) (records []CAARecord, err error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, fmt.Errorf("DNS response too short")
+	}
+	if binary.BigEndian.Uint16(msg[0:2]) != id {
+		return nil, fmt.Errorf("DNS response ID mismatch")
+	}
+	switch rcode := binary.BigEndian.Uint16(msg[2:4]) & 0x000F; rcode {
+	case dnsRcodeOK:
+	case dnsRcodeNX:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("DNS query failed with rcode %d", rcode)
+	}
+
+	questions := binary.BigEndian.Uint16(msg[4:6])
+	answers := binary.BigEndian.Uint16(msg[6:8])
+	offset := dnsHeaderLen
+
+	for i := 0; i < int(questions); i++ {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, err
+		}
+		offset += 4 // qtype + qclass
+		if offset > len(msg) {
+			return nil, fmt.Errorf("DNS question truncated")
+		}
+	}
+
+	for i := 0; i < int(answers); i++ {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, err
+		}
+		if offset+10 > len(msg) {
+			return nil, fmt.Errorf("DNS answer truncated")
+		}
+		rrType := binary.BigEndian.Uint16(msg[offset : offset+2])
+		rdLength := int(binary.BigEndian.Uint16(msg[offset+8 : offset+10]))
+		offset += 10
+		if offset+rdLength > len(msg) {
+			return nil, fmt.Errorf("DNS answer truncated")
+		}
+		rdata := msg[offset : offset+rdLength]
+		offset += rdLength
+
+		if rrType != dnsTypeCAA || len(rdata) < 2 || 2+int(rdata[1]) > len(rdata) {
+			continue // CNAMEs of the chain and malformed records are ignored
+		}
+		tagLength := int(rdata[1])
+		records = append(records, CAARecord{
+			Flags: int64(rdata[0]),
+			Tag:   strings.ToLower(string(rdata[2 : 2+tagLength])),
+			Value: string(rdata[2+tagLength:]),
+		})
+	}
+
+	return records, nil
+}
+
+/*
+skipDNSName returns the offset right after the (possibly compressed) DNS name that starts at offset. The name is not
+decoded, but its labels must fit in the message and in dnsMaxName, and a compression pointer must point to an
+earlier offset of the message (RFC 1035 4.1.4), so a crafted response cannot make the parser loop or read past it
+Args:
+
+	msg []byte: The raw DNS message
+	offset int: Where the name starts
+
+Returns:
+
+	int: The offset after the name
+	error: Any error encountered during the process
+*/
+func skipDNSName(msg []byte, offset int) (int, error) {
+	start := offset
+	for {
+		if offset >= len(msg) {
+			return 0, fmt.Errorf("DNS name out of bounds")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xC0 == 0xC0: // Compression pointer, always ends the name
+			if offset+2 > len(msg) {
+				return 0, fmt.Errorf("DNS compression pointer out of bounds")
+			}
+			if target := int(binary.BigEndian.Uint16(msg[offset:offset+2]) & 0x3FFF); target >= start {
+				return 0, fmt.Errorf("DNS compression pointer to offset %d does not point backwards", target)
+			}
+			return offset + 2, nil
+		case length&0xC0 != 0:
+			return 0, fmt.Errorf("unsupported DNS label type 0x%02x", length&0xC0)
+		default:
+			offset += length + 1
+			if offset-start > dnsMaxName {
+				return 0, fmt.Errorf("DNS name longer than %d bytes", dnsMaxName)
+			}
+		}
+	}
+}
+
+/*
+FindCAAPolicy looks for the relevant CAA record set of a host, climbing the DNS tree (host, parent, grandparent...) as described in RFC 8659
+Args:
+
+	ctx context.Context: Context to cancel the queries
+	resolver CAAResolver: The resolver used to make the queries
+	host string: The host to check
+
+Returns:
+
+	*FilteredCAA: The records found and the name where they were found (Records is empty if no name has CAA)
+	error: Any error encountered during the process
+*/
+func FindCAAPolicy(ctx context.Context, resolver CAAResolver, host string) (*FilteredCAA, error) {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(host), "."), ".")
+	for i := 0; i < len(labels)-1; i++ { // Top level domains are not queried
+		name := strings.Join(labels[i:], ".")
+		records, err := resolver.LookupCAA(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up CAA for %s: %v", name, err)
+		}
+		if len(records) > 0 {
+			return &FilteredCAA{PolicyHostname: name, Records: records, Source: "dns"}, nil
+		}
+	}
+
+	return &FilteredCAA{Source: "dns"}, nil
+}
+
+/*
+extractCAAPolicy assembles the CAA object from the caaPolicy that SSL Labs (v3+) includes in the endpoint details.
+Args:
+
+	endpoints []gjson.Result: The endpoints given by the library gjson
+
+Returns:
+
+	*FilteredCAA: Pointer of the FilteredCAA Struct, nil if no endpoint has a caaPolicy
+*/
+func extractCAAPolicy(endpoints []gjson.Result) *FilteredCAA {
+	for _, endpoint := range endpoints {
+		policy := endpoint.Get("details.caaPolicy")
+		if !policy.Exists() {
+			continue
+		}
+		caa := &FilteredCAA{
+			PolicyHostname: policy.Get("policyHostname").String(),
+			Source:         "ssllabs",
+		}
+		policy.Get("caaRecords").ForEach(func(_, r gjson.Result) bool {
+			caa.Records = append(caa.Records, CAARecord{
+				Flags: r.Get("flags").Int(),
+				Tag:   strings.ToLower(r.Get("tag").String()),
+				Value: r.Get("value").String(),
+			})
+			return true
+		})
+		return caa
+	}
+
+	return nil
+}
+
+/*
+ApplyCAACheck completes the CAA posture of a report: if SSL Labs did not provide the records they are looked up natively,
+then the certificate issuers of every endpoint are verified against them and the summary is regenerated to flag mismatches.
+Args:
+
+	ctx context.Context: Context to cancel the DNS queries
+	report *FilteredTLSReport: The filtered report to complete
+	resolver CAAResolver: The resolver used when the report has no CAA data
+
+Returns:
+
+	error: Any error encountered during the DNS lookup (the report is left without CAA data in that case)
+*/
+func ApplyCAACheck(ctx context.Context, report *FilteredTLSReport, resolver CAAResolver) error {
+	if report == nil {
+		return nil
+	}
+	if report.CAA == nil {
+		caa, err := FindCAAPolicy(ctx, resolver, report.Host)
+		if err != nil {
+			return err
+		}
+		report.CAA = caa
+	}
+
+	evaluateCAAIssuers(report)
+	report.Summary = generateSummary(report)
+
+	return nil
+}
+
+/*
+evaluateCAAIssuers verifies every endpoint certificate issuer against the CAA records of the report and fills IssuerStatus and Mismatches.
+Each certificate is checked against the records of its own tag: issuewild for a wildcard certificate, issue otherwise.
+Args:
+
+	report *FilteredTLSReport: The filtered report with its CAA data
+*/
+func evaluateCAAIssuers(report *FilteredTLSReport) {
+	caa := report.CAA
+	caa.Mismatches = nil
+
+	caa.IssuerStatus = CAAIssuerUnrestricted
+	if len(report.Endpoints) == 0 {
+		if _, restricted := permittedCAs(caa.Records, "issue"); restricted {
+			caa.IssuerStatus = CAAIssuerPermitted
+		}
+		return
+	}
+
+	for _, endpoint := range report.Endpoints {
+		permitted, restricted := permittedCAs(caa.Records, caaIssueTag(endpoint.Certificate))
+		if !restricted {
+			continue // Any CA may issue this certificate
+		}
+		if caa.IssuerStatus == CAAIssuerUnrestricted {
+			caa.IssuerStatus = CAAIssuerPermitted
+		}
+		if endpoint.Certificate == nil || endpoint.Certificate.Issuer == "" {
+			continue
+		}
+		identifiers := caIdentifiersForIssuer(endpoint.Certificate.Issuer)
+		if len(identifiers) == 0 {
+			if caa.IssuerStatus == CAAIssuerPermitted {
+				caa.IssuerStatus = CAAIssuerUnknown
+			}
+			continue
+		}
+		if !containsAny(permitted, identifiers...) && !contains(caa.Mismatches, endpoint.Certificate.Issuer) {
+			caa.IssuerStatus = CAAIssuerNotPermitted
+			caa.Mismatches = append(caa.Mismatches, endpoint.Certificate.Issuer)
+		}
+	}
+}
+
+/*
+caaIssueTag returns the CAA property that authorizes the CA of a certificate
+Args:
+
+	certificate *FilteredCertificate: The certificate, nil if the endpoint has none
+
+Returns:
+
+	string: "issuewild" for a wildcard certificate, "issue" otherwise
+*/
+func caaIssueTag(certificate *FilteredCertificate) string {
+	if certificate != nil && strings.Contains(certificate.Subject, "CN=*.") {
+		return "issuewild"
+	}
+	return "issue"
+}
+
+/*
+permittedCAs returns the CA domains authorized by the issue (or issuewild) records. A record with the critical
+flag and a tag not in knownCAATags authorizes no CA, whatever the issue records say.
+Args:
+
+	records []CAARecord: The CAA record set
+	tag string: "issue" or "issuewild" (issuewild falls back to issue when absent)
+
+Returns:
+
+	permitted []string: The authorized CA domains
+	restricted bool: false if there are no records of the tag, meaning any CA may issue
+*/
+func permittedCAs(records []CAARecord, tag string) (permitted []string, restricted bool) {
+	for _, record := range records {
+		if record.Flags&caaFlagCritical != 0 && !knownCAATags[strings.ToLower(record.Tag)] {
+			return nil, true
+		}
+	}
+
+	for _, record := range records {
+		if record.Tag != tag {
+			continue
+		}
+		restricted = true
+		domain := strings.ToLower(strings.TrimSpace(strings.SplitN(record.Value, ";", 2)[0]))
+		if domain != "" { // An empty value (";") forbids every CA
+			permitted = append(permitted, domain)
+		}
+	}
+
+	if !restricted && tag == "issuewild" {
+		return permittedCAs(records, "issue")
+	}
+	return permitted, restricted
+}
+
+/*
+caIdentifiersForIssuer maps a certificate issuer subject to the CAA identifiers that the CA accepts.
+Args:
+
+	issuer string: The issuer subject (e.g. "CN=R3, O=Let's Encrypt, C=US")
+
+Returns:
+
+	[]string: The CAA domains of the CA, nil if the CA is not known
+*/
+func caIdentifiersForIssuer(issuer string) []string {
+	knownCAs := []struct {
+		match       string
+		identifiers []string
+	}{
+		{"let's encrypt", []string{"letsencrypt.org"}},
+		{"digicert", []string{"digicert.com", "www.digicert.com", "symantec.com", "geotrust.com", "rapidssl.com", "thawte.com"}},
+		{"sectigo", []string{"sectigo.com", "comodoca.com", "comodo.com", "usertrust.com", "trust-provider.com"}},
+		{"comodo", []string{"comodoca.com", "comodo.com", "sectigo.com"}},
+		{"zerossl", []string{"sectigo.com", "zerossl.com"}},
+		{"globalsign", []string{"globalsign.com"}},
+		{"google trust services", []string{"pki.goog", "google.com"}},
+		{"amazon", []string{"amazon.com", "amazontrust.com", "awstrust.com", "amazonaws.com"}},
+		{"godaddy", []string{"godaddy.com", "starfieldtech.com"}},
+		{"starfield", []string{"starfieldtech.com", "godaddy.com"}},
+		{"entrust", []string{"entrust.net", "affirmtrust.com"}},
+		{"buypass", []string{"buypass.com", "buypass.no"}},
+		{"microsoft", []string{"microsoft.com"}},
+		{"cloudflare", []string{"cloudflare.com", "digicert.com", "letsencrypt.org", "pki.goog"}},
+	}
+
+	lowerIssuer := strings.ToLower(issuer)
+	for _, ca := range knownCAs {
+		if strings.Contains(lowerIssuer, ca.match) {
+			return ca.identifiers
+		}
+	}
+	return nil
+}
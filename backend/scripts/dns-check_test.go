@@ -0,0 +1,433 @@
+package scripts
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+dnsName encodes a DNS name without compression
+*/
+func dnsName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(name, ".") {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+/*
+caaRData encodes the data of a CAA record
+*/
+func caaRData(flags byte, tag, value string) []byte {
+	return append(append([]byte{flags, byte(len(tag))}, tag...), value...)
+}
+
+/*
+Struct created to hold an answer of a crafted DNS response
+*/
+type testAnswer struct {
+	name   []byte // Encoded owner name, a pointer to the question (0xC0 0x0C) when nil
+	rrType uint16
+	rdata  []byte
+}
+
+/*
+dnsResponse crafts a DNS response for the CAA question of example.com
+*/
+func dnsResponse(id uint16, rcode uint16, answers ...testAnswer) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = binary.BigEndian.AppendUint16(msg, 0x8180|rcode) // Response, recursion desired and available
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(answers)))
+	msg = append(msg, 0, 0, 0, 0) // No authority nor additional records
+
+	msg = append(msg, dnsName("example.com")...)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeCAA)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	for _, answer := range answers {
+		name := answer.name
+		if name == nil {
+			name = []byte{0xC0, dnsHeaderLen}
+		}
+		msg = append(msg, name...)
+		msg = binary.BigEndian.AppendUint16(msg, answer.rrType)
+		msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+		msg = binary.BigEndian.AppendUint32(msg, 300)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(answer.rdata)))
+		msg = append(msg, answer.rdata...)
+	}
+	return msg
+}
+
+func TestParseCAAResponse(t *testing.T) {
+	const id = 0x1234
+	valid := dnsResponse(id, dnsRcodeOK, testAnswer{rrType: dnsTypeCAA, rdata: caaRData(0, "issue", "letsencrypt.org")})
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    []CAARecord
+		wantErr bool
+	}{
+		{
+			name: "single record",
+			msg:  valid,
+			want: []CAARecord{{Flags: 0, Tag: "issue", Value: "letsencrypt.org"}},
+		},
+		{
+			name: "CNAME of the chain and uppercase tag",
+			msg: dnsResponse(id, dnsRcodeOK,
+				testAnswer{rrType: 5, rdata: dnsName("cdn.example.net")},
+				testAnswer{name: dnsName("cdn.example.net"), rrType: dnsTypeCAA, rdata: caaRData(128, "ISSUEWILD", ";")},
+				testAnswer{name: []byte{0xC0, dnsHeaderLen}, rrType: dnsTypeCAA, rdata: caaRData(0, "iodef", "mailto:security@example.com")},
+			),
+			want: []CAARecord{{Flags: 128, Tag: "issuewild", Value: ";"}, {Flags: 0, Tag: "iodef", Value: "mailto:security@example.com"}},
+		},
+		{
+			name: "malformed CAA data is ignored",
+			msg:  dnsResponse(id, dnsRcodeOK, testAnswer{rrType: dnsTypeCAA, rdata: []byte{0, 20, 'i'}}),
+		},
+		{name: "NXDOMAIN", msg: dnsResponse(id, dnsRcodeNX)},
+		{name: "SERVFAIL", msg: dnsResponse(id, 2), wantErr: true},
+		{name: "ID mismatch", msg: dnsResponse(id+1, dnsRcodeOK), wantErr: true},
+		{name: "shorter than the header", msg: valid[:dnsHeaderLen-1], wantErr: true},
+		{name: "question truncated", msg: valid[:dnsHeaderLen+len(dnsName("example.com"))+2], wantErr: true},
+		{name: "record data truncated", msg: valid[:len(valid)-1], wantErr: true},
+		{name: "answer header truncated", msg: valid[:len(valid)-len("letsencrypt.org")-9], wantErr: true},
+		{
+			name:    "pointer cut at the end of the message",
+			msg:     dnsResponse(id, dnsRcodeOK, testAnswer{rrType: dnsTypeCAA})[:dnsHeaderLen+len(dnsName("example.com"))+5],
+			wantErr: true,
+		},
+		{
+			name:    "pointer to itself",
+			msg:     dnsResponse(id, dnsRcodeOK, testAnswer{name: []byte{0xC0, byte(dnsHeaderLen + len(dnsName("example.com")) + 4)}, rrType: dnsTypeCAA}),
+			wantErr: true,
+		},
+		{
+			name:    "pointer past the end",
+			msg:     dnsResponse(id, dnsRcodeOK, testAnswer{name: []byte{0xFF, 0xFF}, rrType: dnsTypeCAA}),
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, err := parseCAAResponse(id, test.msg)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(records, test.want) {
+				t.Errorf("records = %+v, want %+v", records, test.want)
+			}
+		})
+	}
+}
+
+func TestSkipDNSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     []byte
+		offset  int
+		want    int
+		wantErr bool
+	}{
+		{name: "root", msg: []byte{0}, want: 1},
+		{name: "labels", msg: dnsName("www.example.com"), want: 17},
+		{name: "labels and pointer", msg: append(append(dnsName("com"), 3, 'w', 'w', 'w'), 0xC0, 0), offset: 5, want: 11},
+		{name: "pointer", msg: append(dnsName("com"), 0xC0, 0), offset: 5, want: 7},
+		{name: "pointer without its second byte", msg: append(dnsName("com"), 0xC0), offset: 5, wantErr: true},
+		{name: "pointer to itself", msg: append(dnsName("com"), 0xC0, 5), offset: 5, wantErr: true},
+		{name: "pointer into its own labels", msg: append(dnsName("com"), 1, 'a', 0xC0, 5), offset: 5, wantErr: true},
+		{name: "forward pointer", msg: []byte{0xC0, 2, 0}, wantErr: true},
+		{name: "label past the end", msg: []byte{5, 'a', 'b'}, wantErr: true},
+		{name: "missing terminator", msg: []byte{1, 'a'}, wantErr: true},
+		{name: "offset past the end", msg: []byte{0}, offset: 1, wantErr: true},
+		{name: "reserved label type", msg: []byte{0x40, 0}, wantErr: true},
+		{name: "name too long", msg: append([]byte(strings.Repeat("\x3f"+strings.Repeat("a", 63), 5)), 0), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := skipDNSName(test.msg, test.offset)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && got != test.want {
+				t.Errorf("offset = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+/*
+Struct created to count the names a CAA resolver is asked for and fail on one of them
+*/
+type recordingResolver struct {
+	StaticCAAResolver
+	queried []string
+	failing string
+}
+
+func (r *recordingResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	r.queried = append(r.queried, name)
+	if name == r.failing {
+		return nil, errors.New("SERVFAIL")
+	}
+	return r.StaticCAAResolver.LookupCAA(ctx, name)
+}
+
+func TestFindCAAPolicy(t *testing.T) {
+	parentRecords := []CAARecord{{Tag: "issue", Value: "letsencrypt.org"}}
+	hostRecords := []CAARecord{{Tag: "issue", Value: "digicert.com"}}
+	records := StaticCAAResolver{
+		"example.com":     parentRecords,
+		"api.example.com": hostRecords,
+		"org":             {{Tag: "issue", Value: "tld.example"}}, // Never used, the top level domains are not queried
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		failing string
+		policy  string
+		records []CAARecord
+		queried []string
+		wantErr bool
+	}{
+		{
+			name:    "records of a parent",
+			host:    "www.shop.example.com",
+			policy:  "example.com",
+			records: parentRecords,
+			queried: []string{"www.shop.example.com", "shop.example.com", "example.com"},
+		},
+		{
+			name:    "records of the host win",
+			host:    "api.example.com",
+			policy:  "api.example.com",
+			records: hostRecords,
+			queried: []string{"api.example.com"},
+		},
+		{
+			name:    "uppercase host with trailing dot",
+			host:    "WWW.Example.COM.",
+			policy:  "example.com",
+			records: parentRecords,
+			queried: []string{"www.example.com", "example.com"},
+		},
+		{
+			name:    "top level domain is not queried",
+			host:    "www.example.org",
+			queried: []string{"www.example.org", "example.org"},
+		},
+		{
+			name:    "lookup error",
+			host:    "www.example.com",
+			failing: "www.example.com",
+			queried: []string{"www.example.com"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolver := &recordingResolver{StaticCAAResolver: records, failing: test.failing}
+			caa, err := FindCAAPolicy(context.Background(), resolver, test.host)
+			if !reflect.DeepEqual(resolver.queried, test.queried) {
+				t.Errorf("queried = %v, want %v", resolver.queried, test.queried)
+			}
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if caa.Source != "dns" || caa.PolicyHostname != test.policy || !reflect.DeepEqual(caa.Records, test.records) {
+				t.Errorf("policy = %+v, want %s with %+v", caa, test.policy, test.records)
+			}
+		})
+	}
+}
+
+func TestEvaluateCAAIssuers(t *testing.T) {
+	const (
+		letsEncrypt = "CN=R3, O=Let's Encrypt, C=US"
+		digiCert    = "CN=DigiCert TLS RSA SHA256 2020 CA1, O=DigiCert Inc, C=US"
+		unknownCA   = "CN=Example Private CA, O=Example"
+	)
+	certificate := func(subject, issuer string) FilteredEndpoint {
+		return FilteredEndpoint{Certificate: &FilteredCertificate{Subject: subject, Issuer: issuer}}
+	}
+	issue := func(value string) CAARecord { return CAARecord{Tag: "issue", Value: value} }
+	issueWild := func(value string) CAARecord { return CAARecord{Tag: "issuewild", Value: value} }
+
+	tests := []struct {
+		name       string
+		records    []CAARecord
+		endpoints  []FilteredEndpoint
+		status     string
+		mismatches []string
+	}{
+		{
+			name:      "no records",
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:    CAAIssuerUnrestricted,
+		},
+		{
+			name:      "only other tags",
+			records:   []CAARecord{{Tag: "iodef", Value: "mailto:security@example.com"}},
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:    CAAIssuerUnrestricted,
+		},
+		{
+			name:      "permitted issuer with parameters",
+			records:   []CAARecord{issue("LetsEncrypt.org; validationmethods=dns-01")},
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:    CAAIssuerPermitted,
+		},
+		{
+			name:       "issuer not permitted, reported once",
+			records:    []CAARecord{issue("digicert.com")},
+			endpoints:  []FilteredEndpoint{certificate("CN=example.com", letsEncrypt), certificate("CN=example.com", letsEncrypt)},
+			status:     CAAIssuerNotPermitted,
+			mismatches: []string{letsEncrypt},
+		},
+		{
+			name:       "empty value forbids every CA",
+			records:    []CAARecord{issue(";")},
+			endpoints:  []FilteredEndpoint{certificate("CN=example.com", digiCert)},
+			status:     CAAIssuerNotPermitted,
+			mismatches: []string{digiCert},
+		},
+		{
+			name:      "unknown issuer",
+			records:   []CAARecord{issue("letsencrypt.org")},
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", unknownCA)},
+			status:    CAAIssuerUnknown,
+		},
+		{
+			name:      "endpoint without certificate",
+			records:   []CAARecord{issue("letsencrypt.org")},
+			endpoints: []FilteredEndpoint{{}},
+			status:    CAAIssuerPermitted,
+		},
+		{
+			name:    "each certificate is checked against its own tag",
+			records: []CAARecord{issue("letsencrypt.org"), issueWild("digicert.com")},
+			endpoints: []FilteredEndpoint{
+				certificate("CN=www.example.com", letsEncrypt),
+				certificate("CN=*.example.com", digiCert),
+			},
+			status: CAAIssuerPermitted,
+		},
+		{
+			name:       "issue does not authorize a wildcard when issuewild is present",
+			records:    []CAARecord{issue("letsencrypt.org"), issueWild("digicert.com")},
+			endpoints:  []FilteredEndpoint{certificate("CN=*.example.com", letsEncrypt)},
+			status:     CAAIssuerNotPermitted,
+			mismatches: []string{letsEncrypt},
+		},
+		{
+			name:       "issuewild does not authorize a single name certificate",
+			records:    []CAARecord{issue("letsencrypt.org"), issueWild("digicert.com")},
+			endpoints:  []FilteredEndpoint{certificate("CN=example.com", digiCert)},
+			status:     CAAIssuerNotPermitted,
+			mismatches: []string{digiCert},
+		},
+		{
+			name:      "wildcard falls back to issue",
+			records:   []CAARecord{issue("letsencrypt.org")},
+			endpoints: []FilteredEndpoint{certificate("CN=*.example.com", letsEncrypt)},
+			status:    CAAIssuerPermitted,
+		},
+		{
+			name:      "only issuewild leaves single name certificates unrestricted",
+			records:   []CAARecord{issueWild(";")},
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:    CAAIssuerUnrestricted,
+		},
+		{
+			name:    "report without endpoints",
+			records: []CAARecord{issue("letsencrypt.org")},
+			status:  CAAIssuerPermitted,
+		},
+		{
+			name:       "unknown critical tag forbids every CA",
+			records:    []CAARecord{issue("letsencrypt.org"), {Flags: caaFlagCritical, Tag: "tbs", Value: "unknown"}},
+			endpoints:  []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:     CAAIssuerNotPermitted,
+			mismatches: []string{letsEncrypt},
+		},
+		{
+			name:       "unknown critical tag without issue records",
+			records:    []CAARecord{{Flags: 128, Tag: "future", Value: "x"}},
+			endpoints:  []FilteredEndpoint{certificate("CN=*.example.com", digiCert)},
+			status:     CAAIssuerNotPermitted,
+			mismatches: []string{digiCert},
+		},
+		{
+			name:      "unknown tag without the critical flag is ignored",
+			records:   []CAARecord{issue("letsencrypt.org"), {Tag: "future", Value: "x"}},
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:    CAAIssuerPermitted,
+		},
+		{
+			name:      "known critical tag",
+			records:   []CAARecord{{Flags: caaFlagCritical, Tag: "issue", Value: "letsencrypt.org"}, {Flags: caaFlagCritical, Tag: "iodef", Value: "mailto:security@example.com"}},
+			endpoints: []FilteredEndpoint{certificate("CN=example.com", letsEncrypt)},
+			status:    CAAIssuerPermitted,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := &FilteredTLSReport{
+				Host:      "example.com",
+				Endpoints: test.endpoints,
+				CAA:       &FilteredCAA{Records: test.records, Mismatches: []string{"stale"}},
+			}
+			evaluateCAAIssuers(report)
+			if report.CAA.IssuerStatus != test.status || !reflect.DeepEqual(report.CAA.Mismatches, test.mismatches) {
+				t.Errorf("status = %s with mismatches %v, want %s with %v", report.CAA.IssuerStatus, report.CAA.Mismatches, test.status, test.mismatches)
+			}
+		})
+	}
+}
+
+func TestBuildDNSQuery(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	longest := strings.Join([]string{label, label, label, strings.Repeat("b", 61)}, ".") // 253 characters, 255 bytes encoded
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "example.com"},
+		{name: "example.com."},
+		{name: longest},
+		{name: longest + "."},
+		{name: longest + "b", wantErr: true},
+		{name: longest + ".c", wantErr: true},
+		{name: label + "a.example.com", wantErr: true},
+		{name: "example..com", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, test := range tests {
+		msg, err := buildDNSQuery(0x1234, test.name, dnsTypeCAA)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("buildDNSQuery(%d bytes): want an error", len(test.name))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("buildDNSQuery(%q): %v", test.name, err)
+			continue
+		}
+		if question := dnsName(strings.TrimSuffix(test.name, ".")); !reflect.DeepEqual(msg[dnsHeaderLen:len(msg)-4], question) {
+			t.Errorf("buildDNSQuery(%q) question = %v, want %v", test.name, msg[dnsHeaderLen:len(msg)-4], question)
+		}
+	}
+}
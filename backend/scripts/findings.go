@@ -0,0 +1,285 @@
+package scripts
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Severities of a finding, from the most to the least serious
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info" // Positive or purely informative observations
+)
+
+// Stable codes of the findings, they never change so external integrations can rely on them
+const (
+	FindingGradeDragged          = "TLS_GRADE_DRAGGED"
+	FindingTLS13Supported        = "TLS_13_SUPPORTED"
+	FindingNoTLS13               = "TLS_NO_TLS13"
+	FindingObsoleteProtocols     = "TLS_OBSOLETE_PROTOCOLS"
+	FindingLegacyProtocols       = "TLS_LEGACY_PROTOCOLS"
+	FindingStrongCipher          = "TLS_STRONG_CIPHER"
+	FindingAcceptableCipher      = "TLS_ACCEPTABLE_CIPHER"
+	FindingWeakCipherStrength    = "TLS_WEAK_CIPHER_STRENGTH"
+	FindingWeakCipherSuites      = "TLS_WEAK_CIPHER_SUITES"
+	FindingHSTSPresent           = "TLS_HSTS_PRESENT"
+	FindingNoHSTS                = "TLS_NO_HSTS"
+	FindingCertValid             = "CERT_VALID"
+	FindingCertExpiring          = "CERT_EXPIRING"
+	FindingCertExpired           = "CERT_EXPIRED"
+	FindingWarnings              = "TLS_WARNINGS"
+	FindingExceptional           = "TLS_EXCEPTIONAL"
+	FindingChainIssues           = "CERT_CHAIN_ISSUES"
+	FindingCAAIssuerNotPermitted = "CAA_ISSUER_NOT_PERMITTED"
+	FindingCAAIssuerPermitted    = "CAA_ISSUER_PERMITTED"
+	FindingCAANotPresent         = "CAA_NOT_PRESENT"
+)
+
+// Days before the certificate expiration when it starts to be reported as expiring
+const certExpiringThresholdDays = 30.0
+
+/*
+Struct created to hold a single observation of the TLS analysis (that is in the FilteredTLSReport struct)
+*/
+type Finding struct {
+	Code              string   `json:"code"`
+	Severity          string   `json:"severity"`
+	Message           string   `json:"message"`           // Localized description, used to build the summary
+	AffectedEndpoints []string `json:"affectedEndpoints"` // IP addresses of the endpoints where it was observed
+	Evidence          string   `json:"evidence"`
+	Remediation       string   `json:"remediation"`    // Localized remediation hint, empty for informative findings
+	Args              []string `json:"args,omitempty"` // Values of the message placeholders, kept to localize the finding again
+}
+
+/*
+buildFindings analyzes every endpoint of the report and returns the list of findings, in the same order they are shown in the summary.
+The texts of the findings are filled later by localizeFindings.
+
+Args:
+
+	reportInfo *FilteredTLSReport: The filtered report containing host and endpoints data.
+
+Returns:
+
+	findings []Finding: The findings of the report
+*/
+func buildFindings(reportInfo *FilteredTLSReport) (findings []Finding) {
+	endpoints := reportInfo.Endpoints
+
+	// Endpoints dragging the grade down
+	if dragging := draggingEndpoints(endpoints); len(dragging) > 0 {
+		var described []string
+		for _, ep := range dragging {
+			described = append(described, fmt.Sprintf("%s (%s)", ep.IPAddress, ep.Grade))
+		}
+		findings = append(findings, Finding{
+			Code:              FindingGradeDragged,
+			Severity:          SeverityMedium,
+			Args:              []string{strings.Join(described, ", ")},
+			AffectedEndpoints: affectedEndpoints(dragging, nil),
+			Evidence:          "grades=" + strings.Join(described, ", "),
+		})
+	}
+
+	// Protocols
+	withTLS13 := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return contains(ep.Protocols, "TLS 1.3") })
+	onlyTLS12 := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+		return !contains(ep.Protocols, "TLS 1.3") && contains(ep.Protocols, "TLS 1.2")
+	})
+	obsolete := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return !containsAny(ep.Protocols, "TLS 1.3", "TLS 1.2") })
+	if len(withTLS13) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingTLS13Supported,
+			Severity:          SeverityInfo,
+			AffectedEndpoints: withTLS13,
+			Evidence:          "protocols include TLS 1.3",
+		})
+	}
+	if len(onlyTLS12) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingNoTLS13,
+			Severity:          SeverityLow,
+			AffectedEndpoints: onlyTLS12,
+			Evidence:          "highest protocol is TLS 1.2",
+		})
+	}
+	if len(obsolete) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingObsoleteProtocols,
+			Severity:          SeverityHigh,
+			AffectedEndpoints: obsolete,
+			Evidence:          "neither TLS 1.2 nor TLS 1.3 are supported",
+		})
+	}
+	if legacy := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+		return containsAny(ep.Protocols, "TLS 1.0", "TLS 1.1", "SSL 3.0", "SSL 2.0")
+	}); len(legacy) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingLegacyProtocols,
+			Severity:          SeverityMedium,
+			AffectedEndpoints: legacy,
+			Evidence:          "protocols include SSL, TLS 1.0 or TLS 1.1",
+		})
+	}
+
+	// Cipher strength
+	minMaxCipherStrength := endpoints[0].MaxCipherStrength
+	for _, ep := range endpoints {
+		if ep.MaxCipherStrength < minMaxCipherStrength {
+			minMaxCipherStrength = ep.MaxCipherStrength
+		}
+	}
+	cipherEvidence := fmt.Sprintf("maxCipherStrength=%.0f", minMaxCipherStrength)
+	switch {
+	case minMaxCipherStrength >= 256:
+		findings = append(findings, Finding{Code: FindingStrongCipher, Severity: SeverityInfo, AffectedEndpoints: affectedEndpoints(endpoints, nil), Evidence: cipherEvidence})
+	case minMaxCipherStrength >= 128:
+		findings = append(findings, Finding{Code: FindingAcceptableCipher, Severity: SeverityInfo, AffectedEndpoints: affectedEndpoints(endpoints, nil), Evidence: cipherEvidence})
+	default:
+		findings = append(findings, Finding{
+			Code:              FindingWeakCipherStrength,
+			Severity:          SeverityHigh,
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return ep.MaxCipherStrength < 128 }),
+			Evidence:          cipherEvidence,
+		})
+	}
+	if weak := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return ep.HasWeakCiphers }); len(weak) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingWeakCipherSuites,
+			Severity:          SeverityMedium,
+			AffectedEndpoints: weak,
+			Evidence:          "cipher suites with strength < 112 bits",
+		})
+	}
+
+	// HSTS
+	if withHSTS := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return isHSTSPresent(ep.HSTS) }); len(withHSTS) > 0 {
+		findings = append(findings, Finding{Code: FindingHSTSPresent, Severity: SeverityInfo, AffectedEndpoints: withHSTS, Evidence: "hsts.status=present"})
+	}
+	if withoutHSTS := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return !isHSTSPresent(ep.HSTS) }); len(withoutHSTS) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingNoHSTS,
+			Severity:          SeverityMedium,
+			AffectedEndpoints: withoutHSTS,
+			Evidence:          "hsts.status!=present",
+		})
+	}
+
+	// Certificate
+	findings = append(findings, certificateFindings(endpoints)...)
+
+	// Warnings and exceptions
+	if warnings := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return ep.HasWarnings }); len(warnings) > 0 {
+		findings = append(findings, Finding{Code: FindingWarnings, Severity: SeverityLow, AffectedEndpoints: warnings, Evidence: "hasWarnings=true"})
+	}
+	if exceptional := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return ep.IsExceptional }); len(exceptional) > 0 {
+		findings = append(findings, Finding{Code: FindingExceptional, Severity: SeverityInfo, AffectedEndpoints: exceptional, Evidence: "isExceptional=true"})
+	}
+	if chain := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return ep.ChainIssues > 0 }); len(chain) > 0 {
+		findings = append(findings, Finding{Code: FindingChainIssues, Severity: SeverityMedium, AffectedEndpoints: chain, Evidence: "chain.issues>0"})
+	}
+
+	// CAA
+	if caa := reportInfo.CAA; caa != nil {
+		switch caa.IssuerStatus {
+		case CAAIssuerNotPermitted:
+			findings = append(findings, Finding{
+				Code:     FindingCAAIssuerNotPermitted,
+				Severity: SeverityHigh,
+				Args:     []string{strings.Join(caa.Mismatches, "; ")},
+				AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+					return ep.Certificate != nil && contains(caa.Mismatches, ep.Certificate.Issuer)
+				}),
+				Evidence: "CAA records at " + caa.PolicyHostname,
+			})
+		case CAAIssuerPermitted:
+			findings = append(findings, Finding{Code: FindingCAAIssuerPermitted, Severity: SeverityInfo, Evidence: "CAA records at " + caa.PolicyHostname})
+		case CAAIssuerUnrestricted:
+			findings = append(findings, Finding{Code: FindingCAANotPresent, Severity: SeverityLow, Evidence: "no CAA issue records"})
+		}
+	}
+
+	return findings
+}
+
+/*
+certificateFindings classifies the certificates of the endpoints as valid, expiring or expired.
+
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+
+Returns:
+
+	findings []Finding: The certificate findings
+*/
+func certificateFindings(endpoints []FilteredEndpoint) (findings []Finding) {
+	expiresInDays := func(ep FilteredEndpoint) float64 {
+		if ep.Certificate == nil {
+			return 0
+		}
+		return ep.Certificate.ExpiresInDays
+	}
+
+	minExpiresDays := expiresInDays(endpoints[0])
+	for _, ep := range endpoints {
+		minExpiresDays = math.Min(minExpiresDays, expiresInDays(ep))
+	}
+
+	if minExpiresDays > certExpiringThresholdDays {
+		return append(findings, Finding{Code: FindingCertValid, Severity: SeverityInfo, AffectedEndpoints: affectedEndpoints(endpoints, nil), Evidence: fmt.Sprintf("expiresInDays=%.1f", minExpiresDays)})
+	}
+
+	minExpiringDays := certExpiringThresholdDays
+	expiring := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+		if expiresInDays(ep) > 0 && expiresInDays(ep) <= certExpiringThresholdDays {
+			minExpiringDays = math.Min(minExpiringDays, expiresInDays(ep))
+			return true
+		}
+		return false
+	})
+	if len(expiring) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingCertExpiring,
+			Severity:          SeverityHigh,
+			Args:              []string{fmt.Sprintf("%.1f", minExpiringDays)},
+			AffectedEndpoints: expiring,
+			Evidence:          fmt.Sprintf("expiresInDays=%.1f", minExpiringDays),
+		})
+	}
+	if expired := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return expiresInDays(ep) <= 0 }); len(expired) > 0 {
+		findings = append(findings, Finding{
+			Code:              FindingCertExpired,
+			Severity:          SeverityCritical,
+			AffectedEndpoints: expired,
+			Evidence:          fmt.Sprintf("expiresInDays=%.1f", minExpiresDays),
+		})
+	}
+
+	return findings
+}
+
+/*
+affectedEndpoints returns the IP addresses of the endpoints that match a condition.
+
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+	match func(FilteredEndpoint) bool: The condition, nil matches every endpoint
+
+Returns:
+
+	ips []string: The IP addresses of the matching endpoints
+*/
+func affectedEndpoints(endpoints []FilteredEndpoint, match func(FilteredEndpoint) bool) (ips []string) {
+	for _, ep := range endpoints {
+		if match == nil || match(ep) {
+			ips = append(ips, ep.IPAddress)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,159 @@
+package scripts
+
+import "time"
+
+// Strategies available to combine the endpoint grades into the domain grade
+const (
+	AggregationWorst    = "worst"    // The domain is as good as its weakest endpoint
+	AggregationBest     = "best"     // The domain is as good as its strongest endpoint
+	AggregationMajority = "majority" // The most repeated grade, ties are resolved with the worst grade
+)
+
+// DefaultAggregation is the strategy used when none is given
+const DefaultAggregation = AggregationWorst
+
+/*
+Struct created to hold the options used to filter a raw SSL Labs report
+*/
+type FilterOptions struct {
+	Aggregation     string    // Strategy used to compute the domain grade (worst, best or majority)
+	Language        string    // Language of the summary and texts (es or en)
+	RequireTestTime bool      // Reject the reports without testTime (or startTime) instead of using the current time (historic reports)
+	ScanRequestID   string    // ID of the scan request the report belongs to, if any
+	RequestedAt     time.Time // When the scan was requested, a report tested before came from the SSL Labs cache
+}
+
+/*
+IsValidAggregation checks if the given strategy is one of the supported aggregation strategies.
+
+Args:
+
+	aggregation string: The strategy name
+
+Returns:
+
+	bool: true if the strategy is supported, false otherwise
+*/
+func IsValidAggregation(aggregation string) bool {
+	return aggregation == AggregationWorst || aggregation == AggregationBest || aggregation == AggregationMajority
+}
+
+/*
+aggregateGrade combines the grades of all the endpoints into a single domain grade.
+
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+	aggregation string: The strategy to use (worst, best or majority), unknown values fall back to DefaultAggregation
+
+Returns:
+
+	string: The domain grade ("F" if there are no endpoints)
+*/
+func aggregateGrade(endpoints []FilteredEndpoint, aggregation string) string {
+	if len(endpoints) == 0 {
+		return "F"
+	}
+	if !IsValidAggregation(aggregation) {
+		aggregation = DefaultAggregation
+	}
+
+	grade := endpoints[0].Grade
+	switch aggregation {
+	case AggregationBest:
+		for _, endpoint := range endpoints {
+			if getGradePriority(endpoint.Grade) > getGradePriority(grade) {
+				grade = endpoint.Grade
+			}
+		}
+	case AggregationMajority:
+		counts := make(map[string]int)
+		for _, endpoint := range endpoints {
+			counts[endpoint.Grade]++
+		}
+		for candidate, count := range counts {
+			if count > counts[grade] || (count == counts[grade] && getGradePriority(candidate) < getGradePriority(grade)) {
+				grade = candidate
+			}
+		}
+	default:
+		for _, endpoint := range endpoints {
+			if getGradePriority(endpoint.Grade) < getGradePriority(grade) {
+				grade = endpoint.Grade
+			}
+		}
+	}
+
+	return grade
+}
+
+// Verdict of each SSL Labs endpoint grade: T (certificate not trusted) and M (certificate name mismatch) are
+// graded apart from the letters and rank with F
+var endpointGradeVerdicts = map[string]string{
+	"A+": VerdictExcellent,
+	"A":  VerdictGood,
+	"A-": VerdictGood,
+	"B+": VerdictAcceptable, "B": VerdictAcceptable, "B-": VerdictAcceptable,
+	"C+": VerdictAcceptable, "C": VerdictAcceptable, "C-": VerdictAcceptable,
+	"D+": VerdictPoor, "D": VerdictPoor, "D-": VerdictPoor,
+	"E+": VerdictPoor, "E": VerdictPoor, "E-": VerdictPoor,
+	"F": VerdictVeryPoor,
+	"T": VerdictVeryPoor,
+	"M": VerdictVeryPoor,
+}
+
+/*
+endpointVerdict computes the verdict of a single endpoint from endpointGradeVerdicts, with the upgrade and
+downgrade rules of the domain verdict: an exceptional A without warnings, with TLS 1.3 and HSTS is EXCELLENT,
+and an A- without TLS 1.3 or HSTS is ACCEPTABLE.
+
+Args:
+
+	endpoint FilteredEndpoint: The endpoint to evaluate
+
+Returns:
+
+	string: The language-neutral verdict of the endpoint (e.g. VerdictExcellent), VerdictVeryPoor for an unknown grade
+*/
+func endpointVerdict(endpoint FilteredEndpoint) string {
+	verdict, ok := endpointGradeVerdicts[endpoint.Grade]
+	if !ok {
+		return VerdictVeryPoor
+	}
+	hasTLS13, hasHSTS := contains(endpoint.Protocols, "TLS 1.3"), isHSTSPresent(endpoint.HSTS)
+	switch endpoint.Grade {
+	case "A":
+		if endpoint.IsExceptional && !endpoint.HasWarnings && hasTLS13 && hasHSTS {
+			verdict = VerdictExcellent
+		}
+	case "A-":
+		if !hasTLS13 || !hasHSTS {
+			verdict = VerdictAcceptable
+		}
+	}
+	return verdict
+}
+
+/*
+draggingEndpoints returns the endpoints whose grade is lower than the best grade of the domain,
+that is, the endpoints that drag the domain down.
+
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+
+Returns:
+
+	[]FilteredEndpoint: The dragging endpoints, empty if every endpoint has the same grade
+*/
+func draggingEndpoints(endpoints []FilteredEndpoint) []FilteredEndpoint {
+	bestPriority := getGradePriority(aggregateGrade(endpoints, AggregationBest))
+
+	var dragging []FilteredEndpoint
+	for _, endpoint := range endpoints {
+		if getGradePriority(endpoint.Grade) < bestPriority {
+			dragging = append(dragging, endpoint)
+		}
+	}
+	return dragging
+}
@@ -0,0 +1,64 @@
+package scripts
+
+import "testing"
+
+func TestEndpointVerdict(t *testing.T) {
+	modern := FilteredEndpoint{Protocols: []string{"TLS 1.2", "TLS 1.3"}, HSTS: &FilteredHSTS{Status: "present"}}
+	tests := []struct {
+		name        string
+		grade       string
+		exceptional bool
+		legacy      bool // Without TLS 1.3 nor HSTS
+		want        string
+	}{
+		{name: "A+", grade: "A+", want: VerdictExcellent},
+		{name: "exceptional A", grade: "A", exceptional: true, want: VerdictExcellent},
+		{name: "A", grade: "A", want: VerdictGood},
+		{name: "exceptional legacy A", grade: "A", exceptional: true, legacy: true, want: VerdictGood},
+		{name: "A-", grade: "A-", want: VerdictGood},
+		{name: "legacy A-", grade: "A-", legacy: true, want: VerdictAcceptable},
+		{name: "B+", grade: "B+", want: VerdictAcceptable},
+		{name: "B", grade: "B", want: VerdictAcceptable},
+		{name: "C-", grade: "C-", want: VerdictAcceptable},
+		{name: "D", grade: "D", want: VerdictPoor},
+		{name: "E-", grade: "E-", want: VerdictPoor},
+		{name: "F", grade: "F", want: VerdictVeryPoor},
+		{name: "not trusted", grade: "T", want: VerdictVeryPoor},
+		{name: "name mismatch", grade: "M", want: VerdictVeryPoor},
+		{name: "unknown", grade: "Z", want: VerdictVeryPoor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := modern
+			if test.legacy {
+				endpoint = FilteredEndpoint{Protocols: []string{"TLS 1.2"}}
+			}
+			endpoint.Grade, endpoint.IsExceptional = test.grade, test.exceptional
+			if got := endpointVerdict(endpoint); got != test.want {
+				t.Errorf("endpointVerdict(%s) = %s, want %s", test.grade, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndpointVerdictFollowsGrades(t *testing.T) {
+	rank := map[string]int{VerdictVeryPoor: 0, VerdictPoor: 1, VerdictAcceptable: 2, VerdictGood: 3, VerdictExcellent: 4}
+	for _, legacy := range []bool{false, true} {
+		endpoint := func(grade string) FilteredEndpoint {
+			if legacy {
+				return FilteredEndpoint{Grade: grade, Protocols: []string{"TLS 1.2"}}
+			}
+			return FilteredEndpoint{Grade: grade, Protocols: []string{"TLS 1.3"}, HSTS: &FilteredHSTS{Status: "present"}}
+		}
+		for better := range endpointGradeVerdicts {
+			for worse := range endpointGradeVerdicts {
+				if getGradePriority(better) <= getGradePriority(worse) {
+					continue
+				}
+				if betterVerdict, worseVerdict := endpointVerdict(endpoint(better)), endpointVerdict(endpoint(worse)); rank[betterVerdict] < rank[worseVerdict] {
+					t.Errorf("legacy %v: %s is %s, below %s with %s", legacy, better, betterVerdict, worse, worseVerdict)
+				}
+			}
+		}
+	}
+}
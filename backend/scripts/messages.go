@@ -0,0 +1,298 @@
+package scripts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Languages supported by the message catalog
+const (
+	LanguageSpanish = "es"
+	LanguageEnglish = "en"
+)
+
+// DefaultLanguage is the language used when none (or an unsupported one) is requested
+const DefaultLanguage = LanguageSpanish
+
+// Language-neutral verdict values, the localized text is stored next to them
+const (
+	VerdictExcellent  = "EXCELLENT"
+	VerdictGood       = "GOOD"
+	VerdictAcceptable = "ACCEPTABLE"
+	VerdictPoor       = "POOR"
+	VerdictVeryPoor   = "VERY_POOR"
+)
+
+// Position of each verdict from the worst to the best, used to sort by verdict
+var verdictOrder = []string{VerdictVeryPoor, VerdictPoor, VerdictAcceptable, VerdictGood, VerdictExcellent}
+
+/*
+VerdictPriorities returns the priority of each verdict, used by the storage backends to sort by verdict
+Returns:
+
+	map[string]int: The priorities (the higher the better)
+	int: The priority of an unknown or empty verdict, lower than every known one
+*/
+func VerdictPriorities() (map[string]int, int) {
+	priorities := make(map[string]int, len(verdictOrder))
+	for i, verdict := range verdictOrder {
+		priorities[verdict] = i
+	}
+	return priorities, -1
+}
+
+/*
+messageCatalog holds the translated texts of the reports, indexed by language and message key.
+Finding texts use the "<CODE>.message" and "<CODE>.remediation" keys, verdicts use "verdict.<VERDICT>".
+*/
+var messageCatalog = map[string]map[string]string{
+	LanguageSpanish: {
+		"summary.intro":   " Análisis TLS para %s - Calificación general: %s",
+		"summary.verdict": " VEREDICTO FINAL: ",
+		"summary.empty":   "No se pudo obtener información válida del análisis TLS",
+
+		"verdict." + VerdictExcellent:  "Excelente",
+		"verdict." + VerdictGood:       "Buena",
+		"verdict." + VerdictAcceptable: "Aceptable (se recomienda mejorar)",
+		"verdict." + VerdictPoor:       "Deficiente (riesgo alto)",
+		"verdict." + VerdictVeryPoor:   "Muy mala (sitio inseguro)",
+
+		FindingGradeDragged + ".message":              "Endpoints que bajan la calificación: %s.",
+		FindingGradeDragged + ".remediation":          "Aplicar en todos los endpoints la misma configuración TLS que el endpoint mejor calificado.",
+		FindingTLS13Supported + ".message":            "Soporta TLS 1.3 (excelente nivel de seguridad actual).",
+		FindingNoTLS13 + ".message":                   "Soporta TLS 1.2, pero sin TLS 1.3 (aceptable, pero no óptimo en 2026).",
+		FindingNoTLS13 + ".remediation":               "Habilitar TLS 1.3 en el servidor.",
+		FindingObsoleteProtocols + ".message":         "Protocolos obsoletos o inseguros detectados.",
+		FindingObsoleteProtocols + ".remediation":     "Habilitar TLS 1.2 y TLS 1.3 y deshabilitar SSL, TLS 1.0 y TLS 1.1.",
+		FindingLegacyProtocols + ".message":           "Protocolos heredados habilitados (SSL, TLS 1.0 o TLS 1.1).",
+		FindingLegacyProtocols + ".remediation":       "Deshabilitar SSL, TLS 1.0 y TLS 1.1.",
+		FindingStrongCipher + ".message":              "Cifrado fuerte (hasta 256 bits).",
+		FindingAcceptableCipher + ".message":          "Cifrado aceptable (128 bits).",
+		FindingWeakCipherStrength + ".message":        "Cifrado débil detectado.",
+		FindingWeakCipherStrength + ".remediation":    "Configurar suites de cifrado AEAD de al menos 128 bits (AES-GCM o ChaCha20-Poly1305).",
+		FindingWeakCipherSuites + ".message":          "Atención: hay suites cifradas débiles habilitadas.",
+		FindingWeakCipherSuites + ".remediation":      "Eliminar de la configuración las suites de cifrado de menos de 112 bits (3DES, RC4, DES, EXPORT).",
+		FindingHSTSPresent + ".message":               "HSTS está activo (buena protección contra downgrade).",
+		FindingNoHSTS + ".message":                    "Sin HSTS → vulnerable a ataques de downgrade (HTTP plano posible).",
+		FindingNoHSTS + ".remediation":                "Enviar la cabecera Strict-Transport-Security con max-age de al menos 31536000 e includeSubDomains.",
+		FindingCertValid + ".message":                 "Certificado válido por más de 30 días.",
+		FindingCertExpiring + ".message":              "Certificado expira en %s días → renovar pronto.",
+		FindingCertExpiring + ".remediation":          "Renovar el certificado y automatizar la renovación (por ejemplo con ACME).",
+		FindingCertExpired + ".message":               "Certificado expirado o inválido → sitio inseguro.",
+		FindingCertExpired + ".remediation":           "Instalar de inmediato un certificado válido emitido por una CA de confianza.",
+		FindingWarnings + ".message":                  "Existen advertencias menores en la configuración.",
+		FindingWarnings + ".remediation":              "Revisar las advertencias del análisis de SSL Labs.",
+		FindingExceptional + ".message":               "Al menos un endpoint tiene configuración excepcional.",
+		FindingChainIssues + ".message":               "Problemas detectados en la cadena de certificados.",
+		FindingChainIssues + ".remediation":           "Servir la cadena completa de certificados intermedios, en orden y sin certificados sobrantes.",
+		FindingCAAIssuerNotPermitted + ".message":     "Atención: los registros CAA no autorizan al emisor del certificado (%s).",
+		FindingCAAIssuerNotPermitted + ".remediation": "Agregar un registro CAA issue para la CA emisora o cambiar a una CA autorizada.",
+		FindingCAAIssuerPermitted + ".message":        "Registros CAA presentes y el emisor del certificado está autorizado.",
+		FindingCAANotPresent + ".message":             "Sin registros CAA de emisión (cualquier CA puede emitir certificados).",
+		FindingCAANotPresent + ".remediation":         "Publicar registros CAA issue con las CA autorizadas para el dominio.",
+	},
+	LanguageEnglish: {
+		"summary.intro":   " TLS analysis for %s - Overall grade: %s",
+		"summary.verdict": " FINAL VERDICT: ",
+		"summary.empty":   "No valid information could be obtained from the TLS analysis",
+
+		"verdict." + VerdictExcellent:  "Excellent",
+		"verdict." + VerdictGood:       "Good",
+		"verdict." + VerdictAcceptable: "Acceptable (improvement recommended)",
+		"verdict." + VerdictPoor:       "Poor (high risk)",
+		"verdict." + VerdictVeryPoor:   "Very poor (insecure site)",
+
+		FindingGradeDragged + ".message":              "Endpoints dragging the grade down: %s.",
+		FindingGradeDragged + ".remediation":          "Apply the TLS configuration of the best graded endpoint to every endpoint.",
+		FindingTLS13Supported + ".message":            "Supports TLS 1.3 (excellent current security level).",
+		FindingNoTLS13 + ".message":                   "Supports TLS 1.2 but not TLS 1.3 (acceptable, but not optimal in 2026).",
+		FindingNoTLS13 + ".remediation":               "Enable TLS 1.3 on the server.",
+		FindingObsoleteProtocols + ".message":         "Obsolete or insecure protocols detected.",
+		FindingObsoleteProtocols + ".remediation":     "Enable TLS 1.2 and TLS 1.3 and disable SSL, TLS 1.0 and TLS 1.1.",
+		FindingLegacyProtocols + ".message":           "Legacy protocols enabled (SSL, TLS 1.0 or TLS 1.1).",
+		FindingLegacyProtocols + ".remediation":       "Disable SSL, TLS 1.0 and TLS 1.1.",
+		FindingStrongCipher + ".message":              "Strong encryption (up to 256 bits).",
+		FindingAcceptableCipher + ".message":          "Acceptable encryption (128 bits).",
+		FindingWeakCipherStrength + ".message":        "Weak encryption detected.",
+		FindingWeakCipherStrength + ".remediation":    "Configure AEAD cipher suites of at least 128 bits (AES-GCM or ChaCha20-Poly1305).",
+		FindingWeakCipherSuites + ".message":          "Warning: weak cipher suites are enabled.",
+		FindingWeakCipherSuites + ".remediation":      "Remove the cipher suites weaker than 112 bits (3DES, RC4, DES, EXPORT) from the configuration.",
+		FindingHSTSPresent + ".message":               "HSTS is enabled (good protection against downgrade attacks).",
+		FindingNoHSTS + ".message":                    "No HSTS → vulnerable to downgrade attacks (plain HTTP possible).",
+		FindingNoHSTS + ".remediation":                "Send the Strict-Transport-Security header with a max-age of at least 31536000 and includeSubDomains.",
+		FindingCertValid + ".message":                 "Certificate valid for more than 30 days.",
+		FindingCertExpiring + ".message":              "Certificate expires in %s days → renew soon.",
+		FindingCertExpiring + ".remediation":          "Renew the certificate and automate the renewal (e.g. with ACME).",
+		FindingCertExpired + ".message":               "Certificate expired or invalid → insecure site.",
+		FindingCertExpired + ".remediation":           "Install a valid certificate issued by a trusted CA immediately.",
+		FindingWarnings + ".message":                  "There are minor configuration warnings.",
+		FindingWarnings + ".remediation":              "Review the warnings of the SSL Labs assessment.",
+		FindingExceptional + ".message":               "At least one endpoint has an exceptional configuration.",
+		FindingChainIssues + ".message":               "Issues detected in the certificate chain.",
+		FindingChainIssues + ".remediation":           "Serve the complete chain of intermediate certificates, in order and without extra certificates.",
+		FindingCAAIssuerNotPermitted + ".message":     "Warning: the CAA records do not authorize the certificate issuer (%s).",
+		FindingCAAIssuerNotPermitted + ".remediation": "Add a CAA issue record for the issuing CA or switch to an authorized CA.",
+		FindingCAAIssuerPermitted + ".message":        "CAA records present and the certificate issuer is authorized.",
+		FindingCAANotPresent + ".message":             "No CAA issue records (any CA can issue certificates).",
+		FindingCAANotPresent + ".remediation":         "Publish CAA issue records listing the CAs authorized for the domain.",
+	},
+}
+
+/*
+IsSupportedLanguage checks if the message catalog has texts for the given language.
+
+Args:
+
+	lang string: The language code (e.g. "en", "es")
+
+Returns:
+
+	bool: true if the language is supported, false otherwise
+*/
+func IsSupportedLanguage(lang string) bool {
+	_, ok := messageCatalog[lang]
+	return ok
+}
+
+/*
+Translate returns the text of a message key in the given language, formatted with the given arguments.
+Unsupported languages fall back to DefaultLanguage, and unknown keys return an empty string.
+
+Args:
+
+	lang string: The language code (e.g. "en", "es")
+	key string: The message key (e.g. "summary.intro", "TLS_NO_HSTS.message")
+	args ...any: The arguments of the message placeholders
+
+Returns:
+
+	string: The translated text
+*/
+func Translate(lang string, key string, args ...any) string {
+	messages, ok := messageCatalog[lang]
+	if !ok {
+		messages = messageCatalog[DefaultLanguage]
+	}
+	text, ok := messages[key]
+	if !ok {
+		text = messageCatalog[DefaultLanguage][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+/*
+localizeFindings fills the Message and Remediation texts of the findings in the given language.
+
+Args:
+
+	findings []Finding: The findings to localize (modified in place)
+	lang string: The language code
+*/
+func localizeFindings(findings []Finding, lang string) {
+	for i := range findings {
+		args := make([]any, len(findings[i].Args))
+		for j, arg := range findings[i].Args {
+			args[j] = arg
+		}
+		findings[i].Message = Translate(lang, findings[i].Code+".message", args...)
+		findings[i].Remediation = Translate(lang, findings[i].Code+".remediation")
+	}
+}
+
+/*
+LocalizeReport returns a copy of the report with the summary, findings and verdict texts in the given language.
+Only the texts are translated: the grade, verdict, scores and findings are the stored ones, so a stored report can be
+served in several languages without changing what it says.
+
+Args:
+
+	report *FilteredTLSReport: The report to localize
+	lang string: The language code, unsupported values fall back to DefaultLanguage
+
+Returns:
+
+	*FilteredTLSReport: The localized copy (nil if report is nil)
+*/
+func LocalizeReport(report *FilteredTLSReport, lang string) *FilteredTLSReport {
+	if report == nil {
+		return nil
+	}
+	if !IsSupportedLanguage(lang) {
+		lang = DefaultLanguage
+	}
+
+	localized := *report
+	localized.Language = lang
+	localized.VerdictText = translateVerdict(lang, report.Verdict, report.VerdictText)
+	localized.Endpoints = append([]FilteredEndpoint(nil), report.Endpoints...)
+	for i := range localized.Endpoints {
+		localized.Endpoints[i].VerdictText = translateVerdict(lang, localized.Endpoints[i].Verdict, localized.Endpoints[i].VerdictText)
+	}
+
+	// The findings of other sources (e.g. /create-domain-info) may have codes without texts, they keep theirs
+	localized.Findings = append([]Finding(nil), report.Findings...)
+	for i, finding := range localized.Findings {
+		if Translate(lang, finding.Code+".message") == "" {
+			continue
+		}
+		localizeFindings(localized.Findings[i:i+1], lang)
+	}
+	localized.Summary = buildReportSummary(&localized)
+
+	return &localized
+}
+
+/*
+translateVerdict returns the text of a verdict in the given language
+Args:
+
+	lang string: The language code
+	verdict string: The language-neutral verdict
+	fallback string: The text used when the verdict is unknown
+
+Returns:
+
+	string: The translated text
+*/
+func translateVerdict(lang string, verdict string, fallback string) string {
+	if text := Translate(lang, "verdict."+verdict); text != "" {
+		return text
+	}
+	return fallback
+}
+
+/*
+ParseAcceptLanguage picks the first supported language of an Accept-Language header, honoring the q weights.
+
+Args:
+
+	header string: The Accept-Language header value (e.g. "en-US,en;q=0.9,es;q=0.8")
+
+Returns:
+
+	string: The supported language code, empty if none of the languages is supported
+*/
+func ParseAcceptLanguage(header string) string {
+	bestLang := ""
+	bestWeight := 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.SplitN(strings.TrimSpace(fields[0]), "-", 2)[0])
+		weight := 1.0
+		for _, param := range fields[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if _, err := fmt.Sscanf(q, "%g", &weight); err != nil {
+					weight = 0
+				}
+			}
+		}
+		if IsSupportedLanguage(lang) && weight > bestWeight {
+			bestLang, bestWeight = lang, weight
+		}
+	}
+
+	return bestLang
+}
@@ -0,0 +1,371 @@
+package scripts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Names of the rules a policy can define, used in the evaluation results
+const (
+	RuleMinGrade           = "minGrade"
+	RuleRequiredProtocols  = "requiredProtocols"
+	RuleForbiddenProtocols = "forbiddenProtocols"
+	RuleForbiddenCiphers   = "forbiddenCiphers"
+	RuleMinKeySize         = "minKeySize"
+	RuleMinECKeySize       = "minEcKeySize"
+	RuleMinCipherStrength  = "minCipherStrength"
+	RuleHSTSRequired       = "hstsRequired"
+	RuleMinHSTSMaxAge      = "minHstsMaxAge"
+	RuleMinExpiryDays      = "minExpiryDays"
+)
+
+/*
+Struct created to hold a declarative verdict policy, it can be written in YAML or JSON
+*/
+type Policy struct {
+	Name        string      `json:"name" bson:"name"`
+	Description string      `json:"description" bson:"description"`
+	Rules       PolicyRules `json:"rules" bson:"rules"`
+}
+
+/*
+Struct created to hold the rules of a policy (that is in the Policy struct), a zero value disables the rule
+*/
+type PolicyRules struct {
+	MinGrade           string   `json:"minGrade,omitempty" bson:"minGrade,omitempty"`                     // Lowest domain grade accepted (e.g. "A-")
+	RequiredProtocols  []string `json:"requiredProtocols,omitempty" bson:"requiredProtocols,omitempty"`   // Protocols every endpoint must support (e.g. "TLS 1.3")
+	ForbiddenProtocols []string `json:"forbiddenProtocols,omitempty" bson:"forbiddenProtocols,omitempty"` // Protocols no endpoint may support (e.g. "TLS 1.0")
+	ForbiddenCiphers   []string `json:"forbiddenCiphers,omitempty" bson:"forbiddenCiphers,omitempty"`     // Fragments of cipher suite names that are not allowed (e.g. "RC4", "CBC")
+	MinKeySize         int64    `json:"minKeySize,omitempty" bson:"minKeySize,omitempty"`                 // Minimum RSA/DSA key size in bits
+	MinECKeySize       int64    `json:"minEcKeySize,omitempty" bson:"minEcKeySize,omitempty"`             // Minimum EC key size in bits
+	MinCipherStrength  float64  `json:"minCipherStrength,omitempty" bson:"minCipherStrength,omitempty"`   // Minimum strength of every supported suite (weak threshold)
+	HSTSRequired       bool     `json:"hstsRequired,omitempty" bson:"hstsRequired,omitempty"`
+	MinHSTSMaxAge      int64    `json:"minHstsMaxAge,omitempty" bson:"minHstsMaxAge,omitempty"`
+	MinExpiryDays      float64  `json:"minExpiryDays,omitempty" bson:"minExpiryDays,omitempty"` // Expiry window, certificates closer to expire fail
+}
+
+/*
+Struct created to hold the result of a single rule of a policy evaluation
+*/
+type RuleResult struct {
+	Rule              string   `json:"rule"`
+	Passed            bool     `json:"passed"`
+	Expected          string   `json:"expected"`
+	Actual            string   `json:"actual"`
+	AffectedEndpoints []string `json:"affectedEndpoints"` // Endpoints that break the rule
+}
+
+/*
+Struct created to hold the result of evaluating a report against a policy
+*/
+type PolicyEvaluation struct {
+	Policy  string       `json:"policy"`
+	Host    string       `json:"host"`
+	Passed  bool         `json:"passed"` // True only if every rule passed
+	Results []RuleResult `json:"results"`
+}
+
+/*
+ParsePolicy decodes a policy written in YAML or JSON and validates it
+Args:
+
+	data []byte: The policy document
+	format string: "yaml" or "json"
+
+Returns:
+
+	*Policy: Pointer of the decoded Policy
+	error: Any error encountered during the process
+*/
+func ParsePolicy(data []byte, format string) (*Policy, error) {
+	var policy Policy
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.UnmarshalWithOptions(data, &policy, yaml.DisallowUnknownField())
+	case "json":
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&policy)
+	default:
+		return nil, fmt.Errorf("unsupported policy format %q, allowed values: yaml, json", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding policy: %v", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+/*
+Validate checks that the policy has a name and that its rules have valid values
+Returns:
+
+	error: The first invalid value found, nil if the policy is valid
+*/
+func (p *Policy) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("policy name is required")
+	}
+	if p.Rules.MinGrade != "" && getGradePriority(p.Rules.MinGrade) == getGradePriority("unknown") {
+		return fmt.Errorf("invalid minGrade %q", p.Rules.MinGrade)
+	}
+	if p.Rules.MinKeySize < 0 || p.Rules.MinECKeySize < 0 || p.Rules.MinCipherStrength < 0 || p.Rules.MinHSTSMaxAge < 0 || p.Rules.MinExpiryDays < 0 {
+		return fmt.Errorf("minimum values of the rules cannot be negative")
+	}
+	return nil
+}
+
+/*
+Evaluate checks a filtered report against every rule defined in the policy, a report without endpoints fails them all
+Args:
+
+	report *FilteredTLSReport: The report to evaluate
+
+Returns:
+
+	*PolicyEvaluation: The pass/fail result of every defined rule
+*/
+func (p *Policy) Evaluate(report *FilteredTLSReport) *PolicyEvaluation {
+	evaluation := &PolicyEvaluation{Policy: p.Name, Host: report.Host, Passed: true}
+	rules := p.Rules
+	endpoints := report.Endpoints
+
+	// Every rule is about the endpoints, a report without them (a failed or empty scan) can not pass any
+	add := func(result RuleResult) {
+		result.Passed = len(endpoints) > 0 && len(result.AffectedEndpoints) == 0 && result.Passed
+		if !result.Passed {
+			evaluation.Passed = false
+		}
+		evaluation.Results = append(evaluation.Results, result)
+	}
+
+	if rules.MinGrade != "" {
+		grade := report.Grade
+		if grade == "" {
+			grade = aggregateGrade(endpoints, report.Aggregation)
+		}
+		add(RuleResult{
+			Rule:     RuleMinGrade,
+			Passed:   getGradePriority(grade) >= getGradePriority(rules.MinGrade),
+			Expected: ">= " + rules.MinGrade,
+			Actual:   grade,
+		})
+	}
+
+	if len(rules.RequiredProtocols) > 0 {
+		add(RuleResult{
+			Rule:     RuleRequiredProtocols,
+			Passed:   true,
+			Expected: strings.Join(rules.RequiredProtocols, ", "),
+			Actual:   describeProtocols(endpoints),
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+				for _, protocol := range rules.RequiredProtocols {
+					if !contains(ep.Protocols, protocol) {
+						return true
+					}
+				}
+				return false
+			}),
+		})
+	}
+
+	if len(rules.ForbiddenProtocols) > 0 {
+		add(RuleResult{
+			Rule:              RuleForbiddenProtocols,
+			Passed:            true,
+			Expected:          "none of " + strings.Join(rules.ForbiddenProtocols, ", "),
+			Actual:            describeProtocols(endpoints),
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return containsAny(ep.Protocols, rules.ForbiddenProtocols...) }),
+		})
+	}
+
+	if len(rules.ForbiddenCiphers) > 0 {
+		var found []string
+		affected := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+			matched := false
+			for _, suite := range ep.CipherSuites {
+				for _, forbidden := range rules.ForbiddenCiphers {
+					if strings.Contains(strings.ToUpper(suite), strings.ToUpper(forbidden)) {
+						matched = true
+						if !contains(found, suite) {
+							found = append(found, suite)
+						}
+					}
+				}
+			}
+			return matched
+		})
+		add(RuleResult{
+			Rule:              RuleForbiddenCiphers,
+			Passed:            true,
+			Expected:          "no suites matching " + strings.Join(rules.ForbiddenCiphers, ", "),
+			Actual:            strings.Join(found, ", "),
+			AffectedEndpoints: affected,
+		})
+	}
+
+	if rules.MinKeySize > 0 {
+		add(keySizeResult(RuleMinKeySize, endpoints, rules.MinKeySize, func(alg string) bool { return alg != "EC" }))
+	}
+	if rules.MinECKeySize > 0 {
+		add(keySizeResult(RuleMinECKeySize, endpoints, rules.MinECKeySize, func(alg string) bool { return alg == "EC" }))
+	}
+
+	if rules.MinCipherStrength > 0 {
+		add(RuleResult{
+			Rule:              RuleMinCipherStrength,
+			Passed:            true,
+			Expected:          fmt.Sprintf(">= %.0f bits", rules.MinCipherStrength),
+			Actual:            fmt.Sprintf("%.0f bits", minNegotiableStrength(endpoints)),
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return ep.MinCipherStrength < rules.MinCipherStrength }),
+		})
+	}
+
+	if rules.HSTSRequired {
+		add(RuleResult{
+			Rule:              RuleHSTSRequired,
+			Passed:            true,
+			Expected:          "present",
+			Actual:            describeHSTS(endpoints),
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool { return !isHSTSPresent(ep.HSTS) }),
+		})
+	}
+	if rules.MinHSTSMaxAge > 0 {
+		add(RuleResult{
+			Rule:     RuleMinHSTSMaxAge,
+			Passed:   true,
+			Expected: fmt.Sprintf(">= %d", rules.MinHSTSMaxAge),
+			Actual:   describeHSTS(endpoints),
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+				return !isHSTSPresent(ep.HSTS) || ep.HSTS.MaxAge < rules.MinHSTSMaxAge
+			}),
+		})
+	}
+
+	if rules.MinExpiryDays > 0 {
+		actual := "no certificate"
+		minDays, found := 0.0, false
+		for _, ep := range endpoints {
+			if ep.Certificate != nil && (!found || ep.Certificate.ExpiresInDays < minDays) {
+				minDays, found = ep.Certificate.ExpiresInDays, true
+			}
+		}
+		if found {
+			actual = fmt.Sprintf("%.1f days", minDays)
+		}
+		add(RuleResult{
+			Rule:     RuleMinExpiryDays,
+			Passed:   true,
+			Expected: fmt.Sprintf(">= %.0f days", rules.MinExpiryDays),
+			Actual:   actual,
+			AffectedEndpoints: affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+				return ep.Certificate == nil || ep.Certificate.ExpiresInDays < rules.MinExpiryDays
+			}),
+		})
+	}
+
+	return evaluation
+}
+
+/*
+keySizeResult evaluates a minimum key size rule over the endpoints whose key algorithm matches.
+Args:
+
+	rule string: The name of the rule
+	endpoints []FilteredEndpoint: The endpoints of the report
+	minSize int64: The minimum key size in bits
+	appliesTo func(string) bool: Tells if the rule applies to a key algorithm
+
+Returns:
+
+	RuleResult: The result of the rule
+*/
+func keySizeResult(rule string, endpoints []FilteredEndpoint, minSize int64, appliesTo func(string) bool) RuleResult {
+	var sizes []string
+	affected := affectedEndpoints(endpoints, func(ep FilteredEndpoint) bool {
+		if ep.Certificate == nil || !appliesTo(ep.Certificate.KeyAlgorithm) {
+			return false
+		}
+		sizes = append(sizes, fmt.Sprintf("%s %d", ep.Certificate.KeyAlgorithm, ep.Certificate.KeySize))
+		return ep.Certificate.KeySize < minSize
+	})
+
+	return RuleResult{
+		Rule:              rule,
+		Passed:            true,
+		Expected:          fmt.Sprintf(">= %d bits", minSize),
+		Actual:            strings.Join(sizes, ", "),
+		AffectedEndpoints: affected,
+	}
+}
+
+/*
+minNegotiableStrength returns the lowest cipher strength supported across the endpoints.
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+
+Returns:
+
+	float64: The lowest strength in bits (0 if there are no endpoints)
+*/
+func minNegotiableStrength(endpoints []FilteredEndpoint) float64 {
+	minStrength := 0.0
+	for i, ep := range endpoints {
+		if i == 0 || ep.MinCipherStrength < minStrength {
+			minStrength = ep.MinCipherStrength
+		}
+	}
+	return minStrength
+}
+
+/*
+describeProtocols lists the distinct protocols supported across the endpoints.
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+
+Returns:
+
+	string: The protocols separated by commas
+*/
+func describeProtocols(endpoints []FilteredEndpoint) string {
+	var protocols []string
+	for _, ep := range endpoints {
+		for _, protocol := range ep.Protocols {
+			if !contains(protocols, protocol) {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return strings.Join(protocols, ", ")
+}
+
+/*
+describeHSTS lists the HSTS status and max-age of every endpoint.
+Args:
+
+	endpoints []FilteredEndpoint: The endpoints of the report
+
+Returns:
+
+	string: The "ip: status (max-age)" descriptions separated by commas
+*/
+func describeHSTS(endpoints []FilteredEndpoint) string {
+	var descriptions []string
+	for _, ep := range endpoints {
+		if ep.HSTS == nil {
+			descriptions = append(descriptions, ep.IPAddress+": unknown")
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s (max-age %d)", ep.IPAddress, ep.HSTS.Status, ep.HSTS.MaxAge))
+	}
+	return strings.Join(descriptions, ", ")
+}
@@ -0,0 +1,252 @@
+package scripts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+policyEndpoint returns an endpoint that passes the rules of the policy tests
+*/
+func policyEndpoint(ip string) FilteredEndpoint {
+	return FilteredEndpoint{
+		IPAddress:         ip,
+		Grade:             "A",
+		Protocols:         []string{"TLS 1.2", "TLS 1.3"},
+		CipherSuites:      []string{"TLS_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+		MinCipherStrength: 128,
+		HSTS:              &FilteredHSTS{Status: "present", MaxAge: 31536000},
+		Certificate:       &FilteredCertificate{KeyAlgorithm: "RSA", KeySize: 2048, ExpiresInDays: 60},
+	}
+}
+
+/*
+policyReport returns a report of grade A with the given endpoints
+*/
+func policyReport(endpoints ...FilteredEndpoint) *FilteredTLSReport {
+	return &FilteredTLSReport{Host: "example.com", Grade: "A", Aggregation: DefaultAggregation, Endpoints: endpoints}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		wantErr string
+	}{
+		{name: "yaml", format: "yaml", data: "name: strict\nrules:\n  minGrade: A-\n  forbiddenProtocols: [TLS 1.0]\n  minExpiryDays: 30\n"},
+		{name: "json", format: "json", data: `{"name": "strict", "rules": {"hstsRequired": true, "minKeySize": 2048}}`},
+		{name: "unsupported format", format: "toml", data: `name = "strict"`, wantErr: "unsupported policy format"},
+		{name: "unknown yaml rule", format: "yaml", data: "name: strict\nrules:\n  minGrad: A\n", wantErr: "Error decoding policy"},
+		{name: "unknown json rule", format: "json", data: `{"name": "strict", "rules": {"minGrad": "A"}}`, wantErr: "Error decoding policy"},
+		{name: "invalid json", format: "json", data: `{"name": `, wantErr: "Error decoding policy"},
+		{name: "without name", format: "json", data: `{"name": " ", "rules": {}}`, wantErr: "policy name is required"},
+		{name: "invalid grade", format: "json", data: `{"name": "strict", "rules": {"minGrade": "Z"}}`, wantErr: `invalid minGrade "Z"`},
+		{name: "negative key size", format: "json", data: `{"name": "strict", "rules": {"minKeySize": -1}}`, wantErr: "cannot be negative"},
+		{name: "negative EC key size", format: "json", data: `{"name": "strict", "rules": {"minEcKeySize": -1}}`, wantErr: "cannot be negative"},
+		{name: "negative cipher strength", format: "json", data: `{"name": "strict", "rules": {"minCipherStrength": -1}}`, wantErr: "cannot be negative"},
+		{name: "negative HSTS max-age", format: "json", data: `{"name": "strict", "rules": {"minHstsMaxAge": -1}}`, wantErr: "cannot be negative"},
+		{name: "negative expiry days", format: "json", data: `{"name": "strict", "rules": {"minExpiryDays": -1}}`, wantErr: "cannot be negative"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := ParsePolicy([]byte(test.data), test.format)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("ParsePolicy error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePolicy: %v", err)
+			}
+			if policy.Name != "strict" {
+				t.Errorf("name = %q, want strict", policy.Name)
+			}
+		})
+	}
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	withEndpoint := func(change func(ep *FilteredEndpoint)) *FilteredTLSReport {
+		ep := policyEndpoint("192.0.2.2")
+		change(&ep)
+		return policyReport(policyEndpoint("192.0.2.1"), ep)
+	}
+	ecKey := func(size int64) func(ep *FilteredEndpoint) {
+		return func(ep *FilteredEndpoint) {
+			ep.Certificate = &FilteredCertificate{KeyAlgorithm: "EC", KeySize: size, ExpiresInDays: 60}
+		}
+	}
+	noCertificate := withEndpoint(func(ep *FilteredEndpoint) { ep.Certificate = nil })
+	certificateFirst := policyReport(FilteredEndpoint{IPAddress: "192.0.2.1", Protocols: []string{"TLS 1.3"}}, policyEndpoint("192.0.2.2"))
+	certificateFirst.Endpoints[1].Certificate.ExpiresInDays = 10
+
+	tests := []struct {
+		name     string
+		rules    PolicyRules
+		report   *FilteredTLSReport
+		passed   bool
+		actual   string // Not checked when empty
+		affected []string
+	}{
+		{name: "minGrade passes", rules: PolicyRules{MinGrade: "A-"}, report: policyReport(policyEndpoint("192.0.2.1")), passed: true, actual: "A"},
+		{name: "minGrade fails", rules: PolicyRules{MinGrade: "A+"}, report: policyReport(policyEndpoint("192.0.2.1")), actual: "A"},
+		{
+			name:  "minGrade aggregates the endpoints without grade",
+			rules: PolicyRules{MinGrade: "B"},
+			report: func() *FilteredTLSReport {
+				report := withEndpoint(func(ep *FilteredEndpoint) { ep.Grade = "C" })
+				report.Grade = ""
+				return report
+			}(),
+			actual: "C",
+		},
+
+		{name: "requiredProtocols passes", rules: PolicyRules{RequiredProtocols: []string{"TLS 1.3"}}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true, actual: "TLS 1.2, TLS 1.3"},
+		{
+			name:     "requiredProtocols fails",
+			rules:    PolicyRules{RequiredProtocols: []string{"TLS 1.3"}},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.Protocols = []string{"TLS 1.2"} }),
+			affected: []string{"192.0.2.2"},
+		},
+
+		{name: "forbiddenProtocols passes", rules: PolicyRules{ForbiddenProtocols: []string{"TLS 1.0", "TLS 1.1"}}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true},
+		{
+			name:     "forbiddenProtocols fails",
+			rules:    PolicyRules{ForbiddenProtocols: []string{"TLS 1.0", "TLS 1.1"}},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.Protocols = append(ep.Protocols, "TLS 1.0") }),
+			actual:   "TLS 1.2, TLS 1.3, TLS 1.0",
+			affected: []string{"192.0.2.2"},
+		},
+
+		{name: "forbiddenCiphers passes", rules: PolicyRules{ForbiddenCiphers: []string{"RC4", "CBC"}}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true, actual: ""},
+		{
+			name:     "forbiddenCiphers fails without case sensitivity",
+			rules:    PolicyRules{ForbiddenCiphers: []string{"cbc"}},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.CipherSuites = append(ep.CipherSuites, "TLS_RSA_WITH_AES_128_CBC_SHA") }),
+			actual:   "TLS_RSA_WITH_AES_128_CBC_SHA",
+			affected: []string{"192.0.2.2"},
+		},
+
+		{name: "minKeySize passes", rules: PolicyRules{MinKeySize: 2048}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true, actual: "RSA 2048, RSA 2048"},
+		{
+			name:     "minKeySize fails",
+			rules:    PolicyRules{MinKeySize: 2048},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.Certificate.KeySize = 1024 }),
+			actual:   "RSA 2048, RSA 1024",
+			affected: []string{"192.0.2.2"},
+		},
+		{name: "minKeySize ignores EC keys", rules: PolicyRules{MinKeySize: 2048}, report: withEndpoint(ecKey(256)), passed: true, actual: "RSA 2048"},
+
+		{name: "minEcKeySize passes", rules: PolicyRules{MinECKeySize: 256}, report: withEndpoint(ecKey(384)), passed: true, actual: "EC 384"},
+		{name: "minEcKeySize fails", rules: PolicyRules{MinECKeySize: 384}, report: withEndpoint(ecKey(256)), actual: "EC 256", affected: []string{"192.0.2.2"}},
+
+		{name: "minCipherStrength passes", rules: PolicyRules{MinCipherStrength: 128}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true, actual: "128 bits"},
+		{
+			name:     "minCipherStrength fails",
+			rules:    PolicyRules{MinCipherStrength: 128},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.MinCipherStrength = 112 }),
+			actual:   "112 bits",
+			affected: []string{"192.0.2.2"},
+		},
+
+		{name: "hstsRequired passes", rules: PolicyRules{HSTSRequired: true}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true},
+		{
+			name:     "hstsRequired fails",
+			rules:    PolicyRules{HSTSRequired: true},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.HSTS = &FilteredHSTS{Status: "absent"} }),
+			actual:   "192.0.2.1: present (max-age 31536000), 192.0.2.2: absent (max-age 0)",
+			affected: []string{"192.0.2.2"},
+		},
+		{
+			name:     "hstsRequired fails without HSTS information",
+			rules:    PolicyRules{HSTSRequired: true},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.HSTS = nil }),
+			actual:   "192.0.2.1: present (max-age 31536000), 192.0.2.2: unknown",
+			affected: []string{"192.0.2.2"},
+		},
+
+		{name: "minHstsMaxAge passes", rules: PolicyRules{MinHSTSMaxAge: 15768000}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true},
+		{
+			name:     "minHstsMaxAge fails",
+			rules:    PolicyRules{MinHSTSMaxAge: 15768000},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.HSTS.MaxAge = 300 }),
+			affected: []string{"192.0.2.2"},
+		},
+
+		{name: "minExpiryDays passes", rules: PolicyRules{MinExpiryDays: 30}, report: withEndpoint(func(*FilteredEndpoint) {}), passed: true, actual: "60.0 days"},
+		{
+			name:     "minExpiryDays fails",
+			rules:    PolicyRules{MinExpiryDays: 30},
+			report:   withEndpoint(func(ep *FilteredEndpoint) { ep.Certificate.ExpiresInDays = 12.5 }),
+			actual:   "12.5 days",
+			affected: []string{"192.0.2.2"},
+		},
+		{
+			name:     "minExpiryDays after an endpoint without certificate",
+			rules:    PolicyRules{MinExpiryDays: 30},
+			report:   certificateFirst,
+			actual:   "10.0 days",
+			affected: []string{"192.0.2.1", "192.0.2.2"},
+		},
+
+		// An endpoint without certificate has no key to check, but it can not meet the expiry window
+		{name: "minKeySize with an endpoint without certificate", rules: PolicyRules{MinKeySize: 2048}, report: noCertificate, passed: true, actual: "RSA 2048"},
+		{name: "minExpiryDays with an endpoint without certificate", rules: PolicyRules{MinExpiryDays: 30}, report: noCertificate, actual: "60.0 days", affected: []string{"192.0.2.2"}},
+		{
+			name:     "minExpiryDays without any certificate",
+			rules:    PolicyRules{MinExpiryDays: 30},
+			report:   policyReport(FilteredEndpoint{IPAddress: "192.0.2.1"}),
+			actual:   "no certificate",
+			affected: []string{"192.0.2.1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := Policy{Name: "test", Rules: test.rules}
+			evaluation := policy.Evaluate(test.report)
+			if len(evaluation.Results) != 1 {
+				t.Fatalf("got %d results, want 1: %+v", len(evaluation.Results), evaluation.Results)
+			}
+			result := evaluation.Results[0]
+			if result.Passed != test.passed || evaluation.Passed != test.passed {
+				t.Errorf("passed = %t (evaluation %t), want %t: %+v", result.Passed, evaluation.Passed, test.passed, result)
+			}
+			if test.actual != "" && result.Actual != test.actual {
+				t.Errorf("actual = %q, want %q", result.Actual, test.actual)
+			}
+			if !reflect.DeepEqual(result.AffectedEndpoints, test.affected) {
+				t.Errorf("affected endpoints = %v, want %v", result.AffectedEndpoints, test.affected)
+			}
+		})
+	}
+}
+
+func TestEvaluatePolicyWithoutEndpoints(t *testing.T) {
+	policy := Policy{Name: "all", Rules: PolicyRules{
+		MinGrade:           "T",
+		RequiredProtocols:  []string{"TLS 1.3"},
+		ForbiddenProtocols: []string{"TLS 1.0"},
+		ForbiddenCiphers:   []string{"RC4"},
+		MinKeySize:         2048,
+		MinECKeySize:       256,
+		MinCipherStrength:  128,
+		HSTSRequired:       true,
+		MinHSTSMaxAge:      1,
+		MinExpiryDays:      1,
+	}}
+	evaluation := policy.Evaluate(&FilteredTLSReport{Host: "example.com", Grade: "A"})
+	if evaluation.Passed || evaluation.Host != "example.com" || evaluation.Policy != "all" {
+		t.Errorf("evaluation = %+v, want a failed evaluation of example.com", evaluation)
+	}
+	if len(evaluation.Results) != 10 {
+		t.Fatalf("got %d results, want one per rule", len(evaluation.Results))
+	}
+	for _, result := range evaluation.Results {
+		if result.Passed {
+			t.Errorf("rule %s passed without endpoints", result.Rule)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package scripts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Grades SSL Labs can give besides the ones of getGradePriority: T (certificate not trusted) and M (certificate name mismatch)
+var extraGrades = []string{"T", "M"}
+
+// Protocol names produced by extractProtocols
+var knownProtocols = []string{"SSL 2.0", "SSL 3.0", "TLS 1.0", "TLS 1.1", "TLS 1.2", "TLS 1.3"}
+
+// Maximum clock skew accepted for a report timestamp in the future
+const maxTimestampSkew = 5 * time.Minute
+
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?(\.[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?)*\.?$`)
+
+/*
+Struct created to hold a validation error of a single field, the field is written as a JSON path (e.g. "endpoints[0].grade")
+*/
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+/*
+ValidationError holds every field error found in a domain report
+*/
+type ValidationError []FieldError
+
+/*
+Error joins the field errors in a single message
+Returns:
+
+	string: The field errors separated by semicolons
+*/
+func (v ValidationError) Error() string {
+	messages := make([]string, len(v))
+	for i, fieldError := range v {
+		messages[i] = fieldError.Field + ": " + fieldError.Message
+	}
+	return "invalid domain report: " + strings.Join(messages, "; ")
+}
+
+/*
+DecodeReport decodes a domain report written in JSON, rejecting the fields that are not part of FilteredTLSReport,
+and validates it
+Args:
+
+	data []byte: The JSON document
+
+Returns:
+
+	*FilteredTLSReport: Pointer of the decoded report
+	error: A ValidationError with the invalid fields, or the decoding error if the document is not valid JSON
+*/
+func DecodeReport(data []byte) (*FilteredTLSReport, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var report FilteredTLSReport
+	if err := decoder.Decode(&report); err != nil {
+		if fieldError, ok := decodeFieldError(err); ok {
+			return nil, ValidationError{fieldError}
+		}
+		return nil, fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("Error decoding JSON: the body must contain a single report")
+	}
+
+	if err := ValidateReport(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+/*
+decodeFieldError converts the JSON decoding errors that point to a field into a FieldError
+Args:
+
+	err error: The decoding error
+
+Returns:
+
+	FieldError: The field error
+	bool: False if the error does not point to a field (e.g. malformed JSON)
+*/
+func decodeFieldError(err error) (FieldError, bool) {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return FieldError{Field: typeError.Field, Message: fmt.Sprintf("must be of type %s, got %s", typeError.Type, typeError.Value)}, true
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{Field: strings.Trim(field, `"`), Message: "unknown field"}, true
+	}
+	var timeError *time.ParseError
+	if errors.As(err, &timeError) {
+		return FieldError{Field: "timestamp", Message: "must be an RFC 3339 date (e.g. 2026-01-19T11:20:00Z)"}, true
+	}
+	return FieldError{}, false
+}
+
+/*
+ValidateReport checks the values of a domain report: required host and timestamp, valid grades, verdicts,
+protocols, IP addresses and score ranges
+Args:
+
+	report *FilteredTLSReport: The report to validate
+
+Returns:
+
+	error: A ValidationError with every invalid field, nil if the report is valid
+*/
+func ValidateReport(report *FilteredTLSReport) error {
+	var errs ValidationError
+	add := func(field string, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case strings.TrimSpace(report.Host) == "":
+		add("host", "is required")
+	case !hostnamePattern.MatchString(report.Host) || len(report.Host) > 253:
+		add("host", "%q is not a valid hostname", report.Host)
+	}
+	if report.WebProtocol != "" && report.WebProtocol != "http" && report.WebProtocol != "https" {
+		add("webProtocol", "must be http or https")
+	}
+	if !isValidGrade(report.Grade) {
+		add("grade", "%q is not a valid grade", report.Grade)
+	}
+	if report.Score < 0 || report.Score > 100 {
+		add("score", "must be between 0 and 100")
+	}
+	if !isValidVerdict(report.Verdict) {
+		add("verdict", "%q is not a valid verdict", report.Verdict)
+	}
+	if report.Aggregation != "" && !IsValidAggregation(report.Aggregation) {
+		add("aggregation", "must be worst, best or majority")
+	}
+	if report.Language != "" && !IsSupportedLanguage(report.Language) {
+		add("language", "must be es or en")
+	}
+	switch {
+	case report.Timestamp.IsZero():
+		add("timestamp", "is required")
+	case report.Timestamp.After(time.Now().Add(maxTimestampSkew)):
+		add("timestamp", "cannot be in the future")
+	}
+	if scan := report.Scan; scan != nil {
+		if scan.StartTime != nil && scan.TestTime != nil && scan.StartTime.After(*scan.TestTime) {
+			add("scan.startTime", "cannot be after testTime")
+		}
+		if scan.DurationSeconds < 0 {
+			add("scan.durationSeconds", "cannot be negative")
+		}
+	}
+
+	for i, endpoint := range report.Endpoints {
+		field := fmt.Sprintf("endpoints[%d]", i)
+		if net.ParseIP(endpoint.IPAddress) == nil {
+			add(field+".ipAddress", "%q is not a valid IP address", endpoint.IPAddress)
+		}
+		if !isValidGrade(endpoint.Grade) {
+			add(field+".grade", "%q is not a valid grade", endpoint.Grade)
+		}
+		if !isValidVerdict(endpoint.Verdict) {
+			add(field+".verdict", "%q is not a valid verdict", endpoint.Verdict)
+		}
+		if endpoint.Score < 0 || endpoint.Score > 100 {
+			add(field+".score", "must be between 0 and 100")
+		}
+		for j, protocol := range endpoint.Protocols {
+			if !contains(knownProtocols, protocol) {
+				add(fmt.Sprintf("%s.protocols[%d]", field, j), "%q is not a known protocol", protocol)
+			}
+		}
+		if endpoint.MinCipherStrength < 0 || endpoint.MaxCipherStrength < endpoint.MinCipherStrength {
+			add(field+".minCipherStrength", "must be between 0 and maxCipherStrength")
+		}
+		if certificate := endpoint.Certificate; certificate != nil {
+			if certificate.KeySize < 0 {
+				add(field+".certificate.keySize", "cannot be negative")
+			}
+			if certificate.ValidityYears < 0 {
+				add(field+".certificate.validityYears", "cannot be negative")
+			}
+		}
+		if endpoint.HSTS != nil && endpoint.HSTS.MaxAge < 0 {
+			add(field+".hsts.maxAge", "cannot be negative")
+		}
+	}
+
+	for i, finding := range report.Findings {
+		field := fmt.Sprintf("findings[%d]", i)
+		if finding.Code == "" {
+			add(field+".code", "is required")
+		}
+		if !contains([]string{SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}, finding.Severity) {
+			add(field+".severity", "%q is not a valid severity", finding.Severity)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+/*
+isValidGrade checks that a grade is one SSL Labs can give, the empty grade is accepted (endpoints that could not be graded)
+Args:
+
+	grade string: The grade
+
+Returns:
+
+	bool: True if the grade is valid
+*/
+func isValidGrade(grade string) bool {
+	return grade == "" || getGradePriority(grade) != getGradePriority("unknown") || contains(extraGrades, grade)
+}
+
+/*
+isValidVerdict checks that a verdict is one of the language-neutral verdict values, the empty verdict is accepted
+Args:
+
+	verdict string: The verdict
+
+Returns:
+
+	bool: True if the verdict is valid
+*/
+func isValidVerdict(verdict string) bool {
+	return verdict == "" || contains([]string{VerdictExcellent, VerdictGood, VerdictAcceptable, VerdictPoor, VerdictVeryPoor}, verdict)
+}
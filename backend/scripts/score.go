@@ -0,0 +1,221 @@
+package scripts
+
+import "math"
+
+// Penalties subtracted from the weighted sub-ratings, they cover what the SSL Labs rating does not weigh
+const (
+	penaltyNoHSTS          = 5
+	penaltyWarnings        = 5
+	penaltyWeakCiphers     = 5
+	penaltyChainIssues     = 10
+	penaltyCertExpiring    = 10
+	penaltyCAANotPermitted = 10
+)
+
+/*
+Struct created to hold the sub-ratings of an endpoint, computed as described in the SSL Labs SSL Server Rating Guide
+(that is in the FilteredTLSReport->Endpoint struct)
+*/
+type SubRatings struct {
+	Protocol       int `json:"protocol"`       // Weight 30%
+	KeyExchange    int `json:"keyExchange"`    // Weight 30%
+	CipherStrength int `json:"cipherStrength"` // Weight 40%
+	Certificate    int `json:"certificate"`    // 100 when the certificate is valid, 0 otherwise (zeroes the score)
+}
+
+/*
+applyScores computes the sub-ratings and the 0-100 score of every endpoint and the score of the host.
+The host score follows the report aggregation: the lowest endpoint score for worst, the highest for best
+and the rounded average for majority, minus the host level penalties (CAA).
+
+Args:
+
+	reportInfo *FilteredTLSReport: The filtered report (modified in place)
+*/
+func applyScores(reportInfo *FilteredTLSReport) {
+	if len(reportInfo.Endpoints) == 0 {
+		reportInfo.Score = 0
+		return
+	}
+
+	total := 0
+	for i := range reportInfo.Endpoints {
+		endpoint := &reportInfo.Endpoints[i]
+		endpoint.SubRatings = computeSubRatings(*endpoint)
+		endpoint.Score = endpointScore(*endpoint)
+		total += endpoint.Score
+	}
+
+	score := reportInfo.Endpoints[0].Score
+	switch reportInfo.Aggregation {
+	case AggregationBest:
+		for _, endpoint := range reportInfo.Endpoints {
+			score = max(score, endpoint.Score)
+		}
+	case AggregationMajority:
+		score = int(math.Round(float64(total) / float64(len(reportInfo.Endpoints))))
+	default:
+		for _, endpoint := range reportInfo.Endpoints {
+			score = min(score, endpoint.Score)
+		}
+	}
+	if reportInfo.CAA != nil && reportInfo.CAA.IssuerStatus == CAAIssuerNotPermitted {
+		score -= penaltyCAANotPermitted
+	}
+
+	reportInfo.Score = max(score, 0)
+}
+
+/*
+computeSubRatings rates the protocol support, key exchange, cipher strength and certificate of an endpoint.
+
+Args:
+
+	endpoint FilteredEndpoint: The endpoint to rate
+
+Returns:
+
+	SubRatings: The sub-ratings, from 0 to 100 each
+*/
+func computeSubRatings(endpoint FilteredEndpoint) SubRatings {
+	ratings := SubRatings{Certificate: 100}
+
+	// Protocol support: average of the best and the worst protocol
+	best, worst := -1, -1
+	for _, protocol := range endpoint.Protocols {
+		protocolScore := map[string]int{"SSL 2.0": 0, "SSL 3.0": 80, "TLS 1.0": 90, "TLS 1.1": 95, "TLS 1.2": 100, "TLS 1.3": 100}[protocol]
+		if best == -1 || protocolScore > best {
+			best = protocolScore
+		}
+		if worst == -1 || protocolScore < worst {
+			worst = protocolScore
+		}
+	}
+	if best >= 0 {
+		ratings.Protocol = (best + worst) / 2
+	}
+
+	// Key exchange: based on the certificate key size (EC keys converted to their RSA equivalent)
+	if endpoint.Certificate != nil {
+		keySize := endpoint.Certificate.KeySize
+		if endpoint.Certificate.KeyAlgorithm == "EC" {
+			keySize = ecRSAEquivalent(keySize)
+		}
+		switch {
+		case keySize == 0:
+			ratings.KeyExchange = 0
+		case keySize < 512:
+			ratings.KeyExchange = 20
+		case keySize < 1024:
+			ratings.KeyExchange = 40
+		case keySize < 2048:
+			ratings.KeyExchange = 80
+		case keySize < 4096:
+			ratings.KeyExchange = 90
+		default:
+			ratings.KeyExchange = 100
+		}
+	}
+
+	// Cipher strength: average of the strongest and the weakest suite
+	ratings.CipherStrength = (cipherStrengthScore(endpoint.MaxCipherStrength) + cipherStrengthScore(endpoint.MinCipherStrength)) / 2
+
+	// Certificate: an expired or missing certificate zeroes the score
+	if endpoint.Certificate == nil || endpoint.Certificate.ExpiresInDays <= 0 {
+		ratings.Certificate = 0
+	}
+
+	return ratings
+}
+
+// RSA key sizes of the same strength as the EC key sizes (NIST SP 800-57), from the largest EC size
+var ecRSAEquivalents = []struct{ ec, rsa int64 }{
+	{521, 15360},
+	{384, 7680},
+	{256, 3072},
+	{224, 2048},
+	{160, 1024},
+}
+
+/*
+ecRSAEquivalent converts an EC key size to the RSA key size of the same strength, the one of the largest size of
+ecRSAEquivalents it reaches (e.g. P-256 ~ RSA 3072, P-384 ~ RSA 7680, P-521 ~ RSA 15360).
+
+Args:
+
+	bits int64: The EC key size in bits
+
+Returns:
+
+	int64: The RSA equivalent, the EC key size itself below 160 bits, which is rated as a broken key anyway
+*/
+func ecRSAEquivalent(bits int64) int64 {
+	for _, equivalent := range ecRSAEquivalents {
+		if bits >= equivalent.ec {
+			return equivalent.rsa
+		}
+	}
+	return bits
+}
+
+/*
+cipherStrengthScore rates a cipher strength as described in the SSL Labs SSL Server Rating Guide.
+
+Args:
+
+	bits float64: The cipher strength in bits
+
+Returns:
+
+	int: The rating, from 0 to 100
+*/
+func cipherStrengthScore(bits float64) int {
+	switch {
+	case bits <= 0:
+		return 0
+	case bits < 128:
+		return 20
+	case bits < 256:
+		return 80
+	default:
+		return 100
+	}
+}
+
+/*
+endpointScore combines the sub-ratings of an endpoint (30% protocol, 30% key exchange, 40% cipher strength)
+and subtracts the penalties of its configuration.
+
+Args:
+
+	endpoint FilteredEndpoint: The endpoint with its sub-ratings already computed
+
+Returns:
+
+	int: The score, from 0 to 100
+*/
+func endpointScore(endpoint FilteredEndpoint) int {
+	ratings := endpoint.SubRatings
+	if ratings.Certificate == 0 {
+		return 0
+	}
+
+	score := int(math.Round(0.3*float64(ratings.Protocol) + 0.3*float64(ratings.KeyExchange) + 0.4*float64(ratings.CipherStrength)))
+	if !isHSTSPresent(endpoint.HSTS) {
+		score -= penaltyNoHSTS
+	}
+	if endpoint.HasWarnings {
+		score -= penaltyWarnings
+	}
+	if endpoint.HasWeakCiphers {
+		score -= penaltyWeakCiphers
+	}
+	if endpoint.ChainIssues > 0 {
+		score -= penaltyChainIssues
+	}
+	if endpoint.Certificate.ExpiresInDays <= certExpiringThresholdDays {
+		score -= penaltyCertExpiring
+	}
+
+	return min(max(score, 0), 100)
+}
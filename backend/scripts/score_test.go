@@ -0,0 +1,158 @@
+package scripts
+
+import "testing"
+
+func TestECRSAEquivalent(t *testing.T) {
+	tests := []struct{ ec, want int64 }{
+		{0, 0},
+		{112, 112},
+		{160, 1024},
+		{224, 2048},
+		{256, 3072},
+		{384, 7680},
+		{521, 15360},
+	}
+	for _, test := range tests {
+		if got := ecRSAEquivalent(test.ec); got != test.want {
+			t.Errorf("ecRSAEquivalent(%d) = %d, want %d", test.ec, got, test.want)
+		}
+	}
+}
+
+/*
+scoreEndpoint returns an endpoint without penalties: protocol 100, key exchange 90 and cipher strength 90, a score of 93
+*/
+func scoreEndpoint() FilteredEndpoint {
+	return FilteredEndpoint{
+		Protocols:         []string{"TLS 1.2", "TLS 1.3"},
+		MinCipherStrength: 128,
+		MaxCipherStrength: 256,
+		HSTS:              &FilteredHSTS{Status: "present"},
+		Certificate:       &FilteredCertificate{KeyAlgorithm: "RSA", KeySize: 2048, ExpiresInDays: 90},
+	}
+}
+
+func TestComputeSubRatings(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*FilteredEndpoint)
+		want   SubRatings
+	}{
+		{name: "modern", change: func(*FilteredEndpoint) {}, want: SubRatings{Protocol: 100, KeyExchange: 90, CipherStrength: 90, Certificate: 100}},
+		{name: "legacy protocols", change: func(e *FilteredEndpoint) { e.Protocols = []string{"SSL 3.0", "TLS 1.2"} }, want: SubRatings{Protocol: 90, KeyExchange: 90, CipherStrength: 90, Certificate: 100}},
+		{name: "no protocols", change: func(e *FilteredEndpoint) { e.Protocols = nil }, want: SubRatings{Protocol: 0, KeyExchange: 90, CipherStrength: 90, Certificate: 100}},
+		{name: "RSA 4096", change: func(e *FilteredEndpoint) { e.Certificate.KeySize = 4096 }, want: SubRatings{Protocol: 100, KeyExchange: 100, CipherStrength: 90, Certificate: 100}},
+		{name: "RSA 1024", change: func(e *FilteredEndpoint) { e.Certificate.KeySize = 1024 }, want: SubRatings{Protocol: 100, KeyExchange: 80, CipherStrength: 90, Certificate: 100}},
+		{name: "EC 256", change: func(e *FilteredEndpoint) { e.Certificate.KeyAlgorithm, e.Certificate.KeySize = "EC", 256 }, want: SubRatings{Protocol: 100, KeyExchange: 90, CipherStrength: 90, Certificate: 100}},
+		{name: "EC 384", change: func(e *FilteredEndpoint) { e.Certificate.KeyAlgorithm, e.Certificate.KeySize = "EC", 384 }, want: SubRatings{Protocol: 100, KeyExchange: 100, CipherStrength: 90, Certificate: 100}},
+		{name: "weak cipher", change: func(e *FilteredEndpoint) { e.MinCipherStrength = 56 }, want: SubRatings{Protocol: 100, KeyExchange: 90, CipherStrength: 60, Certificate: 100}},
+		{name: "expired certificate", change: func(e *FilteredEndpoint) { e.Certificate.ExpiresInDays = 0 }, want: SubRatings{Protocol: 100, KeyExchange: 90, CipherStrength: 90, Certificate: 0}},
+		{name: "no certificate", change: func(e *FilteredEndpoint) { e.Certificate = nil }, want: SubRatings{Protocol: 100, KeyExchange: 0, CipherStrength: 90, Certificate: 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := scoreEndpoint()
+			test.change(&endpoint)
+			if got := computeSubRatings(endpoint); got != test.want {
+				t.Errorf("computeSubRatings() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndpointScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings SubRatings
+		change  func(*FilteredEndpoint)
+		want    int
+	}{
+		{name: "protocol weighs 30%", ratings: SubRatings{Protocol: 100, Certificate: 100}, want: 30},
+		{name: "key exchange weighs 30%", ratings: SubRatings{KeyExchange: 100, Certificate: 100}, want: 30},
+		{name: "cipher strength weighs 40%", ratings: SubRatings{CipherStrength: 100, Certificate: 100}, want: 40},
+		{name: "weighted sum", ratings: SubRatings{Protocol: 100, KeyExchange: 90, CipherStrength: 90, Certificate: 100}, want: 93},
+		{name: "rounded", ratings: SubRatings{Protocol: 95, KeyExchange: 80, CipherStrength: 80, Certificate: 100}, want: 85}, // 84.5
+		{name: "invalid certificate", ratings: SubRatings{Protocol: 100, KeyExchange: 100, CipherStrength: 100}, want: 0},
+		{name: "no HSTS", change: func(e *FilteredEndpoint) { e.HSTS = nil }, want: 93 - penaltyNoHSTS},
+		{name: "warnings", change: func(e *FilteredEndpoint) { e.HasWarnings = true }, want: 93 - penaltyWarnings},
+		{name: "weak ciphers", change: func(e *FilteredEndpoint) { e.HasWeakCiphers = true }, want: 93 - penaltyWeakCiphers},
+		{name: "chain issues", change: func(e *FilteredEndpoint) { e.ChainIssues = 2 }, want: 93 - penaltyChainIssues},
+		{name: "certificate expiring", change: func(e *FilteredEndpoint) { e.Certificate.ExpiresInDays = 30 }, want: 93 - penaltyCertExpiring},
+		{
+			name: "every penalty",
+			change: func(e *FilteredEndpoint) {
+				e.HSTS, e.HasWarnings, e.HasWeakCiphers, e.ChainIssues, e.Certificate.ExpiresInDays = nil, true, true, 1, 10
+			},
+			want: 93 - penaltyNoHSTS - penaltyWarnings - penaltyWeakCiphers - penaltyChainIssues - penaltyCertExpiring,
+		},
+		{
+			name:    "not below 0",
+			ratings: SubRatings{Protocol: 20, Certificate: 100},
+			change:  func(e *FilteredEndpoint) { e.HSTS, e.HasWarnings = nil, true },
+			want:    0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := scoreEndpoint()
+			endpoint.SubRatings = computeSubRatings(endpoint)
+			if test.ratings != (SubRatings{}) {
+				endpoint.SubRatings = test.ratings
+			}
+			if test.change != nil {
+				test.change(&endpoint)
+			}
+			if got := endpointScore(endpoint); got != test.want {
+				t.Errorf("endpointScore() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyScores(t *testing.T) {
+	weak := scoreEndpoint()
+	weak.HSTS = nil // 88
+	legacy := scoreEndpoint()
+	legacy.Protocols = []string{"TLS 1.0", "TLS 1.2"} // Protocol 95: 91.5, rounded to 92
+	tests := []struct {
+		name        string
+		aggregation string
+		endpoints   []FilteredEndpoint
+		caa         *FilteredCAA
+		want        int
+	}{
+		{name: "no endpoints", aggregation: AggregationWorst, want: 0},
+		{name: "worst", aggregation: AggregationWorst, endpoints: []FilteredEndpoint{scoreEndpoint(), weak, legacy}, want: 88},
+		{name: "best", aggregation: AggregationBest, endpoints: []FilteredEndpoint{weak, scoreEndpoint(), legacy}, want: 93},
+		{name: "majority averages", aggregation: AggregationMajority, endpoints: []FilteredEndpoint{scoreEndpoint(), weak, legacy}, want: 91}, // 273 / 3
+		{name: "unknown aggregation is worst", aggregation: "other", endpoints: []FilteredEndpoint{scoreEndpoint(), weak}, want: 88},
+		{
+			name:        "CAA not permitted",
+			aggregation: AggregationWorst,
+			endpoints:   []FilteredEndpoint{scoreEndpoint()},
+			caa:         &FilteredCAA{IssuerStatus: CAAIssuerNotPermitted},
+			want:        93 - penaltyCAANotPermitted,
+		},
+		{
+			name:        "CAA permitted",
+			aggregation: AggregationWorst,
+			endpoints:   []FilteredEndpoint{scoreEndpoint()},
+			caa:         &FilteredCAA{IssuerStatus: CAAIssuerPermitted},
+			want:        93,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := &FilteredTLSReport{Aggregation: test.aggregation, Endpoints: test.endpoints, CAA: test.caa, Score: 50}
+			applyScores(report)
+			if report.Score != test.want {
+				t.Errorf("score = %d, want %d", report.Score, test.want)
+			}
+			for i, endpoint := range report.Endpoints {
+				if endpoint.SubRatings != computeSubRatings(endpoint) || endpoint.Score != endpointScore(endpoint) {
+					t.Errorf("endpoint %d: sub-ratings %+v and score %d not computed", i, endpoint.SubRatings, endpoint.Score)
+				}
+			}
+		})
+	}
+}
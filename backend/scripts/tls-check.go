@@ -1,17 +1,92 @@
 package scripts
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/tidwall/gjson"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// ErrSSLLabsOverloaded is returned when SSL Labs rejects a request because of its rate limits or because it is overloaded,
+// the request can be retried later
+var ErrSSLLabsOverloaded = errors.New("SSL Labs is rate limiting or overloaded, try again later")
+
+// Base URL of the SSL Labs API and the client used to call it, set with ConfigureSSLLabs
+var (
+	sslLabsAPIURL = "https://api.ssllabs.com/api/v2"
+	sslLabsClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+/*
+ConfigureSSLLabs sets the SSL Labs API used by CheckTLS, it must be called before the first assessment
+Args:
+
+	apiURL string: Base URL of the API (v2), e.g. a proxy or a mock server
+	timeout time.Duration: Timeout of each HTTP request
+*/
+func ConfigureSSLLabs(apiURL string, timeout time.Duration) {
+	sslLabsAPIURL = strings.TrimRight(apiURL, "/")
+	sslLabsClient = &http.Client{Timeout: timeout}
+}
+
+/*
+Struct created to hold the availability of SSL Labs for this client, returned by its /info endpoint
+*/
+type SSLLabsInfo struct {
+	EngineVersion        string   `json:"engineVersion"`
+	CriteriaVersion      string   `json:"criteriaVersion"`
+	MaxAssessments       int      `json:"maxAssessments"`       // Assessments the client may run at the same time
+	CurrentAssessments   int      `json:"currentAssessments"`   // Assessments of the client currently running
+	NewAssessmentCoolOff int64    `json:"newAssessmentCoolOff"` // Milliseconds to wait between starting two assessments
+	Messages             []string `json:"messages"`
+}
+
+/*
+GetSSLLabsInfo queries the /info endpoint of SSL Labs, to know how many new assessments can be started
+Args:
+
+	ctx context.Context: Context of the request
+
+Returns:
+
+	*SSLLabsInfo: Pointer of the availability information
+	error: Any error encountered during the process, ErrSSLLabsOverloaded if SSL Labs is overloaded
+*/
+func GetSSLLabsInfo(ctx context.Context) (*SSLLabsInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sslLabsAPIURL+"/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sslLabsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, 529:
+		return nil, fmt.Errorf("%w (HTTP %d)", ErrSSLLabsOverloaded, resp.StatusCode)
+	default:
+		return nil, fmt.Errorf("SSL Labs /info returned HTTP %d", resp.StatusCode)
+	}
+	var info SSLLabsInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("Error decoding SSL Labs /info: %v", err)
+	}
+	return &info, nil
+}
+
 /*
 CheckTLS initiates a TLS assessment for the given domain using SSL Labs API
 Args:
 
+	ctx context.Context: Context to cancel the request or bound it with a deadline
 	domain string: The domain to assess
 	startnew bool: Whether to start a new assessment or use cached results
 
@@ -20,22 +95,28 @@ Returns:
 	[]byte: The assessment result in byte format
 	error: Any error encountered during the process
 */
-func CheckTLS(domain string, startnew bool) ([]byte, error) {
+func CheckTLS(ctx context.Context, domain string, startnew bool) ([]byte, error) {
 	// First SSL Labs API endpoints for TLS checking
-	var SSL_Lab_Api_Entrypoint = fmt.Sprintf("https://api.ssllabs.com/api/v2/analyze?host=%s&publish=off&all=done&ignoreMismatch=on", domain)
+	var SSL_Lab_Api_Entrypoint = fmt.Sprintf("%s/analyze?host=%s&publish=off&all=done&ignoreMismatch=on", sslLabsAPIURL, url.QueryEscape(domain))
 	if startnew {
 		SSL_Lab_Api_Entrypoint += "&startNew=on" // Indicates to start a new assessment
 	} else {
 		SSL_Lab_Api_Entrypoint += "&fromCache=on" // Indicates to use cached results if available
 	}
 
-	req, _ := http.NewRequest("GET", SSL_Lab_Api_Entrypoint, nil)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, SSL_Lab_Api_Entrypoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sslLabsClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, 529: // 529: SSL Labs overloaded
+		return nil, fmt.Errorf("%w (HTTP %d)", ErrSSLLabsOverloaded, resp.StatusCode)
+	}
 	body, _ := io.ReadAll(resp.Body)
 	//var result []byte
 	//json.Unmarshal(body, &result)
@@ -55,10 +136,28 @@ Returns:
 	error: Any error encountered during the process
 */
 func PollUntilReady(domain string) ([]byte, error) {
+	return PollUntilReadyContext(context.Background(), domain, 10*time.Second)
+}
+
+/*
+PollUntilReadyContext polls the SSL Labs API until the TLS assessment for the domain is ready or the context is done
+Args:
+
+	ctx context.Context: Context to cancel the polling or bound it with a deadline
+	domain string: The domain to assess
+	interval time.Duration: The wait between two polls
+
+Returns:
+
+	[]byte: The final assessment result in byte format
+	error: Any error encountered during the process, the context error if it ended before the assessment
+*/
+func PollUntilReadyContext(ctx context.Context, domain string, interval time.Duration) ([]byte, error) {
 
 	for { // Bucle infinito hasta que llegue a un return o break
-		result, err := CheckTLS(domain, false) // Llama a la funcion CheckTLS con startnew en false porque ya se inicio la evaluacion antes
-		if err != nil {
+		result, err := CheckTLS(ctx, domain, false) // Llama a la funcion CheckTLS con startnew en false porque ya se inicio la evaluacion antes
+		// When SSL Labs is overloaded the assessment keeps running, so it is polled again later
+		if err != nil && !errors.Is(err, ErrSSLLabsOverloaded) {
 			return nil, err
 		}
 		status := gjson.GetBytes(result, "status").String()
@@ -68,6 +167,11 @@ func PollUntilReady(domain string) ([]byte, error) {
 		case "ERROR":
 			return nil, fmt.Errorf("Error during TLS assessment for domain %s", domain)
 		}
-		time.Sleep(10 * time.Second) // Wait before polling again
+
+		select { // Wait before polling again
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
 	}
 }
@@ -0,0 +1,216 @@
+package scripts
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Minimum max-age (one year, in seconds) accepted by the HSTS preload lists
+const hstsPreloadMinMaxAge = 31536000
+
+/*
+Struct created to hold the structured HSTS policy of an endpoint (that is in the FilteredTLSReport->Endpoint struct)
+*/
+type FilteredHSTS struct {
+	Status            string                `json:"status"`
+	Header            string                `json:"header"`
+	MaxAge            int64                 `json:"maxAge"`
+	IncludeSubDomains bool                  `json:"includeSubDomains"`
+	Preload           bool                  `json:"preload"`
+	Preloads          []FilteredHSTSPreload `json:"preloads"`        // Preload list status for Chrome, Firefox, Edge and IE
+	PreloadEligible   bool                  `json:"preloadEligible"` // True if the host meets the preload list submission rules
+	PreloadIssues     []string              `json:"preloadIssues"`   // Reasons why the host is not eligible for preloading
+}
+
+/*
+Struct created to hold the status of a host in one browser HSTS preload list
+*/
+type FilteredHSTSPreload struct {
+	Source   string `json:"source"`
+	Hostname string `json:"hostname"`
+	Status   string `json:"status"`
+}
+
+/*
+Struct created to hold a public key pinning policy, used for both the dynamic (HPKP header) and static (browser built-in) pins
+*/
+type FilteredPinPolicy struct {
+	Status            string   `json:"status"`
+	MaxAge            int64    `json:"maxAge"`
+	IncludeSubDomains bool     `json:"includeSubDomains"`
+	ReportURI         string   `json:"reportUri"`
+	Pins              []string `json:"pins"`
+	MatchedPins       []string `json:"matchedPins"`
+}
+
+/*
+Struct created to hold one HTTP request made by SSL Labs while assessing the endpoint
+*/
+type FilteredHTTPTransaction struct {
+	RequestURL string `json:"requestUrl"`
+	StatusCode int64  `json:"statusCode"`
+	Location   string `json:"location"` // Redirect target, empty when the response is not a redirect
+}
+
+/*
+extractHSTS assembles the HSTS policy object, including the preload lists status and the preload eligibility.
+Args:
+
+	endpoint gjson.Result: The endpoint result given by the library gjson
+
+Returns:
+
+	*FilteredHSTS: Pointer of the FilteredHSTS Struct
+*/
+func extractHSTS(endpoint gjson.Result) *FilteredHSTS {
+	policy := endpoint.Get("details.hstsPolicy")
+	hsts := &FilteredHSTS{
+		Status:            policy.Get("status").String(),
+		Header:            policy.Get("header").String(),
+		MaxAge:            policy.Get("maxAge").Int(),
+		IncludeSubDomains: policy.Get("includeSubDomains").Bool(),
+		Preload:           policy.Get("preload").Bool(),
+	}
+
+	endpoint.Get("details.hstsPreloads").ForEach(func(_, p gjson.Result) bool {
+		hsts.Preloads = append(hsts.Preloads, FilteredHSTSPreload{
+			Source:   p.Get("source").String(),
+			Hostname: p.Get("hostname").String(),
+			Status:   p.Get("status").String(),
+		})
+		return true
+	})
+
+	hsts.PreloadIssues = checkPreloadEligibility(hsts, extractHTTPTransactions(endpoint))
+	hsts.PreloadEligible = len(hsts.PreloadIssues) == 0
+
+	return hsts
+}
+
+/*
+checkPreloadEligibility applies the HSTS preload list submission rules (hstspreload.org) to a policy.
+Args:
+
+	hsts *FilteredHSTS: The HSTS policy of the endpoint
+	transactions []FilteredHTTPTransaction: The HTTP requests made during the assessment
+
+Returns:
+
+	[]string: The list of unmet requirements (empty when the host is eligible)
+*/
+func checkPreloadEligibility(hsts *FilteredHSTS, transactions []FilteredHTTPTransaction) []string {
+	var issues []string
+
+	if !isHSTSPresent(hsts) {
+		return append(issues, "HSTS header is not present")
+	}
+	if hsts.MaxAge < hstsPreloadMinMaxAge {
+		issues = append(issues, "max-age is lower than one year (31536000 seconds)")
+	}
+	if !hsts.IncludeSubDomains {
+		issues = append(issues, "includeSubDomains directive is missing")
+	}
+	if !hsts.Preload {
+		issues = append(issues, "preload directive is missing")
+	}
+	for _, t := range transactions {
+		if strings.HasPrefix(strings.ToLower(t.Location), "http://") {
+			issues = append(issues, "redirects to plain HTTP: "+t.Location)
+			break
+		}
+	}
+
+	return issues
+}
+
+/*
+isHSTSPresent tells whether an endpoint serves a valid HSTS policy.
+Args:
+
+	hsts *FilteredHSTS: The HSTS policy of the endpoint (may be nil)
+
+Returns:
+
+	bool: true if the policy status is "present", false otherwise
+*/
+func isHSTSPresent(hsts *FilteredHSTS) bool {
+	return hsts != nil && hsts.Status == "present"
+}
+
+/*
+extractPinPolicy assembles a public key pinning policy object from the given report path.
+Args:
+
+	endpoint gjson.Result: The endpoint result given by the library gjson
+	path string: Path of the policy inside the endpoint (e.g. "details.hpkpPolicy", "details.staticPkpPolicy")
+
+Returns:
+
+	*FilteredPinPolicy: Pointer of the FilteredPinPolicy Struct, nil if the report does not have the policy
+*/
+func extractPinPolicy(endpoint gjson.Result, path string) *FilteredPinPolicy {
+	policy := endpoint.Get(path)
+	if !policy.Exists() {
+		return nil
+	}
+
+	return &FilteredPinPolicy{
+		Status:            policy.Get("status").String(),
+		MaxAge:            policy.Get("maxAge").Int(),
+		IncludeSubDomains: policy.Get("includeSubDomains").Bool(),
+		ReportURI:         policy.Get("reportUri").String(),
+		Pins:              extractPins(policy.Get("pins")),
+		MatchedPins:       extractPins(policy.Get("matchedPins")),
+	}
+}
+
+/*
+extractPins converts a list of SSL Labs pins into "hashFunction/value" strings.
+Args:
+
+	pins gjson.Result: The pins array given by the library gjson
+
+Returns:
+
+	pinsArray []string: Slice with the pins
+*/
+func extractPins(pins gjson.Result) (pinsArray []string) {
+	pins.ForEach(func(_, p gjson.Result) bool {
+		pinsArray = append(pinsArray, p.Get("hashFunction").String()+"/"+p.Get("value").String())
+		return true
+	})
+
+	return pinsArray
+}
+
+/*
+extractHTTPTransactions assembles the slice of HTTP requests made by SSL Labs, with their status codes and redirects.
+Args:
+
+	endpoint gjson.Result: The endpoint result given by the library gjson
+
+Returns:
+
+	transactions []FilteredHTTPTransaction: Slice with the HTTP transactions
+*/
+func extractHTTPTransactions(endpoint gjson.Result) (transactions []FilteredHTTPTransaction) {
+	endpoint.Get("details.httpTransactions").ForEach(func(_, t gjson.Result) bool {
+		transaction := FilteredHTTPTransaction{
+			RequestURL: t.Get("requestUrl").String(),
+			StatusCode: t.Get("statusCode").Int(),
+		}
+		t.Get("responseHeaders").ForEach(func(_, h gjson.Result) bool {
+			if strings.EqualFold(h.Get("name").String(), "Location") {
+				transaction.Location = h.Get("value").String()
+				return false
+			}
+			return true
+		})
+
+		transactions = append(transactions, transaction)
+		return true
+	})
+
+	return transactions
+}
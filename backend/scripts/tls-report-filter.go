@@ -15,41 +15,77 @@ Struct created to hold the filtered TLS report information
 type FilteredTLSReport struct {
 	Host        string             `json:"host"`
 	WebProtocol string             `json:"webProtocol"`
-	Endpoints   []FilteredEndpoint `json:"endpoints"` // List of filtered endpoints
+	Endpoints   []FilteredEndpoint `json:"endpoints"`   // List of filtered endpoints
+	CAA         *FilteredCAA       `json:"caa"`         // DNS CAA records and issuer verification
+	Grade       string             `json:"grade"`       // Domain grade, computed from the endpoint grades
+	Score       int                `json:"score"`       // Domain score from 0 to 100, computed from the endpoint scores
+	Aggregation string             `json:"aggregation"` // Strategy used to compute the domain grade (worst, best or majority)
+	Verdict     string             `json:"verdict"`     // Language-neutral verdict (EXCELLENT, GOOD, ACCEPTABLE, POOR, VERY_POOR)
+	VerdictText string             `json:"verdictText"` // Verdict localized in the report language
+	Language    string             `json:"language"`    // Language of the summary and texts (es or en)
+	Findings    []Finding          `json:"findings"`    // Structured observations, the summary is generated from them
 	Summary     string             `json:"summary"`
-	Timestamp   time.Time          `json:"timestamp"`
+	Timestamp   time.Time          `json:"timestamp"`      // When SSL Labs tested the host (testTime), or when the report was made if unknown
+	Scan        *ScanMetadata      `json:"scan,omitempty"` // Assessment details, nil for reports created without SSL Labs
+}
+
+/*
+Struct created to hold the details of the SSL Labs assessment of a report, to tell how current its grade is
+*/
+type ScanMetadata struct {
+	StartTime       *time.Time `json:"startTime,omitempty"`       // When the assessment started
+	TestTime        *time.Time `json:"testTime,omitempty"`        // When the assessment finished
+	DurationSeconds float64    `json:"durationSeconds,omitempty"` // Time between startTime and testTime
+	EngineVersion   string     `json:"engineVersion,omitempty"`   // Version of the SSL Labs assessment engine
+	CriteriaVersion string     `json:"criteriaVersion,omitempty"` // Version of the SSL Labs grading criteria
+	FromCache       bool       `json:"fromCache"`                 // True if SSL Labs returned an assessment made before the scan was requested
+	ScanRequestID   string     `json:"scanRequestID,omitempty"`   // Scan request of /start-scan that produced the report
 }
 
 /*
 Struct created to hold the filtered endpoint information (that is in the FilteredTLSReport struct)
 */
 type FilteredEndpoint struct {
-	IPAddress                string               `json:"ipAddress"`
-	Grade                    string               `json:"grade"`
-	HasWarnings              bool                 `json:"hasWarnings"`
-	IsExceptional            bool                 `json:"isExceptional"`
-	Certificate              *FilteredCertificate `json:"certificate"`
-	Protocols                []string             `json:"protocols"`
-	NegotiatedCipherStrength float64              `json:"negotiatedCipherStrength"`
-	MaxCipherStrength        float64              `json:"maxCipherStrength"`
-	HasWeakCiphers           bool                 `json:"hasWeakCiphers"`
-	HSTS                     string               `json:"hsts"`
-	Server                   string               `json:"server"`
-	ChainIssues              int64                `json:"issues"`
+	IPAddress                string                    `json:"ipAddress"`
+	Grade                    string                    `json:"grade"`
+	Verdict                  string                    `json:"verdict"`
+	VerdictText              string                    `json:"verdictText"`
+	Score                    int                       `json:"score"` // From 0 to 100
+	SubRatings               SubRatings                `json:"subRatings"`
+	HasWarnings              bool                      `json:"hasWarnings"`
+	IsExceptional            bool                      `json:"isExceptional"`
+	Certificate              *FilteredCertificate      `json:"certificate"`
+	Protocols                []string                  `json:"protocols"`
+	NegotiatedCipherStrength float64                   `json:"negotiatedCipherStrength"`
+	MaxCipherStrength        float64                   `json:"maxCipherStrength"`
+	MinCipherStrength        float64                   `json:"minCipherStrength"`
+	HasWeakCiphers           bool                      `json:"hasWeakCiphers"`
+	CipherSuites             []string                  `json:"cipherSuites"`
+	HSTS                     *FilteredHSTS             `json:"hsts"`
+	HPKP                     *FilteredPinPolicy        `json:"hpkp"`       // Dynamic pins sent in the Public-Key-Pins header
+	StaticPins               *FilteredPinPolicy        `json:"staticPins"` // Pins built into the browsers
+	HTTPStatusCode           int64                     `json:"httpStatusCode"`
+	HTTPForwarding           string                    `json:"httpForwarding"`
+	HTTPTransactions         []FilteredHTTPTransaction `json:"httpTransactions"`
+	Server                   string                    `json:"server"`
+	ChainIssues              int64                     `json:"issues"`
 }
 
 /*
 Struct created to hold the filtered certificate information (that is in the FilteredTLSReport->Endpoint struct)
 */
 type FilteredCertificate struct {
-	Subject       string  `json:"subject"`
-	Issuer        string  `json:"issuer"`
-	ValidityYears float64 `json:"validityYears"`
-	ExpiresInDays float64 `json:"expiresInDays"`
+	Subject            string  `json:"subject"`
+	Issuer             string  `json:"issuer"`
+	ValidityYears      float64 `json:"validityYears"`
+	ExpiresInDays      float64 `json:"expiresInDays"`
+	KeyAlgorithm       string  `json:"keyAlgorithm"` // e.g. "RSA", "EC"
+	KeySize            int64   `json:"keySize"`
+	SignatureAlgorithm string  `json:"signatureAlgorithm"` // e.g. "SHA256withRSA"
 }
 
 /*
-FilterSSLReport is a function that assembles the new parsed report object and returns it
+FilterSSLReport is a function that assembles the new parsed report object and returns it, using the default options
 Args:
 
 	rawReport []byte: the report info in byte format,so the gjson library can use it
@@ -60,6 +96,22 @@ Returns:
 	error: Any error encountered during the process
 */
 func FilterSSLReport(rawReport []byte) (*FilteredTLSReport, error) {
+	return FilterSSLReportWithOptions(rawReport, FilterOptions{Aggregation: DefaultAggregation, Language: DefaultLanguage})
+}
+
+/*
+FilterSSLReportWithOptions is a function that assembles the new parsed report object and returns it
+Args:
+
+	rawReport []byte: the report info in byte format,so the gjson library can use it
+	options FilterOptions: the options of the filter (e.g. the grade aggregation strategy)
+
+Returns:
+
+	*FilteredTLSReport: Pointer of the FilterTLSReport Struct
+	error: Any error encountered during the process
+*/
+func FilterSSLReportWithOptions(rawReport []byte, options FilterOptions) (*FilteredTLSReport, error) {
 
 	if len(rawReport) == 0 {
 		return nil, fmt.Errorf("rawReport is empty (no data received from SSL Labs)")
@@ -69,10 +121,29 @@ func FilterSSLReport(rawReport []byte) (*FilteredTLSReport, error) {
 		return nil, fmt.Errorf("rawReport is not valid JSON")
 	}
 
+	scan := extractScanMetadata(rawReport, options)
+	timestamp := time.Now()
+	if scan.TestTime != nil {
+		timestamp = *scan.TestTime
+	} else if scan.StartTime != nil { // An assessment cut short keeps at least its start
+		timestamp = *scan.StartTime
+	} else if options.RequireTestTime {
+		return nil, fmt.Errorf("the report has no testTime")
+	}
+
 	report := &FilteredTLSReport{
 		Host:        gjson.GetBytes(rawReport, "host").String(),
 		WebProtocol: gjson.GetBytes(rawReport, "protocol").String(),
-		Timestamp:   time.Now(),
+		Aggregation: options.Aggregation,
+		Language:    options.Language,
+		Timestamp:   timestamp,
+		Scan:        scan,
+	}
+	if !IsValidAggregation(report.Aggregation) {
+		report.Aggregation = DefaultAggregation
+	}
+	if !IsSupportedLanguage(report.Language) {
+		report.Language = DefaultLanguage
 	}
 
 	endpointsData := gjson.GetBytes(rawReport, "endpoints")
@@ -91,40 +162,133 @@ func FilterSSLReport(rawReport []byte) (*FilteredTLSReport, error) {
 			Protocols:                extractProtocols(endpoint),
 			NegotiatedCipherStrength: endpoint.Get("details.suites.list[0].cipherStrength").Float(),
 			MaxCipherStrength:        captureMaxCipherStrength(endpoint),
+			MinCipherStrength:        captureMinCipherStrength(endpoint),
 			HasWeakCiphers:           existsWeakCipher(endpoint),
-			HSTS:                     endpoint.Get("details.hstsPolicy.status").String(),
+			CipherSuites:             extractCipherSuites(endpoint),
+			HSTS:                     extractHSTS(endpoint),
+			HPKP:                     extractPinPolicy(endpoint, "details.hpkpPolicy"),
+			StaticPins:               extractPinPolicy(endpoint, "details.staticPkpPolicy"),
+			HTTPStatusCode:           endpoint.Get("details.httpStatusCode").Int(),
+			HTTPForwarding:           endpoint.Get("details.httpForwarding").String(),
+			HTTPTransactions:         extractHTTPTransactions(endpoint),
 			Server:                   endpoint.Get("details.serverSignature").String(),
 			ChainIssues:              endpoint.Get("details.chain.issues").Int(),
-			Certificate:              extractCertificateData(endpoint),
+			Certificate:              extractCertificateData(endpoint, report.Timestamp),
 		}
+		fe.Verdict = endpointVerdict(fe)
+		fe.VerdictText = Translate(report.Language, "verdict."+fe.Verdict)
 
 		filteredEndpoints = append(filteredEndpoints, fe)
 	}
 
 	report.Endpoints = filteredEndpoints
+	if report.CAA = extractCAAPolicy(endpointsData.Array()); report.CAA != nil {
+		evaluateCAAIssuers(report)
+	}
 	report.Summary = generateSummary(report)
 
 	return report, nil
 }
 
+/*
+RecomputeReport derives again the endpoint verdicts, the CAA issuer check, the grade, verdict, scores, findings and
+summary of a report from its endpoints, so a report written through the API can not keep values that contradict
+them. A report without endpoints keeps its values, there is nothing to derive them from
+Args:
+
+	report *FilteredTLSReport: The report (modified in place), without language or aggregation the defaults are used
+*/
+func RecomputeReport(report *FilteredTLSReport) {
+	if !IsSupportedLanguage(report.Language) {
+		report.Language = DefaultLanguage
+	}
+	if report.Aggregation == "" {
+		report.Aggregation = DefaultAggregation
+	}
+	if len(report.Endpoints) == 0 {
+		return
+	}
+
+	for i := range report.Endpoints {
+		report.Endpoints[i].Verdict = endpointVerdict(report.Endpoints[i])
+		report.Endpoints[i].VerdictText = Translate(report.Language, "verdict."+report.Endpoints[i].Verdict)
+	}
+	if report.CAA != nil {
+		evaluateCAAIssuers(report)
+	}
+	report.Summary = generateSummary(report)
+}
+
+/*
+extractScanMetadata assembles the details of the assessment
+Args:
+
+	rawReport []byte: the report info in byte format
+	options FilterOptions: the options of the filter, with the scan request the report belongs to
+
+Returns:
+
+	*ScanMetadata: Pointer of the ScanMetadata Struct
+*/
+func extractScanMetadata(rawReport []byte, options FilterOptions) *ScanMetadata {
+	scan := &ScanMetadata{
+		StartTime:       reportTime(rawReport, "startTime"),
+		TestTime:        reportTime(rawReport, "testTime"),
+		EngineVersion:   gjson.GetBytes(rawReport, "engineVersion").String(),
+		CriteriaVersion: gjson.GetBytes(rawReport, "criteriaVersion").String(),
+		ScanRequestID:   options.ScanRequestID,
+	}
+	if scan.StartTime != nil && scan.TestTime != nil && !scan.TestTime.Before(*scan.StartTime) {
+		scan.DurationSeconds = math.Round(scan.TestTime.Sub(*scan.StartTime).Seconds()*10) / 10
+	}
+	if scan.TestTime != nil && !options.RequestedAt.IsZero() {
+		scan.FromCache = scan.TestTime.Before(options.RequestedAt)
+	}
+	return scan
+}
+
+/*
+reportTime reads a time of the report, SSL Labs writes them in milliseconds since the Unix epoch
+Args:
+
+	rawReport []byte: the report info in byte format
+	field string: the field name (startTime or testTime)
+
+Returns:
+
+	*time.Time: The time (UTC), nil if the field is missing
+*/
+func reportTime(rawReport []byte, field string) *time.Time {
+	ms := gjson.GetBytes(rawReport, field).Int()
+	if ms <= 0 {
+		return nil
+	}
+	t := time.UnixMilli(ms).UTC()
+	return &t
+}
+
 /*
 extractCertificateData assembles the certificate object.
 Args:
 
 	endpoint gjson.Result: The endpoint result given by the library gjson
+	reportTime time.Time: The time of the report, the days until the certificate expires are counted from it
 
 Returns:
 
 	*FilteredCertificate: Pointer of the FilteredCertificate Struct
 	error: Any error encountered during the process
 */
-func extractCertificateData(endpoint gjson.Result) *FilteredCertificate {
-	validityYears, expireInDays := calculateCertValidity(endpoint)
+func extractCertificateData(endpoint gjson.Result, reportTime time.Time) *FilteredCertificate {
+	validityYears, expireInDays := calculateCertValidity(endpoint, reportTime)
 	certificate := &FilteredCertificate{
-		Subject:       endpoint.Get("details.cert.subject").String(),
-		Issuer:        endpoint.Get("details.cert.issuerSubject").String(),
-		ValidityYears: validityYears,
-		ExpiresInDays: expireInDays,
+		Subject:            endpoint.Get("details.cert.subject").String(),
+		Issuer:             endpoint.Get("details.cert.issuerSubject").String(),
+		ValidityYears:      validityYears,
+		ExpiresInDays:      expireInDays,
+		KeyAlgorithm:       endpoint.Get("details.key.alg").String(),
+		KeySize:            endpoint.Get("details.key.size").Int(),
+		SignatureAlgorithm: endpoint.Get("details.cert.sigAlg").String(),
 	}
 
 	return certificate
@@ -136,13 +300,14 @@ calculateCertValidity grab the notBefore and notAfter info from the report and t
 Args:
 
 	endpoint gjson.Result: The endpoint result given by the library gjson
+	reportTime time.Time: The time expiresInDays is counted from
 
 Returns:
 
 	validityYears float64: A float number that indicates in how many years is the certificate valid for
 	expiresInDays float64: A float number that indicates in how many days is expiring the certificate
 */
-func calculateCertValidity(endpoint gjson.Result) (validityYears float64, expiresInDays float64) {
+func calculateCertValidity(endpoint gjson.Result, reportTime time.Time) (validityYears float64, expiresInDays float64) {
 	notBeforeMs := endpoint.Get("details.cert.notBefore").Float()
 	notAfterMs := endpoint.Get("details.cert.notAfter").Float()
 
@@ -157,8 +322,7 @@ func calculateCertValidity(endpoint gjson.Result) (validityYears float64, expire
 	validityDays := validityDuration.Hours() / 24
 	validityYears = validityDays / 365.25
 
-	currentTime := time.Now().UTC()
-	expiresDuration := notAfter.Sub(currentTime)
+	expiresDuration := notAfter.Sub(reportTime)
 	expiresInDays = expiresDuration.Hours() / 24
 
 	validityYears = math.Round(validityYears*10) / 10
@@ -188,6 +352,27 @@ func extractProtocols(endpoint gjson.Result) (protocolsArray []string) {
 
 }
 
+/*
+extractCipherSuites assembles the slice of the cipher suites names supported by the endpoint.
+Args:
+
+	endpoint gjson.Result: The endpoint result given by the library gjson
+
+Returns:
+
+	suitesArray []string: Slice with the cipher suites names (e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+*/
+func extractCipherSuites(endpoint gjson.Result) (suitesArray []string) {
+
+	endpoint.Get("details.suites.list").ForEach(func(_, suite gjson.Result) bool {
+		suitesArray = append(suitesArray, suite.Get("name").String())
+		return true
+	})
+
+	return suitesArray
+
+}
+
 /*
 
 captureMaxCipherStrength search for the maximum value of CipherStrength in the Report
@@ -212,6 +397,29 @@ func captureMaxCipherStrength(endpoint gjson.Result) (maximumMaxCipherStrength f
 	return maximumMaxCipherStrength
 }
 
+/*
+
+captureMinCipherStrength search for the minimum value of CipherStrength in the Report
+Args:
+
+			endpoint gjson.Result: The endpoint result given by the library gjson
+
+	Returns:
+			minimumCipherStrength float64: the minimum value of CipherStrength founded in the report (0 if there are no suites)
+
+*/
+
+func captureMinCipherStrength(endpoint gjson.Result) (minimumCipherStrength float64) {
+	suiteList := endpoint.Get("details.suites.list").Array()
+	for i, value := range suiteList {
+		if i == 0 || value.Get("cipherStrength").Float() < minimumCipherStrength {
+			minimumCipherStrength = value.Get("cipherStrength").Float()
+		}
+	}
+
+	return minimumCipherStrength
+}
+
 /*existsWeakCipher search for a value of ciphererStrenght <= 112
 Args:
 
@@ -238,16 +446,18 @@ func existsWeakCipher(endpoint gjson.Result) (existWeakCipher bool) {
 /*
 generateSummary builds a human-readable TLS security summary for a domain
 based on the aggregated results of all scanned endpoints. In addition to
-the textual summary, it computes a final security verdict.
+the textual summary, it computes the domain grade, the structured findings
+(which the summary is generated from), the numeric scores and the final security verdict, storing them in the report.
 
 The function analyzes multiple TLS-related factors across endpoints, such as:
-- Best overall TLS grade
+- Domain grade, aggregated with the report strategy (worst by default)
 - Presence of warnings or exceptional configurations
 - Supported TLS versions (e.g., TLS 1.3)
 - HSTS configuration
 - Weak cipher usage
 - Certificate expiration status
 - Certificate chain issues
+- Endpoints that drag the domain grade down
 
 Args:
 		reportInfo *FilteredTLSReport: Pointer to the filtered TLS report struct
@@ -258,27 +468,21 @@ Returns:
 */
 
 func generateSummary(reportInfo *FilteredTLSReport) string {
-	if reportInfo == nil || len(reportInfo.Endpoints) == 0 {
-		return "No valid information could be obtained from the TLS analysis"
+	if reportInfo == nil {
+		return Translate(DefaultLanguage, "summary.empty")
+	}
+	if len(reportInfo.Endpoints) == 0 {
+		return Translate(reportInfo.Language, "summary.empty")
 	}
 
 	// initializing the variables
-	bestPriority := getGradePriority("F")
-	bestGrade := "F"
+	grade := aggregateGrade(reportInfo.Endpoints, reportInfo.Aggregation)
 	hasWarningsAny := false
 	isExceptionalAny := false
 	hasTLS13 := false
 	hasHSTS := false
-	hasWeakCiphersAny := false
-	minExpiresDays := 9999.0
-	chainIssuesAny := int64(0)
 
 	for _, endpoint := range reportInfo.Endpoints {
-		currentPriority := getGradePriority(endpoint.Grade)
-		if currentPriority > bestPriority {
-			bestPriority = currentPriority
-			bestGrade = endpoint.Grade
-		}
 		if endpoint.HasWarnings {
 			hasWarningsAny = true
 		}
@@ -288,32 +492,68 @@ func generateSummary(reportInfo *FilteredTLSReport) string {
 		if contains(endpoint.Protocols, "TLS 1.3") {
 			hasTLS13 = true
 		}
-		if strings.Contains(strings.ToLower(endpoint.HSTS), "present") {
+		if isHSTSPresent(endpoint.HSTS) {
 			hasHSTS = true
 		}
-		if endpoint.HasWeakCiphers {
-			hasWeakCiphersAny = true
-		}
-		if endpoint.ChainIssues > chainIssuesAny {
-			chainIssuesAny = endpoint.ChainIssues
-		}
-		if endpoint.Certificate != nil && endpoint.Certificate.ExpiresInDays < minExpiresDays {
-			minExpiresDays = endpoint.Certificate.ExpiresInDays
-		}
 	}
 
-	var sb strings.Builder
+	reportInfo.Findings = buildFindings(reportInfo)
+	applyScores(reportInfo)
+	localizeFindings(reportInfo.Findings, reportInfo.Language)
+
+	reportInfo.Grade = grade
+	reportInfo.Verdict = buildVerdict(grade, isExceptionalAny, hasWarningsAny, hasTLS13, hasHSTS)
+	reportInfo.VerdictText = Translate(reportInfo.Language, "verdict."+reportInfo.Verdict)
+
+	return buildReportSummary(reportInfo)
+}
+
+/*
+buildReportSummary writes the summary text of a report from its grade, localized findings and verdict text, without
+computing them again
+Args:
 
-	summaryString := buildSummary(reportInfo, bestGrade, hasWarningsAny, isExceptionalAny, hasTLS13, hasHSTS, hasWeakCiphersAny, minExpiresDays, chainIssuesAny)
-	sb.WriteString(summaryString)
+	reportInfo *FilteredTLSReport: The report, with its language
+
+Returns:
 
-	finalVerdict := buildVerdict(bestGrade, isExceptionalAny, hasWarningsAny, hasTLS13, hasHSTS)
-	sb.WriteString(" VEREDICTO FINAL: ")
-	sb.WriteString(finalVerdict)
+	string: The summary in the report language
+*/
+func buildReportSummary(reportInfo *FilteredTLSReport) string {
+	if len(reportInfo.Endpoints) == 0 {
+		return Translate(reportInfo.Language, "summary.empty")
+	}
 
+	var sb strings.Builder
+	sb.WriteString(buildSummary(reportInfo, reportInfo.Grade))
+	sb.WriteString(Translate(reportInfo.Language, "summary.verdict"))
+	sb.WriteString(reportInfo.VerdictText)
 	return sb.String()
 }
 
+// Numerical priority of the letter grades, the higher the better
+var gradePriority = map[string]int{
+	"A+": 11,
+	"A":  10,
+	"A-": 9,
+	"B+": 8,
+	"B":  7,
+	"B-": 6,
+	"C+": 5,
+	"C":  4,
+	"C-": 3,
+	"D+": 2,
+	"D":  1,
+	"D-": 0,
+	"E+": -1,
+	"E":  -2,
+	"E-": -3,
+	"F":  -10,
+}
+
+// Priority of a grade that is not in gradePriority (e.g. T or M), lower than every known grade
+const unknownGradePriority = -100
+
 /*
 getGradePriority is used to manage a numerical priority scheme for letter grades.
 
@@ -326,29 +566,25 @@ Return:
 	int: Returns the numeric priority (the higher the better)
 */
 func getGradePriority(grade string) int {
-	var gradePriority = map[string]int{
-		"A+": 11,
-		"A":  10,
-		"A-": 9,
-		"B+": 8,
-		"B":  7,
-		"B-": 6,
-		"C+": 5,
-		"C":  4,
-		"C-": 3,
-		"D+": 2,
-		"D":  1,
-		"D-": 0,
-		"E+": -1,
-		"E":  -2,
-		"E-": -3,
-		"F":  -10,
-	}
-
 	if p, ok := gradePriority[grade]; ok {
 		return p
 	}
-	return -100 // unknown, priority low
+	return unknownGradePriority // unknown, priority low
+}
+
+/*
+GradePriorities returns the priority of each letter grade, used by the storage backends to sort by grade
+Returns:
+
+	map[string]int: A copy of the priorities (the higher the better)
+	int: The priority of any other grade
+*/
+func GradePriorities() (map[string]int, int) {
+	priorities := make(map[string]int, len(gradePriority))
+	for grade, priority := range gradePriority {
+		priorities[grade] = priority
+	}
+	return priorities, unknownGradePriority
 }
 
 /*
@@ -397,112 +633,55 @@ func containsAny(slice []string, items ...string) bool {
 /*
 buildSummary constructs a human-readable summary string for the TLS security report.
 
-It takes the pre-calculated analysis flags (best grade, presence of TLS 1.3, HSTS, etc.)
-and builds a concise, informative text that highlights the most important security aspects
-of the domain.
+It takes the domain grade and the localized findings already stored in the report and builds a concise,
+informative text that highlights the most important security aspects of the domain.
 
-The resulting string uses simple bullet points with hyphens (-) for easy reading
-and includes key observations about protocols, cipher strength, HSTS, certificate status,
-warnings, exceptional configuration, and chain issues.
+The resulting string uses simple bullet points with hyphens (-) for easy reading,
+one per finding, in the same order as the findings.
 
 Args:
 
-	reportInfo *FilteredTLSReport: The filtered report containing host and endpoints data.
-	bestGrade string: The highest grade found across all endpoints (e.g., "A+", "A", "F").
-	hasWarningsAny bool: True if any endpoint has warnings.
-	isExceptionalAny bool: True if any endpoint has an exceptional configuration.
-	hasTLS13 bool: True if at least one endpoint supports TLS 1.3.
-	hasHSTS bool: True if HSTS is present on at least one endpoint.
-	hasWeakCiphersAny bool: True if any endpoint has weak cipher suites enabled.
-	minExpiresDays float64: The lowest number of days remaining until certificate expiration
-	                        across all endpoints.
-	chainIssuesAny int64: The highest chain issues value found across endpoints
-	                      (0 = no issues).
+	reportInfo *FilteredTLSReport: The filtered report containing host, endpoints and findings data.
+	grade string: The domain grade aggregated across all endpoints (e.g., "A+", "A", "F").
 
 Returns:
 
-	string: A formatted summary string ready for display or storage.
+	string: A formatted summary string in the report language, ready for display or storage.
 */
-func buildSummary(reportInfo *FilteredTLSReport, bestGrade string, hasWarningsAny bool, isExceptionalAny bool, hasTLS13 bool, hasHSTS bool, hasWeakCiphersAny bool,
-	minExpiresDays float64, chainIssuesAny int64) string {
+func buildSummary(reportInfo *FilteredTLSReport, grade string) string {
 
 	var sb strings.Builder
 
 	// Introduction
-	sb.WriteString(fmt.Sprintf(" Análisis TLS para %s - Calificación general: %s", reportInfo.Host, bestGrade))
-
-	// Protocols
-	if hasTLS13 {
-		sb.WriteString(" - Soporta TLS 1.3 (excelente nivel de seguridad actual).")
-	} else if containsAny(reportInfo.Endpoints[0].Protocols, "TLS 1.2") {
-		sb.WriteString(" - Soporta TLS 1.2, pero sin TLS 1.3 (aceptable, pero no óptimo en 2026).")
-	} else {
-		sb.WriteString(" - Protocolos obsoletos o inseguros detectados.")
-	}
-
-	// Cipher strength
-	if len(reportInfo.Endpoints) > 0 {
-		ep := reportInfo.Endpoints[0] //first as reference
-		if ep.MaxCipherStrength >= 256 {
-			sb.WriteString(" - Cifrado fuerte (hasta 256 bits).")
-		} else if ep.MaxCipherStrength >= 128 {
-			sb.WriteString(" - Cifrado aceptable (128 bits).")
-		} else {
-			sb.WriteString(" - Cifrado débil detectado.")
-		}
-
-		if hasWeakCiphersAny {
-			sb.WriteString(" - Atención: hay suites cifradas débiles habilitadas.")
-		}
-	}
-
-	// HSTS
-	if hasHSTS {
-		sb.WriteString(" - HSTS está activo (buena protección contra downgrade).")
-	} else {
-		sb.WriteString(" - Sin HSTS → vulnerable a ataques de downgrade (HTTP plano posible).")
-	}
-
-	// Certificate
-	if minExpiresDays > 30 {
-		sb.WriteString(" - Certificado válido por más de 30 días.")
-	} else if minExpiresDays > 0 {
-		sb.WriteString(fmt.Sprintf(" - Certificado expira en %.1f días → renovar pronto.", minExpiresDays))
-	} else {
-		sb.WriteString(" - Certificado expirado o inválido → sitio inseguro.")
-	}
+	sb.WriteString(Translate(reportInfo.Language, "summary.intro", reportInfo.Host, grade))
 
-	// Warnings and exceptions
-	if hasWarningsAny {
-		sb.WriteString(" - Existen advertencias menores en la configuración.")
-	}
-	if isExceptionalAny {
-		sb.WriteString(" - Al menos un endpoint tiene configuración excepcional.")
-	}
-	if chainIssuesAny > 0 {
-		sb.WriteString(" - Problemas detectados en la cadena de certificados.\n")
+	for _, finding := range reportInfo.Findings {
+		sb.WriteString(" - ")
+		sb.WriteString(finding.Message)
 	}
 
 	return sb.String()
 }
 
 /*
-buildVerdict determines and returns a clear, human-readable security verdict
+buildVerdict determines and returns a clear, language-neutral security verdict
 based on the overall TLS grade and key security indicators from the report.
 
 The verdict reflects a realistic evaluation of the domain's TLS configuration in 2026,
 prioritizing modern standards (TLS 1.3, HSTS presence, absence of warnings, and exceptional setup).
 
 Logic overview:
-- "Excelente" requires A+ or a perfect A with TLS 1.3, HSTS, no warnings, and exceptional config.
-- "Buena" for solid A or A- with TLS 1.3 and HSTS.
-- "Aceptable" for B/C grades (functional but room for improvement).
-- "Deficiente" for D/E (high risk).
-- "Muy mala" for everything else (F or worse).
+- EXCELLENT requires A+ or a perfect A with TLS 1.3, HSTS, no warnings, and exceptional config.
+- GOOD for solid A or A- with TLS 1.3 and HSTS.
+- ACCEPTABLE for B/C grades (functional but room for improvement).
+- POOR for D/E (high risk).
+- VERY_POOR for everything else (F or worse).
+
+The localized text of the verdict is obtained with Translate(lang, "verdict."+verdict).
 
 Args:
 
-	bestGrade string: The highest grade found across all endpoints (e.g. "A+", "A", "F").
+	grade string: The grade being judged (the domain grade or a single endpoint grade, e.g. "A+", "A", "F").
 	isExceptionalAny bool: True if at least one endpoint has an exceptional configuration.
 	hasWarningsAny bool: True if any endpoint has configuration warnings.
 	hasTLS13 bool: True if at least one endpoint supports TLS 1.3.
@@ -510,22 +689,22 @@ Args:
 
 Returns:
 
-	string: A concise verdict string (e.g. " Excelente", " Buena", " Muy mala (sitio inseguro)").
+	string: The verdict value (VerdictExcellent, VerdictGood, VerdictAcceptable, VerdictPoor or VerdictVeryPoor).
 */
-func buildVerdict(bestGrade string, isExceptionalAny bool, hasWarningsAny bool, hasTLS13 bool, hasHSTS bool) string {
+func buildVerdict(grade string, isExceptionalAny bool, hasWarningsAny bool, hasTLS13 bool, hasHSTS bool) string {
 	// Final verdict
 	var verdict string
 	switch {
-	case bestGrade == "A+" || (bestGrade == "A" && isExceptionalAny && !hasWarningsAny && hasTLS13 && hasHSTS):
-		verdict = " Excelente"
-	case bestGrade == "A" || (bestGrade == "A-" && hasTLS13 && hasHSTS):
-		verdict = " Buena"
-	case bestGrade == "B" || bestGrade == "C":
-		verdict = " Aceptable (se recomienda mejorar)"
-	case bestGrade == "D" || bestGrade == "E":
-		verdict = " Deficiente (riesgo alto)"
+	case grade == "A+" || (grade == "A" && isExceptionalAny && !hasWarningsAny && hasTLS13 && hasHSTS):
+		verdict = VerdictExcellent
+	case grade == "A" || (grade == "A-" && hasTLS13 && hasHSTS):
+		verdict = VerdictGood
+	case grade == "B" || grade == "C":
+		verdict = VerdictAcceptable
+	case grade == "D" || grade == "E":
+		verdict = VerdictPoor
 	default:
-		verdict = " Muy mala (sitio inseguro)"
+		verdict = VerdictVeryPoor
 	}
 
 	return verdict